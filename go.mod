@@ -11,6 +11,7 @@ require (
 	github.com/issue9/unique/v2 v2.1.0
 	github.com/issue9/web v0.88.3
 	github.com/shirou/gopsutil/v3 v3.24.2
+	golang.org/x/crypto v0.21.0
 	golang.org/x/text v0.14.0
 )
 
@@ -39,7 +40,6 @@ require (
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/mod v0.16.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
@@ -0,0 +1,272 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package jwe JSON Web Encryption 的紧凑格式
+//
+// 内容加密仅支持 A256GCM，密钥管理支持 dir、RSA-OAEP-256 和 ECDH-ES。
+//
+// https://datatracker.ietf.org/doc/html/rfc7516
+package jwe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+)
+
+// 密钥管理算法
+const (
+	Dir        = "dir"
+	RSAOAEP256 = "RSA-OAEP-256"
+	ECDHES     = "ECDH-ES"
+)
+
+// A256GCM 内容加密算法
+const A256GCM = "A256GCM"
+
+const keySize = 32 // A256GCM 的密钥长度
+
+var encoding = base64.RawURLEncoding
+
+var errInvalidToken = errors.New("jwe: invalid token")
+
+// Header JWE 的报头
+type Header struct {
+	Alg string   `json:"alg"`
+	Enc string   `json:"enc"`
+	Kid string   `json:"kid,omitempty"`
+	Cty string   `json:"cty,omitempty"`
+	EPK *jwk.Key `json:"epk,omitempty"`
+}
+
+// KeyFunc 根据报头返回解密用的密钥
+type KeyFunc = func(*Header) (any, error)
+
+// IsJWE 是否为 JWE 的紧凑格式
+//
+// 仅根据分段的数量判断，JWS 为三段，JWE 为五段。
+func IsJWE(token string) bool { return strings.Count(token, ".") == 4 }
+
+// Encrypt 加密 payload
+//
+// key 根据 alg 的不同分别为 []byte、*rsa.PublicKey 和 *ecdh.PublicKey；
+// cty 为 payload 的类型，嵌套的 JWT 应该为 JWT；
+func Encrypt(alg, kid, cty string, key any, payload []byte) (string, error) {
+	h := &Header{Alg: alg, Enc: A256GCM, Kid: kid, Cty: cty}
+
+	var cek, encryptedKey []byte
+	switch alg {
+	case Dir:
+		k, ok := key.([]byte)
+		if !ok || len(k) != keySize {
+			return "", errors.New("jwe: invalid dir key")
+		}
+		cek = k
+	case RSAOAEP256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return "", errors.New("jwe: invalid rsa-oaep-256 key")
+		}
+
+		cek = make([]byte, keySize)
+		if _, err := rand.Read(cek); err != nil {
+			return "", err
+		}
+
+		var err error
+		if encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil); err != nil {
+			return "", err
+		}
+	case ECDHES:
+		pub, ok := key.(*ecdh.PublicKey)
+		if !ok {
+			return "", errors.New("jwe: invalid ecdh-es key")
+		}
+
+		epk, err := pub.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		if h.EPK, err = jwk.FromECDHPublicKey(epk.PublicKey()); err != nil {
+			return "", err
+		}
+
+		z, err := epk.ECDH(pub)
+		if err != nil {
+			return "", err
+		}
+		cek = concatKDF(z, A256GCM, nil, nil, keySize*8)
+	default:
+		return "", fmt.Errorf("jwe: unsupported alg %s", alg)
+	}
+
+	header, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	protected := encoding.EncodeToString(header)
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nil, iv, payload, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		encoding.EncodeToString(encryptedKey),
+		encoding.EncodeToString(iv),
+		encoding.EncodeToString(ciphertext),
+		encoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// Decrypt 解密 token
+//
+// f 返回的密钥根据 alg 的不同分别为 []byte、*rsa.PrivateKey 和 *ecdh.PrivateKey，
+// f 应该验证报头中的 alg 是否与密钥相符。
+func Decrypt(token string, f KeyFunc) ([]byte, *Header, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, errInvalidToken
+	}
+
+	header, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	h := &Header{}
+	if err := json.Unmarshal(header, h); err != nil {
+		return nil, nil, err
+	}
+	if h.Enc != A256GCM {
+		return nil, nil, fmt.Errorf("jwe: unsupported enc %s", h.Enc)
+	}
+
+	decoded := make([][]byte, 4)
+	for i, p := range parts[1:] {
+		if decoded[i], err = encoding.DecodeString(p); err != nil {
+			return nil, nil, err
+		}
+	}
+	encryptedKey, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3]
+
+	key, err := f(h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cek, err := unwrapKey(h, key, encryptedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+		return nil, nil, errInvalidToken
+	}
+
+	payload, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, nil, err
+	}
+	return payload, h, nil
+}
+
+func unwrapKey(h *Header, key any, encryptedKey []byte) ([]byte, error) {
+	switch h.Alg {
+	case Dir:
+		k, ok := key.([]byte)
+		if !ok || len(k) != keySize || len(encryptedKey) != 0 {
+			return nil, errInvalidToken
+		}
+		return k, nil
+	case RSAOAEP256:
+		pvt, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errInvalidToken
+		}
+
+		cek, err := rsa.DecryptOAEP(sha256.New(), nil, pvt, encryptedKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(cek) != keySize {
+			return nil, errInvalidToken
+		}
+		return cek, nil
+	case ECDHES:
+		pvt, ok := key.(*ecdh.PrivateKey)
+		if !ok || h.EPK == nil || len(encryptedKey) != 0 {
+			return nil, errInvalidToken
+		}
+
+		epk, err := h.EPK.ECDHPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		if epk.Curve() != pvt.Curve() {
+			return nil, errInvalidToken
+		}
+
+		z, err := pvt.ECDH(epk)
+		if err != nil {
+			return nil, err
+		}
+		return concatKDF(z, A256GCM, nil, nil, keySize*8), nil
+	default:
+		return nil, fmt.Errorf("jwe: unsupported alg %s", h.Alg)
+	}
+}
+
+func newGCM(cek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Concat KDF
+//
+// https://datatracker.ietf.org/doc/html/rfc7518#section-4.6.2
+func concatKDF(z []byte, alg string, apu, apv []byte, bits int) []byte {
+	size := bits / 8
+	out := make([]byte, 0, size+sha256.Size)
+
+	for counter := uint32(1); len(out) < size; counter++ {
+		h := sha256.New()
+		binary.Write(h, binary.BigEndian, counter)
+		h.Write(z)
+		binary.Write(h, binary.BigEndian, uint32(len(alg)))
+		h.Write([]byte(alg))
+		binary.Write(h, binary.BigEndian, uint32(len(apu)))
+		h.Write(apu)
+		binary.Write(h, binary.BigEndian, uint32(len(apv)))
+		h.Write(apv)
+		binary.Write(h, binary.BigEndian, uint32(bits))
+		out = h.Sum(out)
+	}
+	return out[:size]
+}
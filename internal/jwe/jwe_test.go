@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwe
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc7518#appendix-C
+func TestConcatKDF(t *testing.T) {
+	a := assert.New(t, false)
+
+	d, err := encoding.DecodeString("VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw")
+	a.NotError(err)
+	bob, err := ecdh.P256().NewPrivateKey(d)
+	a.NotError(err)
+
+	epk := &jwk.Key{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   "gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0",
+		Y:   "SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps",
+	}
+	pub, err := epk.ECDHPublicKey()
+	a.NotError(err)
+
+	z, err := bob.ECDH(pub)
+	a.NotError(err)
+
+	key := concatKDF(z, "A128GCM", []byte("Alice"), []byte("Bob"), 128)
+	a.Equal(encoding.EncodeToString(key), "VqqN6vgjbSBcIijNcacQGg")
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	a := assert.New(t, false)
+	payload := []byte("header.payload.signature")
+
+	dirKey := make([]byte, keySize)
+	_, err := rand.Read(dirKey)
+	a.NotError(err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NotError(err)
+	p256, err := ecdh.P256().GenerateKey(rand.Reader)
+	a.NotError(err)
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	a.NotError(err)
+
+	data := []struct {
+		alg     string
+		enc     any
+		dec     any
+		wrong   any
+		withKey bool
+	}{
+		{alg: Dir, enc: dirKey, dec: dirKey, wrong: make([]byte, keySize)},
+		{alg: RSAOAEP256, enc: &rsaKey.PublicKey, dec: rsaKey, wrong: dirKey, withKey: true},
+		{alg: ECDHES, enc: p256.PublicKey(), dec: p256, wrong: x25519},
+		{alg: ECDHES, enc: x25519.PublicKey(), dec: x25519, wrong: p256},
+	}
+
+	for _, item := range data {
+		token, err := Encrypt(item.alg, "kid", "JWT", item.enc, payload)
+		a.NotError(err).True(IsJWE(token))
+		parts := strings.Split(token, ".")
+		a.Equal(parts[1] != "", item.withKey, item.alg)
+
+		p, h, err := Decrypt(token, func(h *Header) (any, error) {
+			a.Equal(h.Kid, "kid").Equal(h.Alg, item.alg).Equal(h.Enc, A256GCM)
+			return item.dec, nil
+		})
+		a.NotError(err).Equal(p, payload).Equal(h.Cty, "JWT")
+
+		// 错误的密钥
+		_, _, err = Decrypt(token, func(*Header) (any, error) { return item.wrong, nil })
+		a.Error(err, item.alg)
+
+		// 篡改密文
+		ciphertext, err := encoding.DecodeString(parts[3])
+		a.NotError(err)
+		ciphertext[0] ^= 1
+		parts[3] = encoding.EncodeToString(ciphertext)
+		_, _, err = Decrypt(strings.Join(parts, "."), func(*Header) (any, error) { return item.dec, nil })
+		a.Error(err, item.alg)
+	}
+
+	// 篡改报头
+	token, err := Encrypt(Dir, "kid", "JWT", dirKey, payload)
+	a.NotError(err)
+	parts := strings.Split(token, ".")
+	header, err := json.Marshal(&Header{Alg: Dir, Enc: A256GCM, Kid: "other"})
+	a.NotError(err)
+	parts[0] = encoding.EncodeToString(header)
+	_, _, err = Decrypt(strings.Join(parts, "."), func(*Header) (any, error) { return dirKey, nil })
+	a.Error(err)
+
+	// keyFunc 返回错误
+	errKey := errors.New("key")
+	_, _, err = Decrypt(token, func(*Header) (any, error) { return nil, errKey })
+	a.Equal(err, errKey)
+
+	_, _, err = Decrypt("a.b.c", func(*Header) (any, error) { return dirKey, nil })
+	a.Error(err)
+	a.False(IsJWE("a.b.c"))
+
+	_, err = Encrypt("A128KW", "kid", "JWT", dirKey, payload)
+	a.Error(err)
+	_, err = Encrypt(Dir, "kid", "JWT", []byte("short"), payload)
+	a.Error(err)
+	_, err = Encrypt(RSAOAEP256, "kid", "JWT", dirKey, payload)
+	a.Error(err)
+	_, err = Encrypt(ECDHES, "kid", "JWT", dirKey, payload)
+	a.Error(err)
+}
@@ -0,0 +1,333 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package jwk JSON Web Key 的编解码
+//
+// https://datatracker.ietf.org/doc/html/rfc7517
+package jwk
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var encoding = base64.RawURLEncoding
+
+// Key JSON Web Key
+type Key struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC 和 OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	// oct
+	K string `json:"k,omitempty"`
+
+	// 私钥部分，其中 D 同时用于 EC 和 OKP。
+	D  string `json:"d,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+}
+
+// Set JSON Web Key Set
+type Set struct {
+	Keys []*Key `json:"keys"`
+}
+
+// PublicKey 转换为公钥
+//
+// 根据 kty 的不同，返回值可能是 *rsa.PublicKey、*ecdsa.PublicKey、ed25519.PublicKey 或是 []byte。
+func (k *Key) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("jwk: invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		pub, err := k.ecdsaPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jwk: unsupported okp curve %s", k.Crv)
+		}
+		x, err := encoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwk: invalid ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return encoding.DecodeString(k.K)
+	default:
+		return nil, fmt.Errorf("jwk: unsupported kty %s", k.Kty)
+	}
+}
+
+// PrivateKey 转换为私钥
+//
+// 根据 kty 的不同，返回值可能是 *rsa.PrivateKey、*ecdsa.PrivateKey、ed25519.PrivateKey 或是 []byte。
+// 如果不包含私钥部分，返回错误。
+func (k *Key) PrivateKey() (any, error) {
+	if k.Kty == "oct" {
+		return k.PublicKey()
+	}
+	if k.D == "" {
+		return nil, errors.New("jwk: missing private key")
+	}
+
+	pub, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		ints := make([]*big.Int, 0, 3)
+		for _, v := range []string{k.D, k.P, k.Q} {
+			i, err := decodeInt(v)
+			if err != nil {
+				return nil, err
+			}
+			ints = append(ints, i)
+		}
+
+		pvt := &rsa.PrivateKey{PublicKey: *p, D: ints[0], Primes: ints[1:]}
+		if err := pvt.Validate(); err != nil {
+			return nil, err
+		}
+		pvt.Precompute()
+		return pvt, nil
+	case *ecdsa.PublicKey:
+		d, err := decodeInt(k.D)
+		if err != nil {
+			return nil, err
+		}
+
+		pvt := &ecdsa.PrivateKey{PublicKey: *p, D: d}
+		e, err := pvt.ECDH() // 同时验证了 d 的有效性
+		if err != nil {
+			return nil, err
+		}
+		if pe, err := p.ECDH(); err != nil || !e.PublicKey().Equal(pe) {
+			return nil, errors.New("jwk: ec private key does not match public key")
+		}
+		return pvt, nil
+	case ed25519.PublicKey:
+		seed, err := encoding.DecodeString(k.D)
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New("jwk: invalid ed25519 private key")
+		}
+
+		pvt := ed25519.NewKeyFromSeed(seed)
+		if !p.Equal(pvt.Public()) {
+			return nil, errors.New("jwk: ed25519 private key does not match public key")
+		}
+		return pvt, nil
+	default: // 不可能出现
+		return nil, fmt.Errorf("jwk: unsupported kty %s", k.Kty)
+	}
+}
+
+// Thumbprint 计算 JWK Thumbprint
+//
+// 采用 SHA-256 并以 base64url 编码返回。
+//
+// https://datatracker.ietf.org/doc/html/rfc7638
+func (k *Key) Thumbprint() (string, error) {
+	var data string
+	switch k.Kty { // 仅包含必要的字段，且按字典顺序排列。
+	case "RSA":
+		data = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		data = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		data = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	case "oct":
+		data = fmt.Sprintf(`{"k":%q,"kty":"oct"}`, k.K)
+	default:
+		return "", fmt.Errorf("jwk: unsupported kty %s", k.Kty)
+	}
+
+	sum := sha256.Sum256([]byte(data))
+	return encoding.EncodeToString(sum[:]), nil
+}
+
+func (k *Key) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	curve, ec, err := curveOf(k.Crv)
+	if err != nil {
+		return nil, err
+	}
+
+	x, err := encoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := encoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+	if len(x) != size || len(y) != size {
+		return nil, errors.New("jwk: invalid ec point size")
+	}
+
+	// 由 ecdh 验证点是否在曲线上
+	point := make([]byte, 0, 1+2*size)
+	point = append(point, 4)
+	point = append(point, x...)
+	point = append(point, y...)
+	if _, err := ec.NewPublicKey(point); err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// FromPublicKey 根据公钥生成 [Key]
+//
+// pub 可以是 *rsa.PublicKey、*ecdsa.PublicKey 和 ed25519.PublicKey，
+// 其它类型返回错误。
+func FromPublicKey(kid, alg string, pub any) (*Key, error) {
+	k := &Key{Kid: kid, Alg: alg, Use: "sig"}
+
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = encoding.EncodeToString(p.N.Bytes())
+		k.E = encoding.EncodeToString(big.NewInt(int64(p.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (p.Curve.Params().BitSize + 7) / 8
+		k.Kty = "EC"
+		k.Crv = p.Curve.Params().Name
+		k.X = encoding.EncodeToString(p.X.FillBytes(make([]byte, size)))
+		k.Y = encoding.EncodeToString(p.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		k.Kty = "OKP"
+		k.Crv = "Ed25519"
+		k.X = encoding.EncodeToString(p)
+	default:
+		return nil, fmt.Errorf("jwk: unsupported public key type %T", pub)
+	}
+
+	return k, nil
+}
+
+// FromECDHPublicKey 根据 ECDH 公钥生成 [Key]
+//
+// 支持 P-256、P-384、P-521 和 X25519，主要用于 JWE 中的 epk 报头。
+func FromECDHPublicKey(pub *ecdh.PublicKey) (*Key, error) {
+	if pub.Curve() == ecdh.X25519() {
+		return &Key{Kty: "OKP", Crv: "X25519", X: encoding.EncodeToString(pub.Bytes())}, nil
+	}
+
+	var crv string
+	switch pub.Curve() {
+	case ecdh.P256():
+		crv = "P-256"
+	case ecdh.P384():
+		crv = "P-384"
+	case ecdh.P521():
+		crv = "P-521"
+	default:
+		return nil, errors.New("jwk: unsupported ecdh curve")
+	}
+
+	point := pub.Bytes()[1:] // 非压缩格式：0x04 || X || Y
+	size := len(point) / 2
+	return &Key{
+		Kty: "EC",
+		Crv: crv,
+		X:   encoding.EncodeToString(point[:size]),
+		Y:   encoding.EncodeToString(point[size:]),
+	}, nil
+}
+
+// ECDHPublicKey 转换为 ECDH 公钥
+//
+// 仅支持 kty 为 EC 或是 crv 为 X25519 的 OKP。
+func (k *Key) ECDHPublicKey() (*ecdh.PublicKey, error) {
+	switch {
+	case k.Kty == "OKP" && k.Crv == "X25519":
+		x, err := encoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ecdh.X25519().NewPublicKey(x)
+	case k.Kty == "EC":
+		pub, err := k.ecdsaPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		return pub.ECDH()
+	default:
+		return nil, fmt.Errorf("jwk: unsupported ecdh key %s", k.Kty)
+	}
+}
+
+func curveOf(crv string) (elliptic.Curve, ecdh.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), ecdh.P256(), nil
+	case "P-384":
+		return elliptic.P384(), ecdh.P384(), nil
+	case "P-521":
+		return elliptic.P521(), ecdh.P521(), nil
+	default:
+		return nil, nil, fmt.Errorf("jwk: unsupported ec curve %s", crv)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("jwk: empty integer")
+	}
+
+	data, err := encoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwk
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestKey(t *testing.T) {
+	a := assert.New(t, false)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NotError(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+
+	for _, pub := range []any{&rsaKey.PublicKey, &ecKey.PublicKey, edPub} {
+		k, err := FromPublicKey("kid", "alg", pub)
+		a.NotError(err).NotNil(k).Equal(k.Kid, "kid").Equal(k.Use, "sig")
+
+		data, err := json.Marshal(&Set{Keys: []*Key{k}})
+		a.NotError(err)
+
+		set := &Set{}
+		a.NotError(json.Unmarshal(data, set)).Length(set.Keys, 1)
+
+		p, err := set.Keys[0].PublicKey()
+		a.NotError(err).Equal(p, pub)
+	}
+
+	k, err := FromPublicKey("kid", "alg", []byte("secret"))
+	a.Error(err).Nil(k)
+
+	// 不在曲线上的点
+	k, err = FromPublicKey("kid", "ES256", &ecKey.PublicKey)
+	a.NotError(err)
+	k.Y = k.X
+	p, err := k.PublicKey()
+	a.Error(err).Nil(p)
+
+	k = &Key{Kty: "oct", K: "c2VjcmV0"}
+	p, err = k.PublicKey()
+	a.NotError(err).Equal(p, []byte("secret"))
+
+	k = &Key{Kty: "unknown"}
+	p, err = k.PublicKey()
+	a.Error(err).Nil(p)
+}
+
+func TestECDHKey(t *testing.T) {
+	a := assert.New(t, false)
+
+	for _, curve := range []ecdh.Curve{ecdh.P256(), ecdh.P384(), ecdh.P521(), ecdh.X25519()} {
+		pvt, err := curve.GenerateKey(rand.Reader)
+		a.NotError(err)
+
+		k, err := FromECDHPublicKey(pvt.PublicKey())
+		a.NotError(err).NotNil(k).Empty(k.Use)
+
+		data, err := json.Marshal(k)
+		a.NotError(err)
+		k2 := &Key{}
+		a.NotError(json.Unmarshal(data, k2))
+
+		pub, err := k2.ECDHPublicKey()
+		a.NotError(err).True(pub.Equal(pvt.PublicKey()))
+	}
+
+	_, err := (&Key{Kty: "OKP", Crv: "Ed25519"}).ECDHPublicKey()
+	a.Error(err)
+	_, err = (&Key{Kty: "RSA"}).ECDHPublicKey()
+	a.Error(err)
+}
+
+func TestKey_Thumbprint(t *testing.T) {
+	a := assert.New(t, false)
+
+	// https://datatracker.ietf.org/doc/html/rfc7638#section-3.1
+	k := &Key{
+		Kty: "RSA",
+		Kid: "2011-04-29",
+		Alg: "RS256",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	tp, err := k.Thumbprint()
+	a.NotError(err).Equal(tp, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs")
+
+	// 与 kid、alg 和 use 无关
+	k.Kid = ""
+	k.Use = "sig"
+	tp2, err := k.Thumbprint()
+	a.NotError(err).Equal(tp2, tp)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+	for _, pub := range []any{&ecKey.PublicKey, edPub} {
+		k, err := FromPublicKey("kid", "alg", pub)
+		a.NotError(err)
+		tp, err := k.Thumbprint()
+		a.NotError(err).Length(tp, 43)
+	}
+
+	tp, err = (&Key{Kty: "unknown"}).Thumbprint()
+	a.Error(err).Empty(tp)
+}
+
+func TestKey_PrivateKey(t *testing.T) {
+	a := assert.New(t, false)
+	enc := func(i *big.Int) string { return encoding.EncodeToString(i.Bytes()) }
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NotError(err)
+	k, err := FromPublicKey("kid", "RS256", &rsaKey.PublicKey)
+	a.NotError(err)
+	k.D, k.P, k.Q = enc(rsaKey.D), enc(rsaKey.Primes[0]), enc(rsaKey.Primes[1])
+	pvt, err := k.PrivateKey()
+	a.NotError(err).True(rsaKey.Equal(pvt))
+
+	k.D = enc(big.NewInt(5))
+	pvt, err = k.PrivateKey()
+	a.Error(err).Nil(pvt)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	k, err = FromPublicKey("kid", "ES256", &ecKey.PublicKey)
+	a.NotError(err)
+	k.D = encoding.EncodeToString(ecKey.D.FillBytes(make([]byte, 32)))
+	pvt, err = k.PrivateKey()
+	a.NotError(err).True(ecKey.Equal(pvt))
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	k.D = encoding.EncodeToString(other.D.Bytes())
+	pvt, err = k.PrivateKey()
+	a.Error(err).Nil(pvt)
+
+	edPub, edPvt, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+	k, err = FromPublicKey("kid", "EdDSA", edPub)
+	a.NotError(err)
+	k.D = encoding.EncodeToString(edPvt.Seed())
+	pvt, err = k.PrivateKey()
+	a.NotError(err).Equal(pvt, edPvt)
+
+	// 没有私钥
+	k.D = ""
+	pvt, err = k.PrivateKey()
+	a.Error(err).Nil(pvt)
+
+	pvt, err = (&Key{Kty: "oct", K: "c2VjcmV0"}).PrivateKey()
+	a.NotError(err).Equal(pvt, []byte("secret"))
+}
@@ -5,23 +5,43 @@
 // Package mauth middlewares/auth 的私有函数
 package mauth
 
-import "github.com/issue9/web"
+import (
+	"crypto/rand"
+	"encoding/base64"
 
-type keyType int
+	"github.com/issue9/web"
+)
 
-const valueKey keyType = 1
+// 每个验证器在 [web.Context] 中的存储位置
+//
+// owner 为验证器对象本身，必须是可比较的类型，一般为指针。
+type slot struct{ owner any }
 
 const AuthorizationHeader = "Authorization"
 
-// Set 更新 [web.Context] 保存的值
-func Set[T any](ctx *web.Context, val T) { ctx.SetVar(valueKey, val) }
+// Set 更新 [web.Context] 中由 owner 保存的值
+//
+// 不同的 owner 保存在不同的位置，多个验证器可以同时作用于同一个请求而不会相互覆盖。
+func Set[T any](ctx *web.Context, owner any, val T) { ctx.SetVar(slot{owner: owner}, val) }
 
-// Get 获取当前对话关联的信息
-func Get[T any](ctx *web.Context) (val T, found bool) {
-	if v, found := ctx.GetVar(valueKey); found {
-		return v.(T), true
+// Get 获取当前对话中由 owner 关联的信息
+//
+// 如果不存在或是类型不匹配，返回零值和 false。
+func Get[T any](ctx *web.Context, owner any) (val T, found bool) {
+	if v, found := ctx.GetVar(slot{owner: owner}); found {
+		val, found = v.(T)
+		return val, found
 	}
+	return val, false
+}
 
-	var zero T
-	return zero, false
+// RandString 生成长度为 n 字节的随机数据并以 base64url 编码返回
+//
+// 用于生成 state、nonce、challenge 等对安全性有要求的随机值。
+func RandString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand 出错表示系统存在问题，无法继续。
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
 }
@@ -21,10 +21,33 @@ func TestGetSet(t *testing.T) {
 	a.NotError(err).NotNil(s)
 
 	ctx := s.NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/path", nil), types.NewContext())
-	val, found := Get[int](ctx)
+	o1, o2 := &struct{ int }{}, &struct{ int }{}
+
+	val, found := Get[int](ctx, o1)
 	a.False(found).Zero(val)
 
-	Set(ctx, 5)
-	val, found = Get[int](ctx)
+	Set(ctx, o1, 5)
+	val, found = Get[int](ctx, o1)
 	a.True(found).Equal(val, 5)
+
+	// 不同的 owner 互不影响
+	val, found = Get[int](ctx, o2)
+	a.False(found).Zero(val)
+	Set(ctx, o2, "str")
+	val, found = Get[int](ctx, o1)
+	a.True(found).Equal(val, 5)
+
+	// 类型不匹配
+	val, found = Get[int](ctx, o2)
+	a.False(found).Zero(val)
+	str, found := Get[string](ctx, o2)
+	a.True(found).Equal(str, "str")
+}
+
+func TestRandString(t *testing.T) {
+	a := assert.New(t, false)
+
+	s1 := RandString(32)
+	s2 := RandString(32)
+	a.Length(s1, 43).Length(s2, 43).NotEqual(s1, s2)
 }
@@ -38,6 +38,8 @@ type basic[T any] struct {
 	authorization string
 	authenticate  string
 	problemID     string
+
+	sink auth.Sink
 }
 
 // New 声明一个 [Basic 验证]的中间件
@@ -46,6 +48,8 @@ type basic[T any] struct {
 // true 会输出 Proxy-Authorization 和 Proxy-Authenticate 报头和 407 状态码，
 // 而 false 则是输出 Authorization 和 WWW-Authenticate 报头和 401 状态码；
 //
+// 返回对象实现了 [auth.SinkSetter]，可用于指定接收验证相关事件的对象。
+//
 // T 表示验证成功之后，向用户传递的一些额外信息。之后可通过 [GetValue] 获取。
 //
 // [Basic 验证]: https://datatracker.ietf.org/doc/html/rfc7617
@@ -75,35 +79,51 @@ func New[T any](srv web.Server, auth AuthFunc[T], realm string, proxy bool) auth
 	}
 }
 
+func (b *basic[T]) SetSink(sink auth.Sink) { b.sink = sink }
+
 func (b *basic[T]) Middleware(next web.HandlerFunc) web.HandlerFunc {
 	return func(ctx *web.Context) web.Responser {
 		h := auth.GetToken(ctx, prefix, b.authorization)
 
+		if h == "" {
+			auth.Emit(ctx, b.sink, &auth.Event{Type: auth.EventFailure, Source: "basic", Reason: auth.ReasonMissingCredential})
+			return b.unauthorization(ctx)
+		}
+
 		secret, err := base64.StdEncoding.DecodeString(h)
 		if err != nil {
+			auth.Emit(ctx, b.sink, &auth.Event{Type: auth.EventFailure, Source: "basic", Reason: auth.ReasonInvalidCredential, Err: err})
 			ctx.Header().Set(b.authenticate, b.realm)
 			return ctx.Error(err, b.problemID)
 		}
 
 		pp, ss, ok := bytes.Cut(secret, []byte{':'})
 		if !ok {
+			auth.Emit(ctx, b.sink, &auth.Event{Type: auth.EventFailure, Source: "basic", Reason: auth.ReasonInvalidCredential})
 			return b.unauthorization(ctx)
 		}
 		v, ok := b.auth(pp, ss)
 		if !ok {
+			auth.Emit(ctx, b.sink, &auth.Event{Type: auth.EventFailure, Source: "basic", Identity: string(pp), Reason: auth.ReasonInvalidCredential})
 			return b.unauthorization(ctx)
 		}
 
-		mauth.Set(ctx, v)
+		mauth.Set(ctx, b, v)
+		auth.Emit(ctx, b.sink, &auth.Event{Type: auth.EventSuccess, Source: "basic", Identity: string(pp), Info: v})
 		return next(ctx)
 	}
 }
 
-func (b *basic[T]) Logout(*web.Context) error { return nil }
+func (b *basic[T]) Logout(ctx *web.Context) error {
+	if v, found := b.GetInfo(ctx); found {
+		auth.Emit(ctx, b.sink, &auth.Event{Type: auth.EventLogout, Source: "basic", Info: v})
+	}
+	return nil
+}
 
 func (b *basic[T]) unauthorization(ctx *web.Context) web.Responser {
 	ctx.Header().Set(b.authenticate, b.realm)
 	return ctx.Problem(b.problemID)
 }
 
-func (b *basic[T]) GetInfo(ctx *web.Context) (T, bool) { return mauth.Get[T](ctx) }
+func (b *basic[T]) GetInfo(ctx *web.Context) (T, bool) { return mauth.Get[T](ctx, b) }
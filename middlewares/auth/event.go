@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package auth
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/issue9/web"
+)
+
+// 事件的类型
+const (
+	EventSuccess          EventType = iota + 1 // 验证成功
+	EventFailure                               // 验证失败
+	EventLogout                                // 退出登录
+	EventRefresh                               // 刷新令牌
+	EventBlocked                               // 令牌已被拉黑
+	EventImpersonateStart                      // 开始以其它用户的身份进行操作
+	EventImpersonateStop                       // 结束以其它用户的身份进行操作
+	EventRefreshReuse                          // 已经使用过的刷新令牌被再次提交，其所属的令牌家族被吊销。
+)
+
+// 验证失败的原因
+const (
+	ReasonMissingCredential = "missing-credential" // 未提交凭证
+	ReasonInvalidCredential = "invalid-credential" // 凭证无效，比如用户名或密码错误、令牌签名错误等
+	ReasonExpired           = "expired"            // 凭证已过期
+	ReasonNotRefreshToken   = "not-refresh-token"  // 需要刷新令牌，但提交的是普通令牌
+)
+
+type (
+	// EventType 事件的类型
+	EventType int8
+
+	// Event 验证相关的事件
+	//
+	// 可用于审计、告警以及实现登录失败锁定等功能。
+	Event struct {
+		Type   EventType
+		Source string    // 事件的来源，比如 basic、jwt、session 等
+		Time   time.Time // 事件发生的时间
+		IP     string    // 客户端的 IP
+		ID     string    // 请求的唯一 ID
+
+		// 用户提交的身份标识
+		//
+		// 在验证失败时，如果能确定用户提交的身份，比如 basic 中的用户名，会填写此值。
+		Identity string
+
+		// 用户信息
+		//
+		// 即 [Auth.GetInfo] 返回的值，验证失败时为空。
+		Info any
+
+		Reason string // 验证失败或是拉黑的原因
+		Err    error  // 导致验证失败的错误信息，可能为空。
+	}
+
+	// Sink 事件的接收者
+	Sink interface {
+		// Emit 接收事件
+		//
+		// 该方法在处理请求的过程中调用，不应该阻塞。
+		Emit(*Event)
+	}
+
+	// SinkSetter 可以指定 [Sink] 的对象
+	//
+	// basic、jwt 和 session 等验证器均实现了此接口，默认不发送任何事件。
+	SinkSetter interface {
+		SetSink(Sink)
+	}
+
+	// SinkFunc 以同步的方式处理事件
+	SinkFunc func(*Event)
+
+	asyncSink struct {
+		s       web.Server
+		events  chan *Event
+		f       SinkFunc
+		dropped atomic.Int64
+	}
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSuccess:
+		return "success"
+	case EventFailure:
+		return "failure"
+	case EventLogout:
+		return "logout"
+	case EventRefresh:
+		return "refresh"
+	case EventBlocked:
+		return "blocked"
+	case EventImpersonateStart:
+		return "impersonate-start"
+	case EventImpersonateStop:
+		return "impersonate-stop"
+	case EventRefreshReuse:
+		return "refresh-reuse"
+	default:
+		return "unknown"
+	}
+}
+
+func (f SinkFunc) Emit(e *Event) { f(e) }
+
+// NewAsyncSink 声明以异步方式处理事件的 [Sink]
+//
+// 事件会被放入长度为 size 的缓冲区，由 s 的服务依次交给 f 处理。
+// 当缓冲区已满时，新的事件会被丢弃并记录日志，不会阻塞请求。
+func NewAsyncSink(s web.Server, size int, f SinkFunc) Sink {
+	if size <= 0 {
+		panic("参数 size 必须大于 0")
+	}
+	if f == nil {
+		panic("参数 f 不能为空")
+	}
+
+	sink := &asyncSink{s: s, events: make(chan *Event, size), f: f}
+	s.Services().Add(web.Phrase("auth event sink"), web.ServiceFunc(sink.serve))
+	return sink
+}
+
+func (s *asyncSink) Emit(e *Event) {
+	select {
+	case s.events <- e:
+	default:
+		n := s.dropped.Add(1)
+		s.s.Logs().ERROR().LocaleString(web.Phrase("auth event buffer is full, %d events dropped", n))
+	}
+}
+
+func (s *asyncSink) serve(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			for { // 处理剩余的事件
+				select {
+				case e := <-s.events:
+					s.f(e)
+				default:
+					return ctx.Err()
+				}
+			}
+		case e := <-s.events:
+			s.f(e)
+		}
+	}
+}
+
+// Emit 向 s 发送事件
+//
+// s 为空时不作任何处理，方便验证的实现者在未指定 [Sink] 时直接调用。
+func Emit(ctx *web.Context, s Sink, e *Event) {
+	if s == nil {
+		return
+	}
+
+	e.Time = ctx.Begin()
+	e.IP = ctx.ClientIP()
+	e.ID = ctx.ID()
+	s.Emit(e)
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package auth
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/testserver"
+)
+
+func TestEventType_String(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Equal(EventSuccess.String(), "success").
+		Equal(EventFailure.String(), "failure").
+		Equal(EventLogout.String(), "logout").
+		Equal(EventRefresh.String(), "refresh").
+		Equal(EventBlocked.String(), "blocked").
+		Equal(EventImpersonateStart.String(), "impersonate-start").
+		Equal(EventImpersonateStop.String(), "impersonate-stop").
+		Equal(EventRefreshReuse.String(), "refresh-reuse").
+		Equal(EventType(100).String(), "unknown")
+}
+
+func TestNewAsyncSink(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+
+	a.PanicString(func() {
+		NewAsyncSink(s, 0, func(*Event) {})
+	}, "参数 size 必须大于 0")
+
+	var mux sync.Mutex
+	events := make([]*Event, 0, 10)
+	sink := NewAsyncSink(s, 10, func(e *Event) {
+		mux.Lock()
+		defer mux.Unlock()
+		events = append(events, e)
+	})
+
+	r := s.Routers().New("def", nil)
+	r.Get("/login", func(ctx *web.Context) web.Responser {
+		Emit(ctx, sink, &Event{Type: EventFailure, Source: "test", Identity: "u1", Reason: ReasonInvalidCredential})
+		Emit(ctx, nil, &Event{Type: EventFailure}) // 不会发送
+		return web.NoContent()
+	})
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	servertest.Get(a, "http://localhost:8080/login").Do(nil).Status(http.StatusNoContent)
+	time.Sleep(100 * time.Millisecond)
+
+	mux.Lock()
+	defer mux.Unlock()
+	a.Length(events, 1).
+		Equal(events[0].Type, EventFailure).
+		Equal(events[0].Identity, "u1").
+		Equal(events[0].Source, "test").
+		False(events[0].Time.IsZero())
+}
+
+func TestAsyncSink_full(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+
+	block := make(chan struct{})
+	sink := NewAsyncSink(s, 1, func(*Event) { <-block }).(*asyncSink)
+	defer close(block)
+
+	for range 5 {
+		sink.Emit(&Event{Type: EventSuccess})
+	}
+	a.True(sink.dropped.Load() >= 3)
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/issue9/web"
+)
+
+// ProblemReauthenticationRequired 表示需要重新登录的问题类型
+//
+// 由 [Fresh.Require] 返回，状态码为 401。
+const ProblemReauthenticationRequired = "reauthentication-required"
+
+type (
+	// Fresh 要求用户在一定时间内进行过登录
+	//
+	// 对于修改邮箱、删除账号等敏感操作，仅持有有效的令牌是不够的，
+	// 还需要确保用户是在最近进行的登录。
+	//
+	// T 为 [Auth] 中保存的用户信息类型。
+	Fresh[T any] struct {
+		auth      Auth[T]
+		authTime  AuthTimeFunc[T]
+		problem   string
+		challenge bool // 是否输出 WWW-Authenticate 报头
+	}
+
+	// AuthTimeFunc 从用户信息中获取用户登录的时间
+	//
+	// 对于 JWT，一般为 auth_time 字段的值，刷新令牌时应该保持该值不变；
+	// 对于 session，一般为登录时保存在用户数据中的时间。
+	// 如果无法确定登录的时间，应该返回零值。
+	AuthTimeFunc[T any] func(T) time.Time
+)
+
+// NewFresh 声明 [Fresh] 对象
+//
+// a 为用户的登录验证，[Fresh.Require] 从中获取用户信息；
+// f 从用户信息中获取登录的时间；
+//
+// NOTE: 同一个 [web.Server] 只能调用一次，该函数会向 s 注册 [ProblemReauthenticationRequired]。
+func NewFresh[T any](s web.Server, a Auth[T], f AuthTimeFunc[T]) *Fresh[T] {
+	fresh := newFresh(a, f, ProblemReauthenticationRequired, true)
+
+	s.Problems().Add(http.StatusUnauthorized, &web.LocaleProblem{
+		ID:     ProblemReauthenticationRequired,
+		Title:  web.Phrase("reauthentication required"),
+		Detail: web.Phrase("the operation requires a recent authentication"),
+	})
+
+	return fresh
+}
+
+// NewFreshWithProblem 声明以 problem 作为错误的 [Fresh] 对象
+//
+// 与 [NewFresh] 的区别在于，超时时返回的是 problem 且不输出 WWW-Authenticate 报头，
+// problem 需要由调用方自行注册。比如二次验证等，以其它时间作为判断依据的场景。
+func NewFreshWithProblem[T any](a Auth[T], f AuthTimeFunc[T], problem string) *Fresh[T] {
+	if problem == "" {
+		panic("参数 problem 不能为空")
+	}
+	return newFresh(a, f, problem, false)
+}
+
+func newFresh[T any](a Auth[T], f AuthTimeFunc[T], problem string, challenge bool) *Fresh[T] {
+	if a == nil {
+		panic("参数 a 不能为空")
+	}
+	if f == nil {
+		panic("参数 f 不能为空")
+	}
+
+	return &Fresh[T]{auth: a, authTime: f, problem: problem, challenge: challenge}
+}
+
+// Require 要求用户在 maxAge 时间内进行过登录
+//
+// 返回的中间件需要在 [Auth] 的中间件之后执行。
+// 未登录时返回 401，登录时间超过 maxAge 则返回 [ProblemReauthenticationRequired]，
+// 同时按照 [RFC9470] 输出 WWW-Authenticate 报头，告知客户端需要重新登录。
+// 由 [NewFreshWithProblem] 声明的对象则返回其指定的 problem。
+//
+// [RFC9470]: https://datatracker.ietf.org/doc/html/rfc9470
+func (f *Fresh[T]) Require(maxAge time.Duration) web.Middleware {
+	if maxAge <= 0 {
+		panic("参数 maxAge 必须大于 0")
+	}
+	authenticate := `Bearer error="insufficient_user_authentication", max_age=` + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+
+	return web.MiddlewareFunc(func(next web.HandlerFunc) web.HandlerFunc {
+		return func(ctx *web.Context) web.Responser {
+			info, found := f.auth.GetInfo(ctx)
+			if !found {
+				return ctx.Problem(web.ProblemUnauthorized)
+			}
+
+			at := f.authTime(info)
+			if at.IsZero() || ctx.Begin().Sub(at) > maxAge {
+				if f.challenge {
+					ctx.Header().Set("WWW-Authenticate", authenticate)
+				}
+				return ctx.Problem(f.problem)
+			}
+
+			return next(ctx)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+)
+
+var _ Auth[time.Time] = &headerAuth{}
+
+// 以报头 X-Auth-Time 的值作为登录时间
+type headerAuth struct{}
+
+func (a *headerAuth) Middleware(next web.HandlerFunc) web.HandlerFunc {
+	return func(ctx *web.Context) web.Responser {
+		h := ctx.Request().Header.Get("X-Auth-Time")
+		if h == "" {
+			return ctx.Problem(web.ProblemUnauthorized)
+		}
+
+		var t time.Time
+		if h != "0" {
+			d, err := time.ParseDuration(h)
+			if err != nil {
+				return ctx.Error(err, web.ProblemBadRequest)
+			}
+			t = time.Now().Add(-d)
+		}
+		mauth.Set(ctx, a, t)
+		return next(ctx)
+	}
+}
+
+func (a *headerAuth) Logout(*web.Context) error { return nil }
+
+func (a *headerAuth) GetInfo(ctx *web.Context) (time.Time, bool) { return mauth.Get[time.Time](ctx, a) }
+
+func TestFresh(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	au := &headerAuth{}
+	f := NewFresh(s, au, func(t time.Time) time.Time { return t })
+
+	a.PanicString(func() {
+		f.Require(0)
+	}, "参数 maxAge 必须大于 0")
+
+	r := s.Routers().New("def", nil)
+	r.Delete("/account", au.Middleware(f.Require(10*time.Minute).Middleware(func(*web.Context) web.Responser {
+		return web.NoContent()
+	})))
+	r.Get("/info", f.Require(time.Minute).Middleware(func(*web.Context) web.Responser {
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	servertest.Delete(a, "http://localhost:8080/account").
+		Header("X-Auth-Time", "1m").
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	servertest.Delete(a, "http://localhost:8080/account").
+		Header("X-Auth-Time", "1h").
+		Do(nil).
+		Status(http.StatusUnauthorized).
+		Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication", max_age=600`).
+		BodyFunc(func(a *assert.Assertion, body []byte) {
+			a.Contains(string(body), ProblemReauthenticationRequired)
+		})
+
+	// 无法确定登录时间
+	servertest.Delete(a, "http://localhost:8080/account").
+		Header("X-Auth-Time", "0").
+		Do(nil).
+		Status(http.StatusUnauthorized).
+		BodyFunc(func(a *assert.Assertion, body []byte) {
+			a.Contains(string(body), ProblemReauthenticationRequired)
+		})
+
+	// 未登录
+	servertest.Get(a, "http://localhost:8080/info").
+		Do(nil).
+		Status(http.StatusUnauthorized).
+		NotHeader("WWW-Authenticate", `Bearer error="insufficient_user_authentication", max_age=60`)
+}
+
+func TestNewFreshWithProblem(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	au := &headerAuth{}
+	s.Problems().Add(http.StatusForbidden, &web.LocaleProblem{ID: "fresh", Title: web.Phrase("fresh"), Detail: web.Phrase("fresh")})
+
+	a.PanicString(func() {
+		NewFreshWithProblem(au, func(t time.Time) time.Time { return t }, "")
+	}, "参数 problem 不能为空")
+	a.PanicString(func() {
+		NewFreshWithProblem(nil, func(t time.Time) time.Time { return t }, "fresh")
+	}, "参数 a 不能为空")
+	a.PanicString(func() {
+		NewFreshWithProblem[time.Time](au, nil, "fresh")
+	}, "参数 f 不能为空")
+
+	f := NewFreshWithProblem(au, func(t time.Time) time.Time { return t }, "fresh")
+	r := s.Routers().New("def", nil)
+	r.Delete("/account", au.Middleware(f.Require(10*time.Minute).Middleware(func(*web.Context) web.Responser {
+		return web.NoContent()
+	})))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	servertest.Delete(a, "http://localhost:8080/account").
+		Header("X-Auth-Time", "1m").
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	servertest.Delete(a, "http://localhost:8080/account").
+		Header("X-Auth-Time", "1h").
+		Do(nil).
+		Status(http.StatusForbidden).
+		Header("WWW-Authenticate", "")
+}
@@ -0,0 +1,269 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package impersonate 以其它用户的身份进行操作
+//
+// 在 [auth.Auth] 之上提供了管理员以其它用户身份进行操作的功能：
+//
+//	i := impersonate.New(srv, "impersonate_", sess, time.Hour, idFunc, loadFunc, allowFunc, nil)
+//	srv.Routers().Use(i)
+//
+//	r.Post("/impersonate/{id}", func(ctx *web.Context) web.Responser {
+//	    if err := i.Start(ctx, id); err != nil {...}
+//	    ...
+//	})
+//
+//	r.Get("/profile", func(ctx *web.Context) web.Responser {
+//	    user, _ := i.GetInfo(ctx) // 被模拟的用户
+//	    admin, _ := i.Actor(ctx)  // 实际的操作者
+//	})
+//
+// 对于 JWT 等无状态的验证方式，也可以由签发的令牌携带实际操作者的信息，
+// 只要用户数据实现了 [Actor] 接口即可，比如 jwt.UserClaims 或是嵌入了 jwt.Act 的 Claims 对象。
+package impersonate
+
+import (
+	"errors"
+	"time"
+
+	"github.com/issue9/cache"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+var (
+	errNotAllowed    = web.NewLocaleError("not allowed to impersonate the user")
+	errImpersonating = web.NewLocaleError("already impersonating other user")
+	errUserNotFound  = web.NewLocaleError("impersonated user not found")
+)
+
+type (
+	// Impersonate 以其它用户的身份进行操作
+	//
+	// 模拟的状态以实际操作者的标识保存在缓存中，
+	// 即同一操作者的所有登录凭证都会处于相同的模拟状态。
+	//
+	// 实现了 [auth.Auth] 接口，[Impersonate.GetInfo] 返回的是被模拟的用户，
+	// 实际的操作者可通过 [Impersonate.Actor] 获取。
+	Impersonate[T any] struct {
+		auth  auth.Auth[T]
+		cache web.Cache
+		ttl   time.Duration
+		id    IDFunc[T]
+		load  LoadFunc[T]
+		allow AllowFunc[T]
+		sink  auth.Sink
+	}
+
+	// IDFunc 获取用户的唯一标识
+	IDFunc[T any] func(T) string
+
+	// LoadFunc 根据唯一标识加载用户数据
+	LoadFunc[T any] func(id string) (v T, found bool, err error)
+
+	// AllowFunc 判断 actor 是否允许以 target 的身份进行操作
+	AllowFunc[T any] func(actor, target T) bool
+
+	// 保存在 [web.Context] 中的实际操作者和被模拟的用户，以 owner 区分不同的 [Impersonate] 对象。
+	actorSlot  struct{ owner any }
+	targetSlot struct{ owner any }
+
+	// Actor 由用户数据本身携带实际操作者的信息
+	//
+	// 比如 JWT 的 act 声明，这种情况下用户数据即为被模拟的用户。
+	Actor interface {
+		// ActorID 实际操作者的唯一标识
+		//
+		// 返回空值表示未处于模拟状态。
+		ActorID() string
+	}
+)
+
+func ErrNotAllowed() error { return errNotAllowed }
+
+func ErrImpersonating() error { return errImpersonating }
+
+func ErrUserNotFound() error { return errUserNotFound }
+
+// New 声明 [Impersonate] 对象
+//
+// prefix 为缓存中的前缀，模拟状态保存在缓存中；
+// a 为实际的登录验证；
+// ttl 为模拟状态的最长时间；
+// id 获取用户的唯一标识；
+// load 根据唯一标识加载用户数据；
+// allow 判断是否允许模拟指定的用户；
+// sink 用于接收开始和结束模拟的事件，可以为空；
+func New[T any](s web.Server, prefix string, a auth.Auth[T], ttl time.Duration, id IDFunc[T], load LoadFunc[T], allow AllowFunc[T], sink auth.Sink) *Impersonate[T] {
+	if a == nil {
+		panic("参数 a 不能为空")
+	}
+	if id == nil {
+		panic("参数 id 不能为空")
+	}
+	if load == nil {
+		panic("参数 load 不能为空")
+	}
+	if allow == nil {
+		panic("参数 allow 不能为空")
+	}
+
+	return &Impersonate[T]{
+		auth:  a,
+		cache: web.NewCache(prefix, s.Cache()),
+		ttl:   ttl,
+		id:    id,
+		load:  load,
+		allow: allow,
+		sink:  sink,
+	}
+}
+
+// Middleware 在 [auth.Auth] 验证通过之后，判断是否处于模拟状态
+//
+// 处于模拟状态的每个请求都会记录一条 INFO 日志，同时可以通过 [Impersonate.Impersonated] 进行判断。
+// 每个请求都会重新通过 allow 判断是否依然允许模拟，对于由令牌携带操作者的情况，不再允许时返回 403，
+// 否则退出模拟状态，以实际操作者的身份继续。
+func (i *Impersonate[T]) Middleware(next web.HandlerFunc) web.HandlerFunc {
+	return i.auth.Middleware(func(ctx *web.Context) web.Responser {
+		info, found := i.auth.GetInfo(ctx)
+		if !found {
+			return next(ctx)
+		}
+
+		var actor, target T
+		if a, ok := any(info).(Actor); ok && a.ActorID() != "" { // 由令牌携带操作者
+			v, found, err := i.load(a.ActorID())
+			if err != nil {
+				return ctx.Error(err, web.ProblemInternalServerError)
+			}
+			if !found {
+				ctx.Logs().DEBUG().Error(ErrUserNotFound())
+				return ctx.Problem(web.ProblemUnauthorized)
+			}
+			if !i.allow(v, info) {
+				ctx.Logs().DEBUG().Error(ErrNotAllowed())
+				return ctx.Problem(web.ProblemForbidden)
+			}
+			actor, target = v, info
+		} else {
+			var targetID string
+			if err := i.cache.Get(i.id(info), &targetID); errors.Is(err, cache.ErrCacheMiss()) {
+				return next(ctx)
+			} else if err != nil {
+				return ctx.Error(err, web.ProblemInternalServerError)
+			}
+
+			v, found, err := i.load(targetID)
+			if err != nil {
+				return ctx.Error(err, web.ProblemInternalServerError)
+			}
+			if !found || !i.allow(info, v) { // 被模拟的用户已经不存在或是不再允许模拟，退出模拟状态。
+				if err := i.cache.Delete(i.id(info)); err != nil {
+					ctx.Logs().ERROR().Error(err)
+				}
+				return next(ctx)
+			}
+			actor, target = info, v
+		}
+
+		ctx.SetVar(actorSlot{i}, actor)
+		ctx.SetVar(targetSlot{i}, target)
+		ctx.Logs().INFO().LocaleString(web.Phrase("%s is acting as %s", i.id(actor), i.id(target)))
+
+		return next(ctx)
+	})
+}
+
+// Start 开始以 target 的身份进行操作
+//
+// 当前用户必须已经通过验证，且未处于模拟状态。
+func (i *Impersonate[T]) Start(ctx *web.Context, target string) error {
+	if i.Impersonated(ctx) {
+		return ErrImpersonating()
+	}
+
+	actor, found := i.auth.GetInfo(ctx)
+	if !found {
+		return ErrNotAllowed()
+	}
+
+	t, found, err := i.load(target)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound()
+	}
+
+	if !i.allow(actor, t) {
+		return ErrNotAllowed()
+	}
+
+	if err := i.cache.Set(i.id(actor), target, i.ttl); err != nil {
+		return err
+	}
+
+	ctx.SetVar(actorSlot{i}, actor)
+	ctx.SetVar(targetSlot{i}, t)
+	auth.Emit(ctx, i.sink, &auth.Event{Type: auth.EventImpersonateStart, Source: "impersonate", Identity: i.id(actor), Info: t})
+	return nil
+}
+
+// Stop 结束模拟状态
+//
+// 对于由令牌携带操作者的情况，需要由调用方重新签发令牌。
+func (i *Impersonate[T]) Stop(ctx *web.Context) error {
+	actor, found := i.Actor(ctx)
+	if !found {
+		return nil
+	}
+	target, _ := i.GetInfo(ctx)
+
+	if err := i.cache.Delete(i.id(actor)); err != nil && !errors.Is(err, cache.ErrCacheMiss()) {
+		return err
+	}
+
+	ctx.DelVar(actorSlot{i})
+	ctx.DelVar(targetSlot{i})
+	auth.Emit(ctx, i.sink, &auth.Event{Type: auth.EventImpersonateStop, Source: "impersonate", Identity: i.id(actor), Info: target})
+	return nil
+}
+
+// Logout 结束模拟状态并退出登录
+func (i *Impersonate[T]) Logout(ctx *web.Context) error {
+	if err := i.Stop(ctx); err != nil {
+		return err
+	}
+	return i.auth.Logout(ctx)
+}
+
+// GetInfo 获取用户数据
+//
+// 处于模拟状态时返回被模拟的用户，否则与 [auth.Auth.GetInfo] 相同。
+func (i *Impersonate[T]) GetInfo(ctx *web.Context) (T, bool) {
+	if v, found := ctx.GetVar(targetSlot{i}); found {
+		return v.(T), true
+	}
+	return i.auth.GetInfo(ctx)
+}
+
+// Actor 获取实际的操作者
+//
+// 未处于模拟状态时返回 false。
+func (i *Impersonate[T]) Actor(ctx *web.Context) (T, bool) {
+	if v, found := ctx.GetVar(actorSlot{i}); found {
+		return v.(T), true
+	}
+
+	var zero T
+	return zero, false
+}
+
+// Impersonated 当前请求是否处于模拟状态
+func (i *Impersonate[T]) Impersonated(ctx *web.Context) bool {
+	_, found := ctx.GetVar(actorSlot{i})
+	return found
+}
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package impersonate
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	xjwt "github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+	"github.com/issue9/webuse/v7/middlewares/auth/basic"
+	"github.com/issue9/webuse/v7/middlewares/auth/jwt"
+)
+
+var (
+	_ auth.Auth[string] = &Impersonate[string]{}
+	_ Actor             = &jwt.UserClaims[string, struct{}]{}
+)
+
+var users = map[string]bool{"admin": true, "alice": true, "bob": true}
+
+func load(id string) (string, bool, error) { return id, users[id], nil }
+
+func allow(actor, target string) bool { return actor == "admin" && target != "admin" }
+
+func TestImpersonate(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := basic.New(s, func(username, password []byte) (string, bool) {
+		return string(username), users[string(username)]
+	}, "example.com", false)
+
+	events := make([]*auth.Event, 0, 10)
+	var revoked bool // 收回模拟的权限
+	i := New(s, "impersonate_", b, time.Hour, func(v string) string { return v }, load, func(actor, target string) bool {
+		return !revoked && allow(actor, target)
+	}, auth.SinkFunc(func(e *auth.Event) {
+		events = append(events, e)
+	}))
+
+	r := s.Routers().New("def", nil)
+	r.Use(i)
+	r.Post("/impersonate", func(ctx *web.Context) web.Responser {
+		switch err := i.Start(ctx, ctx.Request().URL.Query().Get("id")); {
+		case err == ErrNotAllowed():
+			return ctx.Problem(web.ProblemForbidden)
+		case err == ErrUserNotFound():
+			return ctx.Problem(web.ProblemNotFound)
+		case err == ErrImpersonating():
+			return ctx.Problem(web.ProblemConflict)
+		case err != nil:
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+		return web.NoContent()
+	})
+	r.Delete("/impersonate", func(ctx *web.Context) web.Responser {
+		if err := i.Stop(ctx); err != nil {
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+		return web.NoContent()
+	})
+	r.Get("/info", func(ctx *web.Context) web.Responser {
+		info, _ := i.GetInfo(ctx)
+		actor, _ := i.Actor(ctx)
+		return web.OK(map[string]any{"info": info, "actor": actor, "impersonated": i.Impersonated(ctx)})
+	})
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	const (
+		admin = "Basic YWRtaW46MTIz" // admin:123
+		alice = "Basic YWxpY2U6MTIz" // alice:123
+	)
+
+	info := func(a *assert.Assertion, h string, want map[string]any) {
+		servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, h).
+			Do(nil).
+			Status(http.StatusOK).
+			BodyFunc(func(a *assert.Assertion, body []byte) {
+				m := map[string]any{}
+				a.NotError(json.Unmarshal(body, &m)).Equal(m, want)
+			})
+	}
+
+	info(a, admin, map[string]any{"info": "admin", "actor": "", "impersonated": false})
+
+	// 普通用户无权模拟
+	servertest.Post(a, "http://localhost:8080/impersonate?id=bob", nil).
+		Header(mauth.AuthorizationHeader, alice).
+		Do(nil).
+		Status(http.StatusForbidden)
+
+	// 用户不存在
+	servertest.Post(a, "http://localhost:8080/impersonate?id=not-exists", nil).
+		Header(mauth.AuthorizationHeader, admin).
+		Do(nil).
+		Status(http.StatusNotFound)
+
+	servertest.Post(a, "http://localhost:8080/impersonate?id=alice", nil).
+		Header(mauth.AuthorizationHeader, admin).
+		Do(nil).
+		Status(http.StatusNoContent)
+	info(a, admin, map[string]any{"info": "alice", "actor": "admin", "impersonated": true})
+	info(a, alice, map[string]any{"info": "alice", "actor": "", "impersonated": false}) // 不影响 alice 本身
+
+	// 已经处于模拟状态
+	servertest.Post(a, "http://localhost:8080/impersonate?id=bob", nil).
+		Header(mauth.AuthorizationHeader, admin).
+		Do(nil).
+		Status(http.StatusConflict)
+
+	servertest.Delete(a, "http://localhost:8080/impersonate").
+		Header(mauth.AuthorizationHeader, admin).
+		Do(nil).
+		Status(http.StatusNoContent)
+	info(a, admin, map[string]any{"info": "admin", "actor": "", "impersonated": false})
+
+	a.Length(events, 2).
+		Equal(events[0].Type, auth.EventImpersonateStart).
+		Equal(events[0].Identity, "admin").
+		Equal(events[0].Info, "alice").
+		Equal(events[1].Type, auth.EventImpersonateStop)
+
+	// 收回权限之后退出模拟状态
+	servertest.Post(a, "http://localhost:8080/impersonate?id=bob", nil).
+		Header(mauth.AuthorizationHeader, admin).
+		Do(nil).
+		Status(http.StatusNoContent)
+	info(a, admin, map[string]any{"info": "bob", "actor": "admin", "impersonated": true})
+	revoked = true
+	info(a, admin, map[string]any{"info": "admin", "actor": "", "impersonated": false})
+	revoked = false
+	info(a, admin, map[string]any{"info": "admin", "actor": "", "impersonated": false})
+}
+
+type claims struct {
+	xjwt.RegisteredClaims
+	*jwt.Act `json:"act,omitempty"`
+}
+
+func (c *claims) BaseToken() string { return "" }
+
+func (c *claims) BuildRefresh(string, *web.Context) jwt.Claims { return nil }
+
+func TestImpersonate_act(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	j := jwt.New(jwt.NewCacheBlocker[*claims](s, "jwt_", time.Hour, 0), func() *claims { return &claims{} }, time.Hour, 0, nil)
+	j.AddHMAC("hmac", xjwt.SigningMethodHS256, []byte("secret"))
+
+	i := New(s, "impersonate_", j, time.Hour, func(c *claims) string { return c.Subject }, func(id string) (*claims, bool, error) {
+		return &claims{RegisteredClaims: xjwt.RegisteredClaims{Subject: id}}, users[id], nil
+	}, func(actor, target *claims) bool { return allow(actor.Subject, target.Subject) }, nil)
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", i.Middleware(func(ctx *web.Context) web.Responser {
+		info, _ := i.GetInfo(ctx)
+		actor, found := i.Actor(ctx)
+		if !found {
+			return web.OK([]string{info.Subject})
+		}
+		return web.OK([]string{info.Subject, actor.Subject})
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	token, err := j.Sign(&claims{
+		RegisteredClaims: xjwt.RegisteredClaims{Subject: "alice"},
+		Act:              &jwt.Act{Sub: "admin"},
+	})
+	a.NotError(err)
+
+	// 令牌中包含 act 声明
+	_, parts, err := xjwt.NewParser().ParseUnverified(token, &claims{})
+	a.NotError(err)
+	payload, err := xjwt.NewParser().DecodeSegment(parts[1])
+	a.NotError(err).Contains(string(payload), `"act":{"sub":"admin"}`)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusOK).
+		StringBody(`["alice","admin"]`)
+
+	token, err = j.Sign(&claims{RegisteredClaims: xjwt.RegisteredClaims{Subject: "bob"}})
+	a.NotError(err)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusOK).
+		StringBody(`["bob"]`)
+
+	// 不允许模拟的用户
+	token, err = j.Sign(&claims{
+		RegisteredClaims: xjwt.RegisteredClaims{Subject: "admin"},
+		Act:              &jwt.Act{Sub: "alice"},
+	})
+	a.NotError(err)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusForbidden)
+
+	// 操作者不存在
+	token, err = j.Sign(&claims{
+		RegisteredClaims: xjwt.RegisteredClaims{Subject: "alice"},
+		Act:              &jwt.Act{Sub: "not-exists"},
+	})
+	a.NotError(err)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+}
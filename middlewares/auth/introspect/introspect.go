@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package introspect 通过 [Token Introspection] 验证不透明令牌
+//
+// [Token Introspection]: https://datatracker.ietf.org/doc/html/rfc7662
+package introspect
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/issue9/cache"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+const (
+	prefix      = "bearer "
+	blockPrefix = "blocked_" // 已经退出登录的令牌
+
+	clientTimeout = 10 * time.Second // 默认客户端的超时时间
+	maxBodySize   = 1 << 20          // 内省接口返回内容的最大长度
+)
+
+type (
+	// Response 内省接口的返回数据
+	Response = auth.IntrospectionResponse
+
+	// BuildInfoFunc 将内省接口的返回数据转换为 T
+	//
+	// 仅在令牌处于活动状态时才会调用。如果返回错误，该令牌将被拒绝。
+	BuildInfoFunc[T any] func(*Response) (T, error)
+
+	introspect[T any] struct {
+		client   *http.Client
+		endpoint string
+		id       string
+		secret   string
+		cache    web.Cache
+		ttl      time.Duration
+		build    BuildInfoFunc[T]
+	}
+)
+
+// New 声明基于令牌内省的验证中间件
+//
+// prefix 为缓存中的前缀，内省结果和退出登录的令牌均保存在缓存中；
+// client 访问内省接口的客户端，为空表示采用超时时间为 10 秒的默认客户端；
+// endpoint 内省接口的地址；
+// id 和 secret 为访问内省接口时的客户端凭证，以 Basic 验证的方式提交，id 为空表示不需要验证；
+// ttl 为内省结果的缓存时间，活动的令牌最多缓存至其过期时间；
+// build 将内省结果转换为 T；
+//
+// 任何错误（包括内省接口无法访问）都会拒绝请求。
+func New[T any](s web.Server, prefix string, client *http.Client, endpoint, id, secret string, ttl time.Duration, build BuildInfoFunc[T]) auth.Auth[T] {
+	if build == nil {
+		panic("参数 build 不能为空")
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: clientTimeout}
+	}
+
+	return &introspect[T]{
+		client:   client,
+		endpoint: endpoint,
+		id:       id,
+		secret:   secret,
+		cache:    web.NewCache(prefix, s.Cache()),
+		ttl:      ttl,
+		build:    build,
+	}
+}
+
+func (i *introspect[T]) Middleware(next web.HandlerFunc) web.HandlerFunc {
+	return func(ctx *web.Context) web.Responser {
+		token := auth.GetToken(ctx, prefix, mauth.AuthorizationHeader)
+		if token == "" || i.cache.Exists(blockPrefix+cacheKey(token)) {
+			return i.unauthorized(ctx)
+		}
+
+		resp, err := i.introspect(ctx, token)
+		if err != nil {
+			ctx.Logs().ERROR().Error(err)
+			return i.unauthorized(ctx)
+		}
+		if !resp.Active {
+			return i.unauthorized(ctx)
+		}
+
+		v, err := i.build(resp)
+		if err != nil {
+			ctx.Logs().DEBUG().Error(err)
+			return i.unauthorized(ctx)
+		}
+
+		mauth.Set(ctx, i, v)
+		return next(ctx)
+	}
+}
+
+func (i *introspect[T]) unauthorized(ctx *web.Context) web.Responser {
+	ctx.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	return ctx.Problem(web.ProblemUnauthorized)
+}
+
+// 获取令牌的内省结果，优先从缓存中读取。
+func (i *introspect[T]) introspect(ctx *web.Context, token string) (*Response, error) {
+	now := ctx.Begin()
+	key := cacheKey(token)
+
+	var raw []byte
+	cached := true
+	err := i.cache.Get(key, &raw)
+	switch {
+	case errors.Is(err, cache.ErrCacheMiss()):
+		cached = false
+		if raw, err = i.request(ctx, token); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	resp := &Response{Raw: raw}
+	if err := json.Unmarshal(raw, resp); err != nil {
+		return nil, err
+	}
+
+	// 由于缓存的存在，需要再次确认令牌的时间。
+	if resp.Active && (resp.Exp > 0 && resp.Exp <= now.Unix() || resp.Nbf > now.Unix()) {
+		resp.Active = false
+	}
+
+	if cached {
+		return resp, nil
+	}
+
+	ttl := i.ttl
+	if resp.Active && resp.Exp > 0 {
+		ttl = min(ttl, time.Unix(resp.Exp, 0).Sub(now))
+	}
+	if ttl > 0 {
+		if err := i.cache.Set(key, raw, ttl); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (i *introspect[T]) request(ctx *web.Context, token string) ([]byte, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequestWithContext(ctx.Request().Context(), http.MethodPost, i.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.id != "" {
+		req.SetBasicAuth(url.QueryEscape(i.id), url.QueryEscape(i.secret))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, web.NewLocaleError("request %s return status %d", i.endpoint, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+}
+
+// Logout 退出登录
+//
+// 令牌会被记录在本地的黑名单中直至其过期，没有 exp 的令牌则记录 ttl 的时长。
+// 这仅对当前服务有效，令牌本身的吊销需要由签发方完成。
+func (i *introspect[T]) Logout(ctx *web.Context) error {
+	token := auth.GetToken(ctx, prefix, mauth.AuthorizationHeader)
+	if token == "" {
+		return nil
+	}
+
+	resp, err := i.introspect(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	key := cacheKey(token)
+	if resp.Active {
+		ttl := i.ttl
+		if resp.Exp > 0 {
+			ttl = time.Unix(resp.Exp, 0).Sub(ctx.Begin())
+		}
+		if ttl > 0 {
+			if err := i.cache.Set(blockPrefix+key, true, ttl); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := i.cache.Delete(key); err != nil && !errors.Is(err, cache.ErrCacheMiss()) {
+		return err
+	}
+	return nil
+}
+
+func (i *introspect[T]) GetInfo(ctx *web.Context) (T, bool) { return mauth.Get[T](ctx, i) }
+
+// 不直接以令牌作为缓存的键名，防止令牌通过缓存泄露。
+func cacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
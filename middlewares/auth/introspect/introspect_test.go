@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package introspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/mux/v7/types"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+var _ auth.Auth[string] = &introspect[string]{}
+
+func TestIntrospect(t *testing.T) {
+	a := assert.New(t, false)
+
+	var count atomic.Int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+
+		if id, secret, ok := r.BasicAuth(); !ok || id != "rs" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		now := time.Now()
+		switch r.FormValue("token") {
+		case "active", "active2":
+			json.NewEncoder(w).Encode(map[string]any{"active": true, "sub": "u1", "aud": "api", "exp": now.Add(time.Hour).Unix(), "tenant": "t1"})
+		case "expired":
+			json.NewEncoder(w).Encode(map[string]any{"active": true, "sub": "u1", "exp": now.Add(-time.Minute).Unix()})
+		case "other":
+			json.NewEncoder(w).Encode(map[string]any{"active": true, "sub": "u2"})
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"active": false})
+		}
+	}))
+	defer stub.Close()
+
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	a.PanicString(func() {
+		New[string](s, "introspect_", nil, stub.URL, "rs", "secret", time.Minute, nil)
+	}, "参数 build 不能为空")
+
+	i := New(s, "introspect_", nil, stub.URL, "rs", "secret", time.Minute, func(resp *Response) (string, error) {
+		if resp.Sub == "u2" {
+			return "", errors.New("u2")
+		}
+
+		ext := struct {
+			Tenant string `json:"tenant"`
+		}{}
+		if err := json.Unmarshal(resp.Raw, &ext); err != nil {
+			return "", err
+		}
+		return resp.Sub + "@" + ext.Tenant + "@" + resp.Aud[0], nil
+	})
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", i.Middleware(func(ctx *web.Context) web.Responser {
+		v, found := i.GetInfo(ctx)
+		a.True(found)
+		return web.OK(v)
+	}))
+	r.Delete("/info", i.Middleware(func(ctx *web.Context) web.Responser {
+		a.NotError(i.Logout(ctx))
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Do(nil).
+		Status(http.StatusUnauthorized).
+		Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	a.Equal(count.Load(), 0)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer active").
+		Do(nil).
+		Status(http.StatusOK).
+		StringBody(`"u1@t1@api"`)
+	a.Equal(count.Load(), 1)
+
+	// 缓存
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer active").
+		Do(nil).
+		Status(http.StatusOK)
+	a.Equal(count.Load(), 1)
+
+	// Logout 之后令牌在本地失效
+	servertest.Delete(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer active").
+		Do(nil).
+		Status(http.StatusNoContent)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer active").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+	a.Equal(count.Load(), 1)
+
+	// 其它令牌不受影响
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer active2").
+		Do(nil).
+		Status(http.StatusOK)
+	a.Equal(count.Load(), 2)
+
+	// 非活动状态的令牌同样会被缓存
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer inactive").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer inactive").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+	a.Equal(count.Load(), 3)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer expired").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	// build 返回错误
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer other").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	// 内省接口出错
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer error").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+}
+
+func TestNew_unauthorizedClient(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer stub.Close()
+
+	i := New(s, "introspect_", nil, stub.URL, "", "", time.Minute, func(resp *Response) (string, error) { return resp.Sub, nil }).(*introspect[string])
+	ctx := s.NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/path", nil), types.NewContext())
+	resp, err := i.introspect(ctx, "active")
+	a.Error(err).Nil(resp)
+}
+
+func TestIntrospect_request(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active":true,"sub":"`))
+		w.Write(bytes.Repeat([]byte("x"), maxBodySize)) // 超过长度限制的内容会被截断
+		w.Write([]byte(`"}`))
+	}))
+	defer stub.Close()
+
+	i := New(s, "introspect_", nil, stub.URL, "", "", time.Minute, func(resp *Response) (string, error) { return resp.Sub, nil }).(*introspect[string])
+	a.Equal(i.client.Timeout, clientTimeout)
+
+	ctx := s.NewContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/path", nil), types.NewContext())
+	resp, err := i.introspect(ctx, "active")
+	a.Error(err).Nil(resp)
+
+	// 请求被取消
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/path", nil).WithContext(c)
+	ctx = s.NewContext(httptest.NewRecorder(), r, types.NewContext())
+	_, err = i.request(ctx, "active")
+	a.ErrorIs(err, context.Canceled)
+}
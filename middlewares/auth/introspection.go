@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package auth
+
+import (
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IntrospectionResponse [Token Introspection] 接口的返回数据
+//
+// 仅包含了 RFC7662 中定义的字段，其它字段可通过 Raw 自行解析。
+// 由签发令牌的服务端返回，也由验证不透明令牌的客户端解析。
+//
+// [Token Introspection]: https://datatracker.ietf.org/doc/html/rfc7662
+type IntrospectionResponse struct {
+	Active    bool             `json:"active"`
+	Scope     string           `json:"scope,omitempty"`
+	ClientID  string           `json:"client_id,omitempty"`
+	Username  string           `json:"username,omitempty"`
+	TokenType string           `json:"token_type,omitempty"`
+	Exp       int64            `json:"exp,omitempty"`
+	Iat       int64            `json:"iat,omitempty"`
+	Nbf       int64            `json:"nbf,omitempty"`
+	Sub       string           `json:"sub,omitempty"`
+	Aud       jwt.ClaimStrings `json:"aud,omitempty"`
+	Iss       string           `json:"iss,omitempty"`
+	Jti       string           `json:"jti,omitempty"`
+
+	Raw json.RawMessage `json:"-"` // 原始的返回内容
+}
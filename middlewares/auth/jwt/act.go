@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+// Act 令牌中的 act 声明
+//
+// 表示令牌的实际操作者，比如管理员以其它用户的身份进行操作时，
+// sub 为被模拟的用户，而 act 则为管理员。[UserClaims] 已经包含了此声明，
+// 自定义的 [Claims] 可通过嵌入的方式添加：
+//
+//	type Claims struct {
+//	    jwt.RegisteredClaims
+//	    *jwt.Act `json:"act,omitempty"`
+//	}
+//
+// https://datatracker.ietf.org/doc/html/rfc8693#section-4.1
+type Act struct {
+	Sub string `json:"sub"`
+
+	// 之前的操作者
+	//
+	// 当操作者本身也处于模拟状态时，由此字段组成操作链。
+	Act *Act `json:"act,omitempty"`
+}
+
+// ActorID 返回实际操作者的标识
+//
+// 如果 a 为空，返回空字符串。
+func (a *Act) ActorID() string {
+	if a == nil {
+		return ""
+	}
+	return a.Sub
+}
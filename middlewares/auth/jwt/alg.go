@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+)
+
+var algNone = jwt.SigningMethodNone.Alg()
+
+// 返回 alg 对应的签名算法
+//
+// k 为验证用的公钥或是 HMAC 的密钥，如果 k 无法用于 alg 算法，则返回 nil。
+func methodForKey(alg string, k any) SigningMethod {
+	var ok bool
+	switch m := jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodHMAC:
+		_, ok = k.([]byte)
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = k.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		p, isEC := k.(*ecdsa.PublicKey)
+		ok = isEC && p.Curve.Params().BitSize == m.CurveBits
+	case *jwt.SigningMethodEd25519:
+		_, ok = k.(ed25519.PublicKey)
+	}
+
+	if !ok {
+		return nil
+	}
+	return jwt.GetSigningMethod(alg)
+}
+
+// 根据令牌报头中的 alg 返回验证用的签名算法
+//
+// 未设置允许列表时，仅接受 none 和添加密钥时指定的算法，
+// 其中 none 为 [Signer] 在非兼容模式下签发的令牌，以 kid 对应的算法为准。
+// 返回 nil 表示不接受该算法。
+func (k *key) method(alg string) SigningMethod {
+	if len(k.algs) == 0 {
+		if alg == algNone || alg == k.sign.Alg() {
+			return k.sign
+		}
+		return nil
+	}
+
+	switch {
+	case !slices.Contains(k.algs, alg):
+		return nil
+	case alg == algNone:
+		return k.sign
+	default:
+		return jwt.GetSigningMethod(alg) // 已经在 SetAlgs 中验证
+	}
+}
+
+// SetInterop 是否以兼容模式签发令牌
+//
+// 默认情况下令牌报头中的 alg 始终为 none，以隐藏实际采用的算法，但这会导致第三方的库无法验证令牌。
+// 兼容模式下会输出实际的 alg 值。
+//
+// NOTE: 应该在签发令牌之前调用。
+func (s *Signer) SetInterop(interop bool) { s.interop = interop }
+
+// SetAlgs 设置密钥 id 允许的 alg 报头
+//
+// 令牌报头中的 alg 必须在 algs 之中，且以 alg 对应的算法进行验证，否则验证失败。
+// 其中 none 表示接受由 [Signer] 在非兼容模式下签发的令牌，此时以添加密钥时指定的算法为准。
+// algs 为空表示恢复默认值，即仅接受 none 和添加密钥时指定的算法。
+//
+// 如果 algs 中的算法无法与密钥配合使用，将返回错误。
+func (j *Verifier[T]) SetAlgs(id string, algs ...string) error {
+	j.keysMux.Lock()
+	defer j.keysMux.Unlock()
+
+	index := slices.IndexFunc(j.keys, func(e *key) bool { return e.id == id })
+	if index < 0 {
+		return errKeyNotFound(id)
+	}
+
+	k := *j.keys[index] // 复制一份，防止与正在进行的验证产生竞争。
+	for _, alg := range algs {
+		if alg != algNone && methodForKey(alg, k.key) == nil {
+			return web.NewLocaleError("jwt key %s does not support alg %s", id, alg)
+		}
+	}
+	k.algs = slices.Clone(algs)
+	j.keys[index] = &k
+	return nil
+}
+
+// SetInterop 是否以兼容模式签发令牌
+//
+// 参考 [Signer.SetInterop]。
+func (j *JWT[T]) SetInterop(interop bool) { j.s.SetInterop(interop) }
+
+// SetAlgs 设置密钥 id 允许的 alg 报头
+//
+// 参考 [Verifier.SetAlgs]。
+func (j *JWT[T]) SetAlgs(id string, algs ...string) error { return j.v.SetAlgs(id, algs...) }
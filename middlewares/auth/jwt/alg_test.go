@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+)
+
+func TestMethodForKey(t *testing.T) {
+	a := assert.New(t, false)
+	v := NewVerifier[*testClaims](nil, nil)
+	v.AddFromFS("rsa", jwt.SigningMethodRS256, os.DirFS("./testdata"), "rsa-public.pem")
+	v.AddFromFS("ec", jwt.SigningMethodES256, os.DirFS("./testdata"), "ec256-public.pem")
+	v.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	rsaKey, ecKey, hmacKey := v.findKey("rsa").key, v.findKey("ec").key, v.findKey("hmac").key
+
+	a.Equal(methodForKey("RS256", rsaKey), jwt.SigningMethodRS256).
+		Equal(methodForKey("PS512", rsaKey), jwt.SigningMethodPS512).
+		Equal(methodForKey("ES256", ecKey), jwt.SigningMethodES256).
+		Equal(methodForKey("HS384", hmacKey), jwt.SigningMethodHS384).
+		Nil(methodForKey("ES384", ecKey)).
+		Nil(methodForKey("HS256", rsaKey)).
+		Nil(methodForKey("none", hmacKey)).
+		Nil(methodForKey("not-exists", hmacKey))
+}
+
+func TestVerifier_SetAlgs(t *testing.T) {
+	a := assert.New(t, false)
+	s, j := newJWT(a, time.Hour, 2*time.Hour)
+	fsys := os.DirFS("./testdata")
+	pub, pvt := readFile(a, fsys, "rsa-public.pem", "rsa-private.pem")
+	j.AddRSA("rsa", jwt.SigningMethodRS256, pub, pvt)
+	rsaKey := j.s.findKey("rsa").key
+
+	a.Error(j.SetAlgs("not-exists", "RS256")).
+		Error(j.SetAlgs("rsa", "ES256")).
+		Error(j.SetAlgs("rsa", "HS256"))
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", j.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	get := func(token string, status int) {
+		a.TB().Helper()
+		servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, "Bearer "+token).
+			Do(nil).
+			Status(status)
+	}
+
+	sign := func(m SigningMethod, k any) string {
+		a.TB().Helper()
+		token := jwt.NewWithClaims(m, &testClaims{ID: 1})
+		token.Header["kid"] = "rsa"
+		str, err := token.SignedString(k)
+		a.NotError(err)
+		return str
+	}
+
+	legacy, err := j.Sign(&testClaims{ID: 1})
+	a.NotError(err)
+	j.SetInterop(true)
+	interop, err := j.Sign(&testClaims{ID: 1})
+	a.NotError(err)
+
+	// 第三方库可以验证兼容模式下签发的令牌
+	t1, err := jwt.Parse(interop, func(*jwt.Token) (any, error) { return j.v.findKey("rsa").key, nil }, jwt.WithValidMethods([]string{"RS256"}))
+	a.NotError(err).True(t1.Valid).Equal(t1.Header["alg"], "RS256")
+	_, err = jwt.Parse(legacy, func(*jwt.Token) (any, error) { return j.v.findKey("rsa").key, nil }, jwt.WithValidMethods([]string{"RS256"}))
+	a.Error(err)
+
+	// 默认接受 none 和 RS256
+	get(legacy, http.StatusNoContent)
+	get(interop, http.StatusNoContent)
+	get(sign(jwt.SigningMethodPS256, rsaKey), http.StatusUnauthorized)
+	get(sign(jwt.SigningMethodHS256, pub), http.StatusUnauthorized) // 以公钥作为 HMAC 密钥的攻击
+
+	// 允许列表
+	a.NotError(j.SetAlgs("rsa", "PS256"))
+	get(legacy, http.StatusUnauthorized)
+	get(interop, http.StatusUnauthorized)
+	get(sign(jwt.SigningMethodPS256, rsaKey), http.StatusNoContent)
+
+	a.NotError(j.SetAlgs("rsa", "RS256", "none"))
+	get(legacy, http.StatusNoContent)
+	get(interop, http.StatusNoContent)
+	get(sign(jwt.SigningMethodPS256, rsaKey), http.StatusUnauthorized)
+
+	// 恢复默认值
+	a.NotError(j.SetAlgs("rsa"))
+	get(legacy, http.StatusNoContent)
+	get(sign(jwt.SigningMethodPS256, rsaKey), http.StatusUnauthorized)
+}
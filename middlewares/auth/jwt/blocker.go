@@ -6,6 +6,7 @@ package jwt
 
 import (
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/issue9/cache"
@@ -38,17 +39,25 @@ type (
 		accessTTL  time.Duration
 		refreshTTL time.Duration
 		c          web.Cache
+		hooks      []func(string)
+		hooksMux   sync.RWMutex
+		revoke     web.Cache // 吊销记录，包括家族、会话和主体等。
+		revokeMux  sync.Mutex
 	}
 )
 
 // NewCacheBlocker 声明基于 [web.Cache] 的 [Blocker] 实现
 //
 // access 和 refresh 表示拉黑的令牌在多少时间之后会被释放；
+//
+// 返回对象同时实现了 [FamilyBlocker] 和 [RevokeBlocker]。
 func NewCacheBlocker[T Claims](s web.Server, prefix string, access, refresh time.Duration) Blocker[T] {
+	// 令牌和吊销记录分别处于不同的前缀之下，客户端提交的令牌不会与吊销记录冲突。
 	return &cacheBlocker[T]{
 		accessTTL:  access,
 		refreshTTL: refresh,
-		c:          web.NewCache(prefix, s.Cache()),
+		c:          web.NewCache(prefix+tokenPrefix, s.Cache()),
+		revoke:     web.NewCache(prefix+revokePrefix, s.Cache()),
 	}
 }
 
@@ -58,6 +67,12 @@ func (d *cacheBlocker[T]) BlockToken(token string, refresh bool) error {
 		ttl = d.refreshTTL
 	}
 
+	d.hooksMux.RLock()
+	for _, h := range d.hooks {
+		h(token)
+	}
+	d.hooksMux.RUnlock()
+
 	err := d.c.Set(token, true, ttl)
 	if errors.Is(err, cache.ErrCacheMiss()) {
 		return nil
@@ -65,6 +80,12 @@ func (d *cacheBlocker[T]) BlockToken(token string, refresh bool) error {
 	return err
 }
 
+func (d *cacheBlocker[T]) onBlock(f func(string)) {
+	d.hooksMux.Lock()
+	defer d.hooksMux.Unlock()
+	d.hooks = append(d.hooks, f)
+}
+
 func (d *cacheBlocker[T]) TokenIsBlocked(token string) bool {
 	var val bool
 	err := d.c.Get(token, &val)
@@ -77,5 +98,3 @@ func (d *cacheBlocker[T]) TokenIsBlocked(token string) bool {
 		return val
 	}
 }
-
-func (d *cacheBlocker[T]) ClaimsIsBlocked(T) bool { return false }
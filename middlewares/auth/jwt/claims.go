@@ -5,8 +5,14 @@
 package jwt
 
 import (
+	"fmt"
+	"slices"
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
 )
 
 // Claims Claims 对象需要实现的接口
@@ -25,3 +31,119 @@ type Claims interface {
 	// 否则应该返回调用 [Claims.BuildRefresh] 的参数。
 	BaseToken() string
 }
+
+// TimeClaims 由 [Signer.Render] 设置签发时间和过期时间的 [Claims]
+type TimeClaims interface {
+	Claims
+
+	// SetTimes 设置签发时间 iat 和过期时间 exp
+	//
+	// exp 根据 [Signer] 的参数计算，普通令牌和刷新令牌分别对应 expired 和 refresh。
+	SetTimes(iat, exp time.Time)
+}
+
+// UserClaims 通用的 [Claims] 实现
+//
+// ID 为用户 ID 的类型；P 为自定义的附加数据，不需要时可以是 struct{}。
+// 同时实现了 [TimeClaims]、[FamilyClaims]、[SessionClaims] 和 [ConfirmationClaims]，
+// act 声明可通过 [UserClaims.Impersonate] 生成。
+type UserClaims[ID comparable, P any] struct {
+	jwt.RegisteredClaims
+	UserID  ID            `json:"uid"`
+	Payload P             `json:"payload"`
+	SID     string        `json:"sid,omitempty"`  // 设备或会话 ID
+	Fam     string        `json:"fam,omitempty"`  // 刷新令牌家族
+	Base    string        `json:"base,omitempty"` // 刷新令牌关联的令牌
+	Cnf     *Confirmation `json:"cnf,omitempty"`  // DPoP 绑定的公钥
+	Act     *Act          `json:"act,omitempty"`  // 实际的操作者
+
+	// 用户登录的时间
+	//
+	// 一般在登录时设置，刷新令牌时保持不变，可用于 [auth.Fresh] 判断用户是否在最近进行过登录。
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+}
+
+// NewUserClaims 声明 [UserClaims]
+//
+// 会生成随机的 jti，同时 sub 为 uid 的字符串形式。
+// iat 和 exp 由 [Signer.Render] 设置，其它的字段可以在返回之后自行修改。
+func NewUserClaims[ID comparable, P any](uid ID, payload P) *UserClaims[ID, P] {
+	return &UserClaims[ID, P]{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:      mauth.RandString(16),
+			Subject: fmt.Sprint(uid),
+		},
+		UserID:  uid,
+		Payload: payload,
+	}
+}
+
+// Impersonate 生成以 uid 的身份进行操作的 [UserClaims]
+//
+// 返回对象的 act 声明为当前对象的 sub，如果当前对象本身也处于模拟状态，则保留原有的操作链。
+func (c *UserClaims[ID, P]) Impersonate(uid ID, payload P) *UserClaims[ID, P] {
+	claims := NewUserClaims(uid, payload)
+	claims.Act = &Act{Sub: c.Subject, Act: c.Act}
+	return claims
+}
+
+// BuildRefresh 生成刷新令牌的 [Claims]
+//
+// 除了 jti、iat 和 exp，其它字段均与当前对象相同。
+func (c *UserClaims[ID, P]) BuildRefresh(token string, _ *web.Context) Claims {
+	return &UserClaims[ID, P]{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        mauth.RandString(16),
+			Issuer:    c.Issuer,
+			Subject:   c.Subject,
+			Audience:  slices.Clone(c.Audience),
+			NotBefore: c.NotBefore,
+		},
+		UserID:  c.UserID,
+		Payload: c.Payload,
+		SID:     c.SID,
+		Fam:     c.Fam,
+		Base:    token,
+		Cnf:     c.Cnf,
+		Act:     c.Act,
+
+		AuthTime: c.AuthTime,
+	}
+}
+
+func (c *UserClaims[ID, P]) BaseToken() string { return c.Base }
+
+func (c *UserClaims[ID, P]) SetTimes(iat, exp time.Time) {
+	c.IssuedAt = jwt.NewNumericDate(iat)
+	c.ExpiresAt = jwt.NewNumericDate(exp)
+}
+
+// AuthenticatedAt 返回 auth_time 的值
+//
+// 未设置时返回零值，可直接作为 [auth.AuthTimeFunc] 使用。
+func (c *UserClaims[ID, P]) AuthenticatedAt() time.Time {
+	if c.AuthTime == nil {
+		return time.Time{}
+	}
+	return c.AuthTime.Time
+}
+
+func (c *UserClaims[ID, P]) Session() string { return c.SID }
+
+func (c *UserClaims[ID, P]) JKT() string {
+	if c.Cnf == nil {
+		return ""
+	}
+	return c.Cnf.JKT
+}
+
+func (c *UserClaims[ID, P]) SetJKT(jkt string) { c.Cnf = &Confirmation{JKT: jkt} }
+
+// ActorID 实际操作者的标识
+//
+// 未处于模拟状态时返回空字符串。
+func (c *UserClaims[ID, P]) ActorID() string { return c.Act.ActorID() }
+
+func (c *UserClaims[ID, P]) Family() string { return c.Fam }
+
+func (c *UserClaims[ID, P]) SetFamily(f string) { c.Fam = f }
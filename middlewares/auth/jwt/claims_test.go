@@ -5,10 +5,19 @@
 package jwt
 
 import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
 	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
 )
 
 type testClaims struct {
@@ -25,3 +34,154 @@ func (c *testClaims) BuildRefresh(token string, ctx *web.Context) Claims {
 }
 
 func (c *testClaims) Valid() error { return nil }
+
+var (
+	_ TimeClaims    = &UserClaims[int64, struct{}]{}
+	_ FamilyClaims  = &UserClaims[string, struct{}]{}
+	_ SessionClaims = &UserClaims[string, struct{}]{}
+)
+
+type userPayload struct {
+	Tenant string `json:"tenant"`
+	Email  string `json:"email"`
+}
+
+type userClaims = UserClaims[int64, *userPayload]
+
+func TestUserClaims_JSON(t *testing.T) {
+	a := assert.New(t, false)
+
+	c := NewUserClaims[int64](5, &userPayload{Tenant: "t1", Email: "user@example.com"})
+	a.NotEmpty(c.ID).Equal(c.Subject, "5").Equal(c.UserID, 5)
+	a.NotEqual(NewUserClaims[int64](5, &userPayload{}).ID, c.ID)
+
+	now := time.Now()
+	c.Issuer = "issuer"
+	c.Audience = jwt.ClaimStrings{"api"}
+	c.SetTimes(now, now.Add(time.Hour))
+	c.SetFamily("fam")
+
+	data, err := json.Marshal(c)
+	a.NotError(err)
+	c2 := &userClaims{}
+	a.NotError(json.Unmarshal(data, c2)).
+		Equal(c2, c).
+		Equal(c2.Family(), "fam").
+		Empty(c2.BaseToken())
+
+	m := map[string]any{}
+	a.NotError(json.Unmarshal(data, &m))
+	a.Equal(m["sub"], "5").
+		Equal(m["uid"], 5).
+		Equal(m["iss"], "issuer").
+		Equal(m["payload"], map[string]any{"tenant": "t1", "email": "user@example.com"})
+}
+
+func TestUserClaims_Impersonate(t *testing.T) {
+	a := assert.New(t, false)
+
+	admin := NewUserClaims[int64](1, &userPayload{})
+	a.Empty(admin.ActorID())
+
+	c := admin.Impersonate(2, &userPayload{Tenant: "t2"})
+	a.Equal(c.Subject, "2").
+		Equal(c.Payload.Tenant, "t2").
+		NotEqual(c.ID, admin.ID).
+		Equal(c.ActorID(), "1").
+		Equal(c.Act, &Act{Sub: "1"})
+
+	// 操作链
+	c2 := c.Impersonate(3, &userPayload{})
+	a.Equal(c2.ActorID(), "2").
+		Equal(c2.Act, &Act{Sub: "2", Act: &Act{Sub: "1"}})
+
+	data, err := json.Marshal(c)
+	a.NotError(err).Contains(string(data), `"act":{"sub":"1"}`)
+	data, err = json.Marshal(admin)
+	a.NotError(err).NotContains(string(data), `"act"`)
+
+	// 刷新令牌保留 act 声明
+	r := c.BuildRefresh("token", nil).(*userClaims)
+	a.Equal(r.ActorID(), "1").Equal(r.BaseToken(), "token")
+}
+
+func TestUserClaims_AuthenticatedAt(t *testing.T) {
+	a := assert.New(t, false)
+	now := time.Now().Truncate(time.Second)
+
+	c := NewUserClaims[int64](1, &userPayload{})
+	a.True(c.AuthenticatedAt().IsZero())
+	data, err := json.Marshal(c)
+	a.NotError(err).NotContains(string(data), `"auth_time"`)
+
+	c.AuthTime = jwt.NewNumericDate(now)
+	a.Equal(c.AuthenticatedAt(), now)
+	data, err = json.Marshal(c)
+	a.NotError(err).Contains(string(data), `"auth_time":`+strconv.FormatInt(now.Unix(), 10))
+
+	// 刷新令牌保留 auth_time 声明
+	r := c.BuildRefresh("token", nil).(*userClaims)
+	a.Equal(r.AuthenticatedAt(), now)
+}
+
+func TestUserClaims_Render(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := NewCacheBlocker[*userClaims](s, "test_", time.Hour, 2*time.Hour)
+	j := New(b, func() *userClaims { return &userClaims{} }, time.Hour, 2*time.Hour, nil)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	j.v.SetPolicy(s, &Policy[*userClaims]{Required: []string{"exp", "iat", "sub"}})
+
+	r := s.Routers().New("def", nil)
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, NewUserClaims[int64](5, &userPayload{Tenant: "t1"}))
+	})
+	r.Post("/refresh", j.VerifiyRefresh(func(ctx *web.Context) web.Responser {
+		c, found := j.GetInfo(ctx)
+		if !found || c.UserID != 5 || c.Payload.Tenant != "t1" || c.BaseToken() != "" {
+			return ctx.Problem(web.ProblemBadRequest)
+		}
+		return j.Render(ctx, http.StatusCreated, NewUserClaims(c.UserID, c.Payload))
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	parse := func(token string) *userClaims {
+		c := &userClaims{}
+		_, _, err := jwt.NewParser().ParseUnverified(token, c)
+		a.NotError(err)
+		return c
+	}
+
+	login := func(path, token string) *Response {
+		resp := &Response{}
+		req := servertest.Post(a, "http://localhost:8080"+path, nil)
+		if token != "" {
+			req.Header(mauth.AuthorizationHeader, "Bearer "+token)
+		}
+		req.Do(nil).
+			Status(http.StatusCreated).
+			BodyFunc(func(a *assert.Assertion, body []byte) {
+				a.NotError(json.Unmarshal(body, resp))
+			})
+		return resp
+	}
+
+	resp := login("/login", "")
+	access, refresh := parse(resp.Access), parse(resp.Refresh)
+	a.Equal(access.ExpiresAt.Sub(access.IssuedAt.Time), time.Hour).
+		Equal(refresh.ExpiresAt.Sub(refresh.IssuedAt.Time), 2*time.Hour).
+		Equal(refresh.BaseToken(), resp.Access).
+		Empty(access.BaseToken()).
+		NotEqual(refresh.ID, access.ID).
+		Equal(refresh.UserID, 5).
+		Equal(refresh.Payload, access.Payload).
+		NotEmpty(access.Family()).
+		Equal(refresh.Family(), access.Family())
+
+	resp2 := login("/refresh", resp.Refresh)
+	a.Equal(parse(resp2.Access).Family(), access.Family())
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"io/fs"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+)
+
+// KeyConfig 密钥的声明式配置
+//
+// Public 和 Private 表示密钥的来源，格式为 scheme:value，scheme 可以是：
+//   - file 从 [fs.FS] 中读取文件，比如 file:keys/private.pem；
+//   - env 从环境变量中读取 base64 编码的内容，比如 env:JWT_PRIVATE_KEY；
+//   - base64 直接指定 base64 编码的内容；
+//
+// 读取的内容可以是 PEM、DER 或是 JSON 格式的 JWK，对于 HMAC 则为密钥本身。
+// 内容为 JWK 时，ID 和 Alg 可以为空，此时采用 JWK 中的 kid 和 alg。
+type KeyConfig struct {
+	// 密钥的 ID
+	ID string `json:"id,omitempty" xml:"id,attr,omitempty" yaml:"id,omitempty"`
+
+	// 签名算法，比如 RS256、ES256 等
+	Alg string `json:"alg,omitempty" xml:"alg,attr,omitempty" yaml:"alg,omitempty"`
+
+	// 公钥的来源
+	//
+	// 为空时从私钥中获取，HMAC 会忽略此值。
+	Public string `json:"public,omitempty" xml:"public,omitempty" yaml:"public,omitempty"`
+
+	// 私钥的来源
+	//
+	// [Verifier.LoadKeys] 在 Public 不为空时会忽略此值。
+	Private string `json:"private,omitempty" xml:"private,omitempty" yaml:"private,omitempty"`
+}
+
+// 读取来源 src 的内容
+func readKeySource(fsys fs.FS, src string) ([]byte, error) {
+	scheme, val, found := strings.Cut(src, ":")
+	if !found || val == "" {
+		return nil, web.NewLocaleError("invalid jwt key source %s", src)
+	}
+
+	switch scheme {
+	case "file":
+		if fsys == nil {
+			return nil, web.NewLocaleError("invalid jwt key source %s", src)
+		}
+		return fs.ReadFile(fsys, val)
+	case "env":
+		return readEnv(val)
+	case "base64":
+		return decodeBase64(val)
+	default:
+		return nil, web.NewLocaleError("invalid jwt key source %s", src)
+	}
+}
+
+// 加载密钥
+//
+// 返回的 pub 和 pvt 根据 public 和 private 参数决定是否加载，未加载的为 nil。
+// 如果需要 pub 但是未指定 Public，则从私钥中获取。
+func (c *KeyConfig) load(fsys fs.FS, public, private bool) (id string, sign SigningMethod, pub, pvt any, err error) {
+	id, sign = c.ID, jwt.GetSigningMethod(c.Alg)
+	_, isHMAC := sign.(*jwt.SigningMethodHMAC)
+
+	if private || (public && (c.Public == "" || isHMAC)) {
+		if c.Private == "" {
+			return "", nil, nil, nil, web.NewLocaleError("jwt key %s missing private key", c.ID)
+		}
+		data, err := readKeySource(fsys, c.Private)
+		if err != nil {
+			return "", nil, nil, nil, err
+		}
+		if id, sign, pvt, err = c.parse(data, id, sign, true); err != nil {
+			return "", nil, nil, nil, err
+		}
+	}
+
+	if public {
+		if c.Public == "" || isHMAC {
+			pub = publicOf(pvt)
+		} else {
+			data, err := readKeySource(fsys, c.Public)
+			if err != nil {
+				return "", nil, nil, nil, err
+			}
+			if id, sign, pub, err = c.parse(data, id, sign, false); err != nil {
+				return "", nil, nil, nil, err
+			}
+		}
+	}
+
+	if !private {
+		pvt = nil
+	}
+	return id, sign, pub, pvt, nil
+}
+
+// 解析密钥的内容
+//
+// id 和 sign 为已知的值，如果内容为 JWK，则在其为空时采用 JWK 中的值，不为空时需要与 JWK 中的值相同。
+func (c *KeyConfig) parse(data []byte, id string, sign SigningMethod, private bool) (string, SigningMethod, any, error) {
+	if !isJWK(data) {
+		if id == "" {
+			return "", nil, nil, web.NewLocaleError("jwt key id can not be empty")
+		}
+		if sign == nil {
+			return "", nil, nil, web.NewLocaleError("unsupported jwt alg %s", c.Alg)
+		}
+
+		var k any
+		var err error
+		if private {
+			k, err = parsePrivateKey(sign, data)
+		} else {
+			k, err = parsePublicKey(sign, data)
+		}
+		return id, sign, k, err
+	}
+
+	kid, m, k, err := parseJWK(data, c.Alg, private)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if id != "" && id != kid {
+		return "", nil, nil, web.NewLocaleError("jwk kid %s does not match %s", kid, id)
+	}
+	if sign != nil && sign.Alg() != m.Alg() {
+		return "", nil, nil, web.NewLocaleError("jwk alg %s does not match %s", m.Alg(), sign.Alg())
+	}
+	return kid, m, k, nil
+}
+
+func errLoadKey(id string, err error) error {
+	return web.NewLocaleError("load jwt key %s failed, %s", id, err)
+}
+
+// LoadKeys 根据配置加载私钥
+//
+// 任意一项出错都会返回错误，但是之前已经加载的密钥不会被删除。
+func (s *Signer) LoadKeys(fsys fs.FS, keys ...*KeyConfig) error {
+	for _, c := range keys {
+		id, sign, _, pvt, err := c.load(fsys, false, true)
+		if err == nil {
+			err = s.insertKey(id, sign, pvt)
+		}
+		if err != nil {
+			return errLoadKey(c.ID, err)
+		}
+	}
+	return nil
+}
+
+// LoadKeys 根据配置加载公钥
+//
+// 任意一项出错都会返回错误，但是之前已经加载的密钥不会被删除。
+func (j *Verifier[T]) LoadKeys(fsys fs.FS, keys ...*KeyConfig) error {
+	for _, c := range keys {
+		id, sign, pub, _, err := c.load(fsys, true, false)
+		if err == nil {
+			err = j.insertKey(id, sign, pub)
+		}
+		if err != nil {
+			return errLoadKey(c.ID, err)
+		}
+	}
+	return nil
+}
+
+// LoadKeys 根据配置加载密钥对
+//
+// 任意一项出错都会返回错误，但是之前已经加载的密钥不会被删除。
+func (j *JWT[T]) LoadKeys(fsys fs.FS, keys ...*KeyConfig) error {
+	for _, c := range keys {
+		id, sign, pub, pvt, err := c.load(fsys, true, true)
+		if err == nil {
+			err = j.AddKey(id, sign, pub, pvt)
+		}
+		if err != nil {
+			return errLoadKey(c.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+)
+
+func TestJWT_LoadKeys(t *testing.T) {
+	a := assert.New(t, false)
+	fsys := os.DirFS("./testdata")
+	b64 := base64.StdEncoding.EncodeToString
+
+	data, err := os.ReadFile("./testdata/ec256-private.pem")
+	a.NotError(err)
+	t.Setenv("JWT_EC_PRIVATE", b64(data))
+	ecData, _ := ecJWK(a, "jwk")
+
+	keys := []*KeyConfig{
+		{ID: "rsa", Alg: "RS256", Public: "file:rsa-public.pem", Private: "file:rsa-private.pem"},
+		{ID: "ec", Alg: "ES256", Private: "env:JWT_EC_PRIVATE"},
+		{ID: "hmac", Alg: "HS256", Public: "ignored", Private: "base64:" + b64([]byte("secret"))},
+		{Private: "base64:" + b64(ecData)},
+	}
+
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+	a.NotError(j.LoadKeys(fsys, keys...))
+	for _, id := range []string{"rsa", "ec", "hmac", "jwk"} {
+		checkKeyPair(a, j, id)
+	}
+	a.Equal(j.s.findKey("jwk").sign, jwt.SigningMethodES256)
+
+	// Verifier 优先采用 Public
+	v := NewVerifier[*testClaims](nil, nil)
+	a.NotError(v.LoadKeys(fsys,
+		&KeyConfig{ID: "rsa", Alg: "RS256", Public: "file:rsa-public.pem", Private: "file:not-exists.pem"},
+		&KeyConfig{ID: "ec", Alg: "ES256", Private: "env:JWT_EC_PRIVATE"},
+	))
+	a.NotNil(v.findKey("rsa")).NotNil(v.findKey("ec"))
+
+	s := NewSigner(time.Hour, 0, nil)
+	a.NotError(s.LoadKeys(fsys, &KeyConfig{ID: "ed", Alg: "EdDSA", Private: "file:ed25519-private.pem"}))
+	a.ErrorString(s.LoadKeys(fsys, &KeyConfig{ID: "rsa", Alg: "RS256", Public: "file:rsa-public.pem"}), "rsa")
+
+	invalid := map[string]*KeyConfig{
+		"scheme":   {ID: "k", Alg: "RS256", Private: "http:rsa-private.pem"},
+		"no value": {ID: "k", Alg: "RS256", Private: "file:"},
+		"no file":  {ID: "k", Alg: "RS256", Private: "file:not-exists.pem"},
+		"no env":   {ID: "k", Alg: "RS256", Private: "env:JWT_NOT_EXISTS"},
+		"no id":    {Alg: "RS256", Private: "file:rsa-private.pem"},
+		"alg":      {ID: "k", Alg: "XX256", Private: "file:rsa-private.pem"},
+		"mismatch": {ID: "k", Alg: "ES256", Private: "file:rsa-private.pem"},
+		"pub":      {ID: "k", Alg: "RS256", Public: "file:ec256-public.pem", Private: "file:rsa-private.pem"},
+		"kid":      {ID: "k", Private: "base64:" + b64(ecData)},
+		"jwk alg":  {Alg: "ES384", Private: "base64:" + b64(ecData)},
+	}
+	for name, c := range invalid {
+		_, j := newJWT(a, time.Hour, 2*time.Hour)
+		a.Error(j.LoadKeys(fsys, c), name)
+		a.Empty(j.s.keys, name).Empty(j.v.keys, name)
+	}
+
+	a.Error(j.LoadKeys(nil, &KeyConfig{ID: "k", Alg: "RS256", Private: "file:rsa-private.pem"}))
+}
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+// ReasonInvalidCSRF 通过 cookie 提交令牌时，CSRF 令牌验证失败。
+const ReasonInvalidCSRF = "invalid-csrf"
+
+// Cookie 通过 cookie 传递令牌的设置
+//
+// 访问令牌和刷新令牌均以 HttpOnly 和 Secure 的 cookie 形式传递，客户端脚本无法读取。
+// 同时会签发一个客户端脚本可读取的 CSRF 令牌，对于非安全的请求方法，
+// 客户端需要将该值通过 CSRFHeader 指定的报头提交，即 double-submit cookie 模式。
+type Cookie struct {
+	Access  string // 访问令牌的 cookie 名称，为空则采用 access_token
+	Refresh string // 刷新令牌的 cookie 名称，为空则采用 refresh_token
+	CSRF    string // CSRF 令牌的 cookie 名称，为空则采用 csrf_token
+
+	// 提交 CSRF 令牌的报头名称，为空则采用 X-CSRF-Token。
+	CSRFHeader string
+
+	// 访问令牌和 CSRF 令牌的 cookie 路径，为空则采用 /。
+	Path string
+
+	// 刷新令牌的 cookie 路径
+	//
+	// 一般为刷新令牌的接口地址，这样刷新令牌仅在刷新时才会被提交。为空则与 Path 相同。
+	RefreshPath string
+
+	Domain string
+
+	// 为零值时采用 [http.SameSiteLaxMode]
+	SameSite http.SameSite
+}
+
+// 补全 o 的默认值并返回新的对象
+func (o *Cookie) sanitize() *Cookie {
+	if o == nil {
+		panic("参数 o 不能为空")
+	}
+
+	c := *o
+	if c.Access == "" {
+		c.Access = "access_token"
+	}
+	if c.Refresh == "" {
+		c.Refresh = "refresh_token"
+	}
+	if c.CSRF == "" {
+		c.CSRF = "csrf_token"
+	}
+	if c.CSRFHeader == "" {
+		c.CSRFHeader = "X-CSRF-Token"
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if c.RefreshPath == "" {
+		c.RefreshPath = c.Path
+	}
+	if c.SameSite == 0 {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	return &c
+}
+
+// maxAge 为负数表示删除 cookie
+func (o *Cookie) cookie(name, value, path string, httpOnly bool, now time.Time, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   o.Domain,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: o.SameSite,
+	}
+
+	if maxAge < 0 {
+		c.MaxAge = -1
+		c.Expires = time.Unix(0, 0)
+	} else {
+		c.MaxAge = int(maxAge.Seconds())
+		c.Expires = now.Add(maxAge) // http 1.0 和 ie8 仅支持此属性
+	}
+	return c
+}
+
+// 写入令牌及 CSRF 令牌
+//
+// refresh 为空表示没有刷新令牌；
+func (o *Cookie) set(ctx *web.Context, access, refresh string, accessAge, refreshAge time.Duration) {
+	now := ctx.Begin()
+	csrfAge := accessAge
+	cookies := []*http.Cookie{o.cookie(o.Access, access, o.Path, true, now, accessAge)}
+	if refresh != "" {
+		csrfAge = refreshAge
+		cookies = append(cookies, o.cookie(o.Refresh, refresh, o.RefreshPath, true, now, refreshAge))
+	}
+	cookies = append(cookies, o.cookie(o.CSRF, mauth.RandString(24), o.Path, false, now, csrfAge))
+	ctx.SetCookies(cookies...)
+}
+
+// 删除所有的 cookie
+func (o *Cookie) delete(ctx *web.Context) {
+	now := ctx.Begin()
+	ctx.SetCookies(
+		o.cookie(o.Access, "", o.Path, true, now, -1),
+		o.cookie(o.Refresh, "", o.RefreshPath, true, now, -1),
+		o.cookie(o.CSRF, "", o.Path, false, now, -1),
+	)
+}
+
+func (o *Cookie) token(ctx *web.Context, refresh bool) string {
+	name := o.Access
+	if refresh {
+		name = o.Refresh
+	}
+
+	if c, err := ctx.Request().Cookie(name); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// 验证 CSRF 令牌
+//
+// 仅在令牌来自 cookie 且请求方法为非安全方法时才需要验证。
+func (o *Cookie) checkCSRF(ctx *web.Context, token string, refresh bool) bool {
+	switch ctx.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	if o.token(ctx, refresh) != token { // 令牌并非来自 cookie
+		return true
+	}
+
+	c, err := ctx.Request().Cookie(o.CSRF)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	h := ctx.Request().Header.Get(o.CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(h), []byte(c.Value)) == 1
+}
+
+// SetCookie 通过 cookie 输出令牌
+//
+// 设置之后 [Signer.Render] 不再输出令牌的内容，而是以 cookie 的形式写入，
+// 同时签发 CSRF 令牌。需要 [Verifier.SetCookie] 配合使用。
+func (s *Signer) SetCookie(o *Cookie) { s.cookie = o.sanitize() }
+
+// SetCookie 从 cookie 中读取令牌
+//
+// 设置之后会优先从 cookie 中读取令牌，[Verifier.VerifyRefresh] 读取的是刷新令牌的 cookie，
+// 对于非安全的请求方法还会验证 CSRF 令牌，失败时返回 403。
+// [Verifier.Logout] 也会删除相关的 cookie。
+func (j *Verifier[T]) SetCookie(o *Cookie) { j.cookie = o.sanitize() }
+
+// SetCookie 通过 cookie 传递令牌
+//
+// 相当于同时调用 [Signer.SetCookie] 和 [Verifier.SetCookie]。
+func (j *JWT[T]) SetCookie(o *Cookie) {
+	j.s.SetCookie(o)
+	j.v.SetCookie(o)
+}
+
+func (j *Verifier[T]) failCSRF(ctx *web.Context) web.Responser {
+	auth.Emit(ctx, j.sink, &auth.Event{Type: auth.EventFailure, Source: j.source, Reason: ReasonInvalidCSRF})
+	return ctx.Problem(web.ProblemForbidden)
+}
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+func TestCookie_sanitize(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.PanicString(func() {
+		(*Cookie)(nil).sanitize()
+	}, "参数 o 不能为空")
+
+	o := &Cookie{}
+	c := o.sanitize()
+	a.Equal(c, &Cookie{
+		Access:      "access_token",
+		Refresh:     "refresh_token",
+		CSRF:        "csrf_token",
+		CSRFHeader:  "X-CSRF-Token",
+		Path:        "/",
+		RefreshPath: "/",
+		SameSite:    http.SameSiteLaxMode,
+	}).Equal(o, &Cookie{}) // 不修改原对象
+
+	c = (&Cookie{Path: "/api", SameSite: http.SameSiteStrictMode}).sanitize()
+	a.Equal(c.RefreshPath, "/api").Equal(c.SameSite, http.SameSiteStrictMode)
+}
+
+func TestJWT_SetCookie(t *testing.T) {
+	a := assert.New(t, false)
+
+	var reason string
+	reasonMux := &sync.Mutex{}
+	sink := auth.SinkFunc(func(e *auth.Event) {
+		reasonMux.Lock()
+		defer reasonMux.Unlock()
+		reason = e.Reason
+	})
+
+	s, j := newJWT(a, time.Hour, 2*time.Hour)
+	j.SetSink(sink)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	j.SetCookie(&Cookie{RefreshPath: "/refresh", SameSite: http.SameSiteStrictMode})
+
+	r := s.Routers().New("def", nil)
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, &testClaims{ID: 1, Created: ctx.Begin()})
+	})
+	r.Post("/refresh", j.VerifiyRefresh(func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, &testClaims{ID: 1, Created: ctx.Begin()})
+	}))
+	info := j.Middleware(func(*web.Context) web.Responser { return web.NoContent() })
+	r.Get("/info", info)
+	r.Post("/info", info)
+	r.Post("/logout", j.Middleware(func(ctx *web.Context) web.Responser {
+		a.NotError(j.Logout(ctx))
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	cookies := func(resp *http.Response) map[string]*http.Cookie {
+		m := map[string]*http.Cookie{}
+		for _, c := range resp.Cookies() {
+			m[c.Name] = c
+		}
+		return m
+	}
+
+	login := func() map[string]*http.Cookie {
+		resp := servertest.Post(a, "http://localhost:8080/login", nil).
+			Do(nil).
+			Status(http.StatusCreated).
+			BodyEmpty().
+			Resp()
+		return cookies(resp)
+	}
+
+	c := login()
+	access, refresh, csrf := c["access_token"], c["refresh_token"], c["csrf_token"]
+	a.NotNil(access).NotNil(refresh).NotNil(csrf)
+	a.True(access.HttpOnly).True(access.Secure).
+		Equal(access.SameSite, http.SameSiteStrictMode).
+		Equal(access.Path, "/").
+		Equal(access.MaxAge, 3600)
+	a.True(refresh.HttpOnly).True(refresh.Secure).
+		Equal(refresh.Path, "/refresh").
+		Equal(refresh.MaxAge, 7200)
+	a.False(csrf.HttpOnly).True(csrf.Secure).
+		Equal(csrf.Path, "/").
+		NotEmpty(csrf.Value)
+
+	// 安全的请求方法不需要 CSRF 令牌
+	servertest.Get(a, "http://localhost:8080/info").
+		Cookie(access).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	// 缺少 CSRF 令牌
+	servertest.Post(a, "http://localhost:8080/info", nil).
+		Cookie(access).
+		Cookie(csrf).
+		Do(nil).
+		Status(http.StatusForbidden)
+	reasonMux.Lock()
+	a.Equal(reason, ReasonInvalidCSRF)
+	reasonMux.Unlock()
+
+	// CSRF 令牌不匹配
+	servertest.Post(a, "http://localhost:8080/info", nil).
+		Cookie(access).
+		Cookie(csrf).
+		Header("X-CSRF-Token", "invalid").
+		Do(nil).
+		Status(http.StatusForbidden)
+
+	// 缺少 CSRF cookie
+	servertest.Post(a, "http://localhost:8080/info", nil).
+		Cookie(access).
+		Header("X-CSRF-Token", csrf.Value).
+		Do(nil).
+		Status(http.StatusForbidden)
+
+	servertest.Post(a, "http://localhost:8080/info", nil).
+		Cookie(access).
+		Cookie(csrf).
+		Header("X-CSRF-Token", csrf.Value).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	// 通过报头提交的令牌不需要 CSRF 令牌
+	servertest.Post(a, "http://localhost:8080/info", nil).
+		Header(mauth.AuthorizationHeader, "Bearer "+access.Value).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	// 刷新令牌从 cookie 中读取，访问令牌的 cookie 不影响刷新操作。
+	resp := servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Cookie(access).
+		Cookie(refresh).
+		Cookie(csrf).
+		Header("X-CSRF-Token", csrf.Value).
+		Do(nil).
+		Status(http.StatusCreated).
+		Resp()
+	c2 := cookies(resp)
+	a.NotEqual(c2["access_token"].Value, access.Value).
+		NotEqual(c2["refresh_token"].Value, refresh.Value).
+		NotEqual(c2["csrf_token"].Value, csrf.Value)
+
+	// 旧的刷新令牌已经失效
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Cookie(refresh).
+		Cookie(csrf).
+		Header("X-CSRF-Token", csrf.Value).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	// 仅有访问令牌无法刷新
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Cookie(c2["access_token"]).
+		Cookie(c2["csrf_token"]).
+		Header("X-CSRF-Token", c2["csrf_token"].Value).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	// logout
+	resp = servertest.Post(a, "http://localhost:8080/logout", nil).
+		Cookie(c2["access_token"]).
+		Cookie(c2["csrf_token"]).
+		Header("X-CSRF-Token", c2["csrf_token"].Value).
+		Do(nil).
+		Status(http.StatusNoContent).
+		Resp()
+	c3 := cookies(resp)
+	a.Length(c3, 3)
+	for _, c := range c3 {
+		a.Empty(c.Value).True(c.MaxAge < 0)
+	}
+	a.Equal(c3["refresh_token"].Path, "/refresh")
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Cookie(c2["access_token"]).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+}
@@ -0,0 +1,329 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+	"github.com/issue9/webuse/v7/internal/mauth"
+)
+
+const (
+	DPoPHeader      = "DPoP"       // 提交 DPoP 证明的报头
+	DPoPNonceHeader = "DPoP-Nonce" // 服务端下发 nonce 的报头
+
+	// ReasonInvalidDPoP DPoP 证明验证失败
+	ReasonInvalidDPoP = "invalid-dpop"
+
+	dpopType    = "dpop+jwt"
+	dpopPrefix  = "dpop "
+	noncePrefix = "nonce_"
+	jtiPrefix   = "jti_"
+)
+
+// DPoP 证明允许的签名算法，仅限非对称算法。
+var dpopAlgs = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+var (
+	errInvalidDPoP = web.NewLocaleError("invalid dpop proof")
+	errDPoPNonce   = web.NewLocaleError("invalid dpop nonce")
+	errDPoPReplay  = web.NewLocaleError("dpop proof replayed")
+)
+
+type (
+	// ConfirmationClaims 支持 DPoP 绑定的 [Claims]
+	//
+	// 绑定之后的令牌在提交时需要同时提交由对应私钥签名的 DPoP 证明。
+	ConfirmationClaims interface {
+		Claims
+
+		// JKT 令牌绑定的公钥的 JWK Thumbprint
+		//
+		// 为空表示未绑定，即普通的 Bearer 令牌。
+		JKT() string
+
+		// SetJKT 设置令牌绑定的公钥
+		//
+		// 由 [Signer.Render] 调用。
+		SetJKT(string)
+	}
+
+	// Confirmation 令牌的 cnf 声明
+	Confirmation struct {
+		JKT string `json:"jkt"`
+	}
+
+	// DPoP 验证客户端提交的 DPoP 证明
+	//
+	// https://datatracker.ietf.org/doc/html/rfc9449
+	DPoP struct {
+		cache    web.Cache
+		lifetime time.Duration
+		nonce    bool
+	}
+
+	dpopClaims struct {
+		jwt.RegisteredClaims
+		HTM   string `json:"htm"`
+		HTU   string `json:"htu"`
+		ATH   string `json:"ath,omitempty"`
+		Nonce string `json:"nonce,omitempty"`
+	}
+
+	// 保存当前请求已验证的 DPoP 公钥
+	dpopSlot struct{}
+
+	// 保存当前请求已通过重放检测的证明，同一请求多次验证同一证明时不再计数。
+	dpopProofSlot struct{}
+)
+
+// 从 Authorization 报头中提取 DPoP 令牌
+var dpopExtractor = HeaderExtractor(mauth.AuthorizationHeader, dpopPrefix)
+
+func ErrInvalidDPoP() error { return errInvalidDPoP }
+
+// NewDPoP 声明 [DPoP] 对象
+//
+// prefix 为缓存中的前缀，jti 防重放和 nonce 均保存在缓存中；
+// lifetime 为 DPoP 证明的有效时间，iat 与当前时间的误差不能超过此值，nonce 也在此时间后失效；
+// nonce 是否要求客户端在证明中包含由服务端下发的 nonce；
+func NewDPoP(s web.Server, prefix string, lifetime time.Duration, nonce bool) *DPoP {
+	if lifetime <= 0 {
+		panic("参数 lifetime 必须大于 0")
+	}
+
+	return &DPoP{
+		cache:    web.NewCache(prefix, s.Cache()),
+		lifetime: lifetime,
+		nonce:    nonce,
+	}
+}
+
+// Middleware 验证令牌接口的 DPoP 证明
+//
+// 用于登录等签发令牌的接口，验证通过之后，[Signer.Render] 签发的令牌会绑定到证明中的公钥。
+// 验证失败时返回 400。
+func (d *DPoP) Middleware(next web.HandlerFunc) web.HandlerFunc {
+	return func(ctx *web.Context) web.Responser {
+		jkt, err := d.verify(ctx, "")
+		if err != nil {
+			d.setError(ctx, err)
+			ctx.Logs().DEBUG().Error(err)
+			return ctx.Problem(web.ProblemBadRequest)
+		}
+
+		ctx.SetVar(dpopSlot{}, jkt)
+		return next(ctx)
+	}
+}
+
+// 验证 DPoP 证明并返回公钥的 JWK Thumbprint
+//
+// token 为证明所关联的令牌，如果不为空，需要验证 ath 声明。
+func (d *DPoP) verify(ctx *web.Context, token string) (string, error) {
+	proofs := ctx.Request().Header.Values(DPoPHeader)
+	if len(proofs) != 1 {
+		return "", errInvalidDPoP
+	}
+
+	var jkt string
+	c := &dpopClaims{}
+	_, err := jwt.NewParser(jwt.WithValidMethods(dpopAlgs)).ParseWithClaims(proofs[0], c, func(t *jwt.Token) (any, error) {
+		if typ, _ := t.Header["typ"].(string); typ != dpopType {
+			return nil, errInvalidDPoP
+		}
+
+		m, ok := t.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errInvalidDPoP
+		}
+		if _, found := m["d"]; found { // 不能包含私钥
+			return nil, errInvalidDPoP
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		k := &jwk.Key{}
+		if err := json.Unmarshal(data, k); err != nil {
+			return nil, err
+		}
+
+		pub, err := k.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		if methodForKey(t.Method.Alg(), pub) == nil { // 同时排除了 oct 类型的密钥
+			return nil, errInvalidDPoP
+		}
+
+		if jkt, err = k.Thumbprint(); err != nil {
+			return nil, err
+		}
+		return pub, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if c.ID == "" || c.IssuedAt == nil {
+		return "", errInvalidDPoP
+	}
+
+	if now := ctx.Begin(); c.IssuedAt.Before(now.Add(-d.lifetime)) || c.IssuedAt.After(now.Add(d.lifetime)) {
+		return "", errInvalidDPoP
+	}
+
+	if c.HTM != ctx.Request().Method || !matchHTU(c.HTU, ctx.Request()) {
+		return "", errInvalidDPoP
+	}
+
+	if token != "" {
+		sum := sha256.Sum256([]byte(token))
+		if c.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", errInvalidDPoP
+		}
+	}
+
+	if d.nonce && (c.Nonce == "" || !d.cache.Exists(noncePrefix+c.Nonce)) {
+		return "", errDPoPNonce
+	}
+
+	// 同一公钥的 jti 在有效期内只能使用一次
+	sum := sha256.Sum256([]byte(jkt + "." + c.ID))
+	key := jtiPrefix + base64.RawURLEncoding.EncodeToString(sum[:])
+	if v, found := ctx.GetVar(dpopProofSlot{}); found && v.(string) == key { // 同一请求中已经验证过
+		return jkt, nil
+	}
+	n, err := d.cache.Counter(key, 0, 2*d.lifetime).Incr(1)
+	if err != nil {
+		return "", err
+	}
+	if n > 1 {
+		return "", errDPoPReplay
+	}
+	ctx.SetVar(dpopProofSlot{}, key)
+
+	return jkt, nil
+}
+
+// 根据错误信息输出相应的报头
+func (d *DPoP) setError(ctx *web.Context, err error) {
+	if err == errDPoPNonce {
+		nonce := mauth.RandString(16)
+		if err := d.cache.Set(noncePrefix+nonce, true, d.lifetime); err != nil {
+			ctx.Logs().ERROR().Error(err)
+		}
+		ctx.Header().Set(DPoPNonceHeader, nonce)
+		ctx.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+		return
+	}
+	ctx.Header().Set("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+}
+
+// 判断 htu 是否与请求的地址相同，忽略查询参数和片段。
+//
+// NOTE: 如果服务运行在反向代理之后，需要保证请求中的 Host 和 TLS 与客户端访问的地址一致。
+func matchHTU(htu string, r *http.Request) bool {
+	u, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return strings.EqualFold(u.Scheme, scheme) &&
+		strings.EqualFold(u.Host, r.Host) &&
+		u.Path == r.URL.Path
+}
+
+func jktOf(c Claims) string {
+	if cc, ok := c.(ConfirmationClaims); ok {
+		return cc.JKT()
+	}
+	return ""
+}
+
+// 将 claims 绑定到当前请求中已验证的 DPoP 公钥
+func setJKT(ctx *web.Context, claims Claims) {
+	if v, found := ctx.GetVar(dpopSlot{}); found {
+		if cc, ok := claims.(ConfirmationClaims); ok {
+			cc.SetJKT(v.(string))
+		}
+	}
+}
+
+// SetDPoP 启用 DPoP 验证
+//
+// 设置之后，同时接受以 DPoP 为前缀的 Authorization 报头，且不受 [Verifier.SetExtractors] 的影响。
+// 绑定了公钥的令牌只能以 DPoP 的方式提交，且需要同时提交有效的 DPoP 证明；
+// 未绑定的令牌依然按 Bearer 令牌处理。
+func (j *Verifier[T]) SetDPoP(d *DPoP) {
+	if d == nil {
+		panic("参数 d 不能为空")
+	}
+
+	j.dpop = d
+}
+
+// SetDPoP 启用 DPoP 验证
+//
+// 相当于调用 [Verifier.SetDPoP]，签发时的绑定由 [DPoP.Middleware] 决定。
+func (j *JWT[T]) SetDPoP(d *DPoP) { j.v.SetDPoP(d) }
+
+// 验证令牌的 DPoP 绑定
+//
+// refresh 表示是否为刷新令牌的请求，此时的证明是提交给令牌接口的，不需要包含 ath 声明。
+func (j *Verifier[T]) checkDPoP(ctx *web.Context, token string, claims T, refresh bool) web.Responser {
+	jkt := jktOf(claims)
+	if jkt == "" {
+		return nil
+	}
+
+	if j.dpop == nil {
+		return j.fail(ctx, ReasonInvalidDPoP, errInvalidDPoP)
+	}
+
+	h := ctx.Request().Header.Get(mauth.AuthorizationHeader)
+	if len(h) <= len(dpopPrefix) || strings.ToLower(h[:len(dpopPrefix)]) != dpopPrefix { // 不能以 Bearer 的方式提交
+		j.dpop.setError(ctx, errInvalidDPoP)
+		return j.fail(ctx, ReasonInvalidDPoP, errInvalidDPoP)
+	}
+
+	ath := token
+	if refresh {
+		ath = ""
+	}
+	proofJKT, err := j.dpop.verify(ctx, ath)
+	if err == nil && proofJKT != jkt {
+		err = errInvalidDPoP
+	}
+	if err != nil {
+		j.dpop.setError(ctx, err)
+		return j.fail(ctx, ReasonInvalidDPoP, err)
+	}
+
+	ctx.SetVar(dpopSlot{}, jkt) // 刷新令牌时，新的令牌依然绑定到同一公钥。
+	return nil
+}
@@ -0,0 +1,283 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+)
+
+var _ ConfirmationClaims = &UserClaims[int64, struct{}]{}
+
+type dpopProof struct {
+	key    *ecdsa.PrivateKey
+	typ    string
+	method string
+	htu    string
+	token  string
+	nonce  string
+	iat    time.Time
+	jti    string
+}
+
+func newDPoPKey(a *assert.Assertion) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	k, err := jwk.FromPublicKey("", "", &key.PublicKey)
+	a.NotError(err)
+	jkt, err := k.Thumbprint()
+	a.NotError(err)
+	return key, jkt
+}
+
+func (p *dpopProof) sign(a *assert.Assertion) string {
+	k, err := jwk.FromPublicKey("", "", &p.key.PublicKey)
+	a.NotError(err)
+	k.Use = ""
+
+	c := &dpopClaims{HTM: p.method, HTU: p.htu, Nonce: p.nonce}
+	c.ID = p.jti
+	if c.ID == "" {
+		c.ID = mauth.RandString(16)
+	}
+	if p.iat.IsZero() {
+		p.iat = time.Now()
+	}
+	c.IssuedAt = jwt.NewNumericDate(p.iat)
+	if p.token != "" {
+		sum := sha256.Sum256([]byte(p.token))
+		c.ATH = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, c)
+	t.Header["typ"] = p.typ
+	if t.Header["typ"] == "" {
+		t.Header["typ"] = dpopType
+	}
+	t.Header["jwk"] = k
+	proof, err := t.SignedString(p.key)
+	a.NotError(err)
+	return proof
+}
+
+func TestNewDPoP(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+
+	a.PanicString(func() {
+		NewDPoP(s, "dpop_", 0, false)
+	}, "参数 lifetime 必须大于 0")
+
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+	a.PanicString(func() {
+		j.SetDPoP(nil)
+	}, "参数 d 不能为空")
+}
+
+func TestMatchHTU(t *testing.T) {
+	a := assert.New(t, false)
+
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/path?q=1", nil)
+	a.NotError(err)
+	a.True(matchHTU("http://example.com/path", r)).
+		True(matchHTU("HTTP://EXAMPLE.com/path?x=1#f", r)).
+		False(matchHTU("https://example.com/path", r)).
+		False(matchHTU("http://example.org/path", r)).
+		False(matchHTU("http://example.com/other", r)).
+		False(matchHTU("::", r))
+}
+
+func TestJWT_DPoP(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := NewCacheBlocker[*userClaims](s, "test_", time.Hour, 2*time.Hour)
+	j := New(b, func() *userClaims { return &userClaims{} }, time.Hour, 2*time.Hour, nil)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	d := NewDPoP(s, "dpop_", time.Minute, false)
+	j.SetDPoP(d)
+	j.v.SetExtractors(defaultExtractor()) // 不影响 DPoP 令牌的提取
+
+	r := s.Routers().New("def", nil)
+	r.Post("/login", d.Middleware(func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, NewUserClaims[int64](1, &userPayload{}))
+	}))
+	// 同一请求中的证明会被验证两次
+	r.Post("/refresh", d.Middleware(j.VerifiyRefresh(func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, NewUserClaims[int64](1, &userPayload{}))
+	})))
+	r.Get("/info", j.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	key, jkt := newDPoPKey(a)
+	other, _ := newDPoPKey(a)
+
+	const (
+		loginURL   = "http://localhost:8080/login"
+		refreshURL = "http://localhost:8080/refresh"
+		infoURL    = "http://localhost:8080/info"
+	)
+
+	parse := func(token string) *userClaims {
+		c := &userClaims{}
+		_, _, err := jwt.NewParser().ParseUnverified(token, c)
+		a.NotError(err)
+		return c
+	}
+
+	// 缺少证明
+	servertest.Post(a, loginURL, nil).
+		Do(nil).
+		Status(http.StatusBadRequest).
+		Header("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+
+	login := func() *Response {
+		resp := &Response{}
+		servertest.Post(a, loginURL, nil).
+			Header(DPoPHeader, (&dpopProof{key: key, method: http.MethodPost, htu: loginURL}).sign(a)).
+			Do(nil).
+			Status(http.StatusCreated).
+			BodyFunc(func(a *assert.Assertion, body []byte) {
+				a.NotError(json.Unmarshal(body, resp))
+			})
+		return resp
+	}
+
+	resp := login()
+	a.Equal(parse(resp.Access).JKT(), jkt).
+		Equal(parse(resp.Refresh).JKT(), jkt)
+
+	get := func(scheme, token, proof string, status int, msg string) {
+		a.TB().Helper()
+		req := servertest.Get(a, infoURL).Header(mauth.AuthorizationHeader, scheme+" "+token)
+		if proof != "" {
+			req.Header(DPoPHeader, proof)
+		}
+		req.Do(nil).Status(status, msg)
+	}
+
+	proof := (&dpopProof{key: key, method: http.MethodGet, htu: infoURL, token: resp.Access}).sign(a)
+	get("DPoP", resp.Access, proof, http.StatusNoContent, "valid")
+	get("DPoP", resp.Access, proof, http.StatusUnauthorized, "replay")
+
+	proof = (&dpopProof{key: key, method: http.MethodGet, htu: infoURL, token: resp.Access}).sign(a)
+	get("Bearer", resp.Access, proof, http.StatusUnauthorized, "bearer")
+	get("DPoP", resp.Access, "", http.StatusUnauthorized, "no proof")
+
+	invalid := map[string]*dpopProof{
+		"other key": {key: other, method: http.MethodGet, htu: infoURL, token: resp.Access},
+		"htm":       {key: key, method: http.MethodPost, htu: infoURL, token: resp.Access},
+		"htu":       {key: key, method: http.MethodGet, htu: "http://localhost:8080/other", token: resp.Access},
+		"ath":       {key: key, method: http.MethodGet, htu: infoURL, token: resp.Refresh},
+		"no ath":    {key: key, method: http.MethodGet, htu: infoURL},
+		"iat":       {key: key, method: http.MethodGet, htu: infoURL, token: resp.Access, iat: time.Now().Add(-time.Hour)},
+		"typ":       {key: key, method: http.MethodGet, htu: infoURL, token: resp.Access, typ: "JWT"},
+	}
+	for name, p := range invalid {
+		get("DPoP", resp.Access, p.sign(a), http.StatusUnauthorized, name)
+	}
+
+	// HMAC 签名的证明
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, &dpopClaims{HTM: http.MethodGet, HTU: infoURL})
+	hs.Header["typ"] = dpopType
+	hs.Header["jwk"] = &jwk.Key{Kty: "oct", K: "c2VjcmV0"}
+	hsProof, err := hs.SignedString([]byte("secret"))
+	a.NotError(err)
+	get("DPoP", resp.Access, hsProof, http.StatusUnauthorized, "hmac")
+
+	// 未绑定的令牌依然可以作为 Bearer 令牌使用
+	unbound, err := j.Sign(NewUserClaims[int64](2, &userPayload{}))
+	a.NotError(err)
+	get("Bearer", unbound, "", http.StatusNoContent, "unbound")
+
+	// 刷新之后的令牌依然绑定到同一公钥，提交给刷新接口的证明不需要 ath。
+	resp2 := &Response{}
+	servertest.Post(a, refreshURL, nil).
+		Header(mauth.AuthorizationHeader, "DPoP "+resp.Refresh).
+		Header(DPoPHeader, (&dpopProof{key: key, method: http.MethodPost, htu: refreshURL}).sign(a)).
+		Do(nil).
+		Status(http.StatusCreated).
+		BodyFunc(func(a *assert.Assertion, body []byte) {
+			a.NotError(json.Unmarshal(body, resp2))
+		})
+	a.Equal(parse(resp2.Access).JKT(), jkt).
+		Equal(parse(resp2.Refresh).JKT(), jkt)
+
+	proof = (&dpopProof{key: key, method: http.MethodGet, htu: infoURL, token: resp2.Access}).sign(a)
+	get("DPoP", resp2.Access, proof, http.StatusNoContent, "refreshed")
+
+	// 未启用 DPoP 的 Verifier 不接受绑定的令牌
+	v := NewVerifier(b, func() *userClaims { return &userClaims{} })
+	v.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	r.Get("/plain", v.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+	servertest.Get(a, "http://localhost:8080/plain").
+		Header(mauth.AuthorizationHeader, "Bearer "+resp2.Access).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+}
+
+func TestDPoP_nonce(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	d := NewDPoP(s, "dpop_", time.Minute, true)
+	r := s.Routers().New("def", nil)
+	r.Post("/login", d.Middleware(func(ctx *web.Context) web.Responser {
+		v, found := ctx.GetVar(dpopSlot{})
+		if !found || v.(string) == "" {
+			return ctx.Problem(web.ProblemInternalServerError)
+		}
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	const loginURL = "http://localhost:8080/login"
+	key, _ := newDPoPKey(a)
+
+	servertest.Post(a, loginURL, nil).
+		Header(DPoPHeader, (&dpopProof{key: key, method: http.MethodPost, htu: loginURL}).sign(a)).
+		Do(nil).
+		Status(http.StatusBadRequest).
+		Header("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+	resp := servertest.Post(a, loginURL, nil).
+		Header(DPoPHeader, (&dpopProof{key: key, method: http.MethodPost, htu: loginURL, nonce: "invalid"}).sign(a)).
+		Do(nil).
+		Status(http.StatusBadRequest).
+		Resp()
+	nonce := resp.Header.Get(DPoPNonceHeader)
+	a.NotEmpty(nonce)
+
+	servertest.Post(a, loginURL, nil).
+		Header(DPoPHeader, (&dpopProof{key: key, method: http.MethodPost, htu: loginURL, nonce: nonce}).sign(a)).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	// nonce 可以多次使用，但是 jti 不能。
+	p := (&dpopProof{key: key, method: http.MethodPost, htu: loginURL, nonce: nonce}).sign(a)
+	servertest.Post(a, loginURL, nil).Header(DPoPHeader, p).Do(nil).Status(http.StatusNoContent)
+	servertest.Post(a, loginURL, nil).Header(DPoPHeader, p).Do(nil).Status(http.StatusBadRequest)
+}
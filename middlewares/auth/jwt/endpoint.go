@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+// token_type_hint 的可选值
+const (
+	HintAccessToken  = "access_token"
+	HintRefreshToken = "refresh_token"
+)
+
+type (
+	// IntrospectFunc 向内省接口的返回数据中添加额外的字段
+	//
+	// 仅在令牌处于活动状态时才会调用，exp、iat、nbf、sub、aud、iss 和 token_type 已经由 claims 填充，
+	// 可以在此函数中设置 scope、client_id、username 和 jti 等字段。
+	IntrospectFunc[T Claims] func(claims T, resp *auth.IntrospectionResponse)
+
+	// ClientFunc 判断令牌是否签发给当前请求的客户端
+	//
+	// ctx 为已经通过客户端验证的请求，可以从中获取客户端的信息。
+	ClientFunc[T Claims] func(ctx *web.Context, claims T) bool
+
+	// 吊销和内省接口的错误信息
+	endpointError struct {
+		XMLName struct{} `json:"-" xml:"error"`
+		Error   string   `json:"error" xml:",chardata"`
+	}
+)
+
+// Revocation 令牌吊销接口
+//
+// 实现了 [RFC7009]，以 application/x-www-form-urlencoded 的方式提交 token 和 token_type_hint。
+// 吊销刷新令牌时，会同时吊销其关联的令牌，如果 [Blocker] 实现了 [FamilyBlocker]，
+// 还会吊销该刷新令牌所属的整个家族。
+// 无效的令牌同样返回 200，token_type_hint 仅支持 [HintAccessToken] 和 [HintRefreshToken]。
+//
+// client 用于验证客户端的身份，可以是任意的 [auth.Auth] 实现；
+// owns 判断令牌是否签发给该客户端，不是则直接返回 200 而不吊销，为空表示不作判断；
+//
+// [RFC7009]: https://datatracker.ietf.org/doc/html/rfc7009
+func (j *Verifier[T]) Revocation(client web.Middleware, owns ClientFunc[T]) web.HandlerFunc {
+	if client == nil {
+		panic("参数 client 不能为空")
+	}
+
+	return client.Middleware(func(ctx *web.Context) web.Responser {
+		token, resp := endpointToken(ctx)
+		if resp != nil {
+			return resp
+		}
+
+		switch ctx.Request().PostFormValue("token_type_hint") {
+		case "", HintAccessToken, HintRefreshToken:
+		default:
+			return web.Response(http.StatusBadRequest, &endpointError{Error: "unsupported_token_type"})
+		}
+
+		if j.blocker.TokenIsBlocked(token) {
+			return web.OK(nil)
+		}
+
+		claims, err := j.parse(token)
+		if err != nil { // 无效的令牌不需要吊销
+			ctx.Logs().DEBUG().Error(err)
+			return web.OK(nil)
+		}
+
+		// https://datatracker.ietf.org/doc/html/rfc7009#section-2.1
+		if owns != nil && !owns(ctx, claims) {
+			ctx.Logs().DEBUG().LocaleString(web.Phrase("token was not issued to the client"))
+			return web.OK(nil)
+		}
+
+		baseToken := claims.BaseToken()
+		if err := j.block(token, baseToken != ""); err != nil {
+			return ctx.Error(err, "")
+		}
+
+		if baseToken != "" {
+			if err := j.block(baseToken, false); err != nil {
+				return ctx.Error(err, "")
+			}
+
+			if fb, ok := j.blocker.(FamilyBlocker); ok {
+				if family := familyOf(claims); family != "" {
+					if err := fb.BlockFamily(family); err != nil {
+						return ctx.Error(err, "")
+					}
+				}
+			}
+		}
+
+		auth.Emit(ctx, j.sink, &auth.Event{Type: auth.EventLogout, Source: j.source, Info: claims})
+		return web.OK(nil)
+	})
+}
+
+// Introspection 令牌内省接口
+//
+// 实现了 [RFC7662]，以 application/x-www-form-urlencoded 的方式提交 token 和 token_type_hint，
+// 返回 [auth.IntrospectionResponse]。令牌无效、已过期或是已被吊销时，仅返回 {"active":false}。
+// token_type 根据令牌是否绑定了 DPoP 公钥返回 DPoP 或是 Bearer。
+//
+// client 用于验证资源服务器的身份，可以是任意的 [auth.Auth] 实现；
+// f 用于添加额外的字段，可以为空；
+//
+// [RFC7662]: https://datatracker.ietf.org/doc/html/rfc7662
+func (j *Verifier[T]) Introspection(client web.Middleware, f IntrospectFunc[T]) web.HandlerFunc {
+	if client == nil {
+		panic("参数 client 不能为空")
+	}
+
+	return client.Middleware(func(ctx *web.Context) web.Responser {
+		token, resp := endpointToken(ctx)
+		if resp != nil {
+			return resp
+		}
+
+		ctx.Header().Set("Cache-Control", "no-store")
+
+		claims, active := j.active(ctx, token)
+		if !active {
+			return web.OK(&auth.IntrospectionResponse{})
+		}
+
+		r := &auth.IntrospectionResponse{Active: true, TokenType: "Bearer"}
+		if jktOf(claims) != "" {
+			r.TokenType = "DPoP"
+		}
+		if t, err := claims.GetExpirationTime(); err == nil && t != nil {
+			r.Exp = t.Unix()
+		}
+		if t, err := claims.GetIssuedAt(); err == nil && t != nil {
+			r.Iat = t.Unix()
+		}
+		if t, err := claims.GetNotBefore(); err == nil && t != nil {
+			r.Nbf = t.Unix()
+		}
+		r.Sub, _ = claims.GetSubject()
+		r.Iss, _ = claims.GetIssuer()
+		r.Aud, _ = claims.GetAudience()
+
+		if f != nil {
+			f(claims, r)
+		}
+		return web.OK(r)
+	})
+}
+
+// 令牌是否处于活动状态
+func (j *Verifier[T]) active(ctx *web.Context, token string) (T, bool) {
+	var zero T
+
+	if j.blocker.TokenIsBlocked(token) {
+		return zero, false
+	}
+
+	claims, err := j.parse(token)
+	if err != nil {
+		ctx.Logs().DEBUG().Error(err)
+		return zero, false
+	}
+
+	if j.blocker.ClaimsIsBlocked(claims) || j.familyIsBlocked(claims) {
+		return zero, false
+	}
+	return claims, true
+}
+
+// 从表单中获取 token 参数
+func endpointToken(ctx *web.Context) (string, web.Responser) {
+	token := ctx.Request().PostFormValue("token")
+	if token == "" {
+		return "", web.Response(http.StatusBadRequest, &endpointError{Error: "invalid_request"})
+	}
+	return token, nil
+}
+
+// Revocation 令牌吊销接口
+//
+// 参考 [Verifier.Revocation]。
+func (j *JWT[T]) Revocation(client web.Middleware, owns ClientFunc[T]) web.HandlerFunc {
+	return j.v.Revocation(client, owns)
+}
+
+// Introspection 令牌内省接口
+//
+// 参考 [Verifier.Introspection]。
+func (j *JWT[T]) Introspection(client web.Middleware, f IntrospectFunc[T]) web.HandlerFunc {
+	return j.v.Introspection(client, f)
+}
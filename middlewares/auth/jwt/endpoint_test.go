@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+	"github.com/issue9/webuse/v7/middlewares/auth/basic"
+)
+
+func TestJWT_endpoints(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := NewCacheBlocker[*userClaims](s, "test_", time.Hour, 2*time.Hour)
+	j := New(b, func() *userClaims { return &userClaims{} }, time.Hour, 2*time.Hour, nil)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	client := basic.New(s, func(u, p []byte) (string, bool) {
+		return string(u), (string(u) == "client" || string(u) == "other") && string(p) == "secret"
+	}, "", false)
+
+	a.PanicString(func() {
+		j.Revocation(nil, nil)
+	}, "参数 client 不能为空")
+	a.PanicString(func() {
+		j.Introspection(nil, nil)
+	}, "参数 client 不能为空")
+
+	r := s.Routers().New("def", nil)
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		c := NewUserClaims(int64(1), &userPayload{Tenant: "t1"})
+		c.Issuer = "issuer"
+		c.Audience = jwt.ClaimStrings{"api"}
+		return j.Render(ctx, http.StatusCreated, c)
+	})
+	r.Post("/revoke", j.Revocation(client, func(ctx *web.Context, c *userClaims) bool {
+		id, _ := client.GetInfo(ctx)
+		return id == "client"
+	}))
+	r.Post("/introspect", j.Introspection(client, func(c *userClaims, resp *auth.IntrospectionResponse) {
+		resp.Jti = c.ID
+		resp.Username = c.Payload.Tenant
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	post := func(path, auth string, form url.Values) (status int, body []byte) {
+		resp := servertest.Post(a, "http://localhost:8080"+path, []byte(form.Encode())).
+			Header("Content-Type", "application/x-www-form-urlencoded").
+			Header("Accept", "application/json").
+			Header("Authorization", auth).
+			Do(nil).
+			BodyFunc(func(_ *assert.Assertion, b []byte) { body = b })
+		return resp.Resp().StatusCode, body
+	}
+	credential := "Basic " + base64.StdEncoding.EncodeToString([]byte("client:secret"))
+
+	introspectToken := func(token string) *auth.IntrospectionResponse {
+		status, body := post("/introspect", credential, url.Values{"token": {token}})
+		a.Equal(status, http.StatusOK)
+		resp := &auth.IntrospectionResponse{}
+		a.NotError(json.Unmarshal(body, resp))
+		return resp
+	}
+
+	login := func() *Response {
+		resp := &Response{}
+		servertest.Post(a, "http://localhost:8080/login", nil).
+			Header("Accept", "application/json").
+			Do(nil).
+			Status(http.StatusCreated).
+			BodyFunc(func(a *assert.Assertion, body []byte) {
+				a.NotError(json.Unmarshal(body, resp)).NotEmpty(resp.Refresh)
+			})
+		return resp
+	}
+	tokens := login()
+
+	// 客户端验证失败
+	status, _ := post("/introspect", "", url.Values{"token": {tokens.Access}})
+	a.Equal(status, http.StatusUnauthorized)
+	status, _ = post("/revoke", "Basic "+base64.StdEncoding.EncodeToString([]byte("client:x")), url.Values{"token": {tokens.Access}})
+	a.Equal(status, http.StatusUnauthorized)
+
+	// 缺少 token 参数
+	status, body := post("/introspect", credential, url.Values{})
+	a.Equal(status, http.StatusBadRequest).Contains(string(body), "invalid_request")
+	status, body = post("/revoke", credential, url.Values{})
+	a.Equal(status, http.StatusBadRequest).Contains(string(body), "invalid_request")
+
+	resp := introspectToken(tokens.Access)
+	a.True(resp.Active).
+		Equal(resp.TokenType, "Bearer").
+		Equal(resp.Sub, "1").
+		Equal(resp.Iss, "issuer").
+		Equal(resp.Aud, jwt.ClaimStrings{"api"}).
+		Equal(resp.Username, "t1").
+		NotEmpty(resp.Jti).
+		True(resp.Exp > resp.Iat).
+		Zero(resp.Nbf)
+	a.True(introspectToken(tokens.Refresh).Active)
+
+	// 无效的令牌
+	resp = introspectToken("invalid")
+	a.False(resp.Active).Empty(resp.Sub).Zero(resp.Exp)
+	status, _ = post("/revoke", credential, url.Values{"token": {"invalid"}})
+	a.Equal(status, http.StatusOK)
+
+	// 不支持的 token_type_hint
+	status, body = post("/revoke", credential, url.Values{"token": {tokens.Access}, "token_type_hint": {"id_token"}})
+	a.Equal(status, http.StatusBadRequest).Contains(string(body), "unsupported_token_type")
+	a.True(introspectToken(tokens.Access).Active)
+
+	// 令牌不属于该客户端
+	other := "Basic " + base64.StdEncoding.EncodeToString([]byte("other:secret"))
+	status, _ = post("/revoke", other, url.Values{"token": {tokens.Access}})
+	a.Equal(status, http.StatusOK)
+	a.True(introspectToken(tokens.Access).Active)
+
+	// 吊销普通令牌，刷新令牌依然有效。
+	status, _ = post("/revoke", credential, url.Values{"token": {tokens.Access}, "token_type_hint": {HintAccessToken}})
+	a.Equal(status, http.StatusOK)
+	a.False(introspectToken(tokens.Access).Active).
+		True(introspectToken(tokens.Refresh).Active)
+
+	// 重复吊销
+	status, _ = post("/revoke", credential, url.Values{"token": {tokens.Access}})
+	a.Equal(status, http.StatusOK)
+
+	// 吊销刷新令牌，关联的令牌以及同一家族的令牌都失效。
+	tokens = login()
+	c, err := j.v.parse(tokens.Access)
+	a.NotError(err)
+	sibling := NewUserClaims(int64(1), &userPayload{})
+	sibling.Fam = c.Fam
+	siblingToken, err := j.Sign(sibling)
+	a.NotError(err)
+	a.True(introspectToken(siblingToken).Active)
+
+	status, _ = post("/revoke", credential, url.Values{"token": {tokens.Refresh}, "token_type_hint": {HintRefreshToken}})
+	a.Equal(status, http.StatusOK)
+	a.False(introspectToken(tokens.Refresh).Active).
+		False(introspectToken(tokens.Access).Active).
+		False(introspectToken(siblingToken).Active)
+}
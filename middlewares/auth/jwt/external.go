@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+)
+
+type (
+	// ContextSigner 支持 [context.Context] 的 [crypto.Signer]
+	//
+	// 对于 HSM 或是 KMS 等远程的签名服务，可以实现此接口以支持超时和取消。
+	ContextSigner interface {
+		crypto.Signer
+
+		// SignContext 与 [crypto.Signer.Sign] 相同，但是可以通过 ctx 取消操作。
+		SignContext(ctx context.Context, rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+	}
+
+	// 外部签名服务返回的错误
+	signError struct {
+		id  string
+		err error
+	}
+)
+
+var errInvalidECDSASignature = web.NewLocaleError("invalid ecdsa signature")
+
+func (e *signError) Error() string { return "jwt: external signer " + e.id + ": " + e.err.Error() }
+
+func (e *signError) Unwrap() error { return e.err }
+
+// 是否为由外部签名的密钥
+//
+// 标准库中的私钥由 golang-jwt 直接签名，其它的 [crypto.Signer] 实现均视为外部的签名服务。
+func isExternal(k any) bool {
+	switch k.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey, []byte:
+		return false
+	default:
+		_, ok := k.(crypto.Signer)
+		return ok
+	}
+}
+
+// AddSigner 添加由外部签名的密钥
+//
+// signer 可以是 HSM、KMS 等签名服务的 [crypto.Signer] 实现，私钥不需要加载到当前进程。
+// 如果 signer 实现了 [ContextSigner]，在 [Signer.Render] 中会传递请求的 [context.Context]。
+// sign 可以是 RSA、RSA-PSS、ECDSA 和 Ed25519 算法，且需要与 signer.Public() 相匹配。
+func (s *Signer) AddSigner(id string, sign SigningMethod, signer crypto.Signer) error {
+	if signer == nil {
+		panic("参数 signer 不能为空")
+	}
+	return s.AddKey(id, sign, signer)
+}
+
+// AddSigner 添加由外部签名的密钥
+//
+// [Verifier] 采用 signer.Public() 作为公钥，其它参数可参考 [Signer.AddSigner]。
+func (j *JWT[T]) AddSigner(id string, sign SigningMethod, signer crypto.Signer) error {
+	if signer == nil {
+		panic("参数 signer 不能为空")
+	}
+	return j.AddKey(id, sign, signer.Public(), signer)
+}
+
+// 签名失败时的返回对象
+//
+// 外部签名服务出错时返回 503，其它错误返回 500。
+func signFailed(ctx *web.Context, err error) web.Responser {
+	var se *signError
+	if errors.As(err, &se) {
+		return ctx.Error(err, web.ProblemServiceUnavailable)
+	}
+	return ctx.Error(err, "")
+}
+
+// 对令牌 t 进行签名
+func signToken(ctx context.Context, t *jwt.Token, k *key) (string, error) {
+	if !isExternal(k.key) {
+		return t.SignedString(k.key)
+	}
+
+	ss, err := t.SigningString()
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := externalSign(ctx, k.sign, k.key.(crypto.Signer), []byte(ss))
+	if err != nil {
+		return "", &signError{id: k.id.(string), err: err}
+	}
+	return ss + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// 采用外部的 signer 对 data 进行签名，返回 JWS 格式的签名内容。
+func externalSign(ctx context.Context, sign SigningMethod, signer crypto.Signer, data []byte) ([]byte, error) {
+	var opts crypto.SignerOpts
+	switch m := sign.(type) {
+	case *jwt.SigningMethodRSA:
+		opts = m.Hash
+	case *jwt.SigningMethodRSAPSS:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: m.Hash}
+	case *jwt.SigningMethodECDSA:
+		opts = m.Hash
+	case *jwt.SigningMethodEd25519:
+		opts = crypto.Hash(0) // Ed25519 对原始内容签名
+	default:
+		return nil, jwt.ErrInvalidKeyType
+	}
+
+	digest := data
+	if h := opts.HashFunc(); h != 0 {
+		hasher := h.New()
+		hasher.Write(data)
+		digest = hasher.Sum(nil)
+	}
+
+	var sig []byte
+	var err error
+	if cs, ok := signer.(ContextSigner); ok {
+		sig, err = cs.SignContext(ctx, rand.Reader, digest, opts)
+	} else if err = ctx.Err(); err == nil {
+		sig, err = signer.Sign(rand.Reader, digest, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := sign.(*jwt.SigningMethodECDSA); ok { // ASN.1 转换为 JWS 要求的 r||s 格式
+		return ecdsaJWS(sig, (m.CurveBits+7)/8)
+	}
+	return sig, nil
+}
+
+func ecdsaJWS(der []byte, size int) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 || sig.R == nil || sig.S == nil || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 ||
+		sig.R.BitLen() > size*8 || sig.S.BitLen() > size*8 {
+		return nil, errInvalidECDSASignature
+	}
+
+	out := make([]byte, 2*size)
+	sig.R.FillBytes(out[:size])
+	sig.S.FillBytes(out[size:])
+	return out, nil
+}
@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+)
+
+var _ ContextSigner = &contextSigner{}
+
+// 模拟外部的签名服务
+type localSigner struct {
+	s     crypto.Signer
+	calls atomic.Int64
+	fail  atomic.Bool
+}
+
+func (s *localSigner) Public() crypto.PublicKey { return s.s.Public() }
+
+func (s *localSigner) Sign(r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls.Add(1)
+	if s.fail.Load() {
+		return nil, errors.New("kms unavailable")
+	}
+	return s.s.Sign(r, digest, opts)
+}
+
+type contextSigner struct {
+	localSigner
+}
+
+func (s *contextSigner) SignContext(ctx context.Context, r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.Sign(r, digest, opts)
+}
+
+func TestJWT_AddSigner(t *testing.T) {
+	a := assert.New(t, false)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NotError(err)
+	ec256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	ec384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	a.NotError(err)
+	ec521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	a.NotError(err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+
+	signers := map[SigningMethod]crypto.Signer{
+		jwt.SigningMethodRS256: rsaKey,
+		jwt.SigningMethodRS512: rsaKey,
+		jwt.SigningMethodPS256: rsaKey,
+		jwt.SigningMethodPS384: rsaKey,
+		jwt.SigningMethodES256: ec256,
+		jwt.SigningMethodES384: ec384,
+		jwt.SigningMethodES512: ec521,
+		jwt.SigningMethodEdDSA: edKey,
+	}
+
+	for sign, key := range signers {
+		_, j := newJWT(a, time.Hour, 2*time.Hour)
+		j.SetInterop(true)
+		ls := &localSigner{s: key}
+		a.NotError(j.AddSigner("ext", sign, ls), sign.Alg()).
+			True(isExternal(j.s.findKey("ext").key))
+
+		token, err := j.Sign(&testClaims{ID: 1})
+		a.NotError(err, sign.Alg()).Equal(ls.calls.Load(), 1, sign.Alg())
+
+		c, err := j.v.parse(token)
+		a.NotError(err, sign.Alg()).Equal(c.ID, 1)
+
+		// 第三方库同样可以验证
+		tk, err := jwt.ParseWithClaims(token, &testClaims{}, func(*jwt.Token) (any, error) { return key.Public(), nil })
+		a.NotError(err, sign.Alg()).True(tk.Valid).Equal(tk.Method, sign)
+	}
+
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+	a.Error(j.AddSigner("ext", jwt.SigningMethodES384, &localSigner{s: ec256})).
+		Error(j.AddSigner("ext", jwt.SigningMethodRS256, &localSigner{s: ec256})).
+		Error(j.AddSigner("ext", jwt.SigningMethodHS256, &localSigner{s: ec256}))
+	a.PanicString(func() {
+		j.AddSigner("ext", jwt.SigningMethodES256, nil)
+	}, "参数 signer 不能为空")
+
+	s := NewSigner(time.Hour, 0, nil)
+	a.NotError(s.AddSigner("ext", jwt.SigningMethodES256, &localSigner{s: ec256}))
+	a.PanicString(func() {
+		s.AddSigner("nil", jwt.SigningMethodES256, nil)
+	}, "参数 signer 不能为空")
+
+	a.False(isExternal(rsaKey)).
+		False(isExternal(ec256)).
+		False(isExternal(edKey)).
+		False(isExternal([]byte("secret")))
+}
+
+func TestSigner_SignContext(t *testing.T) {
+	a := assert.New(t, false)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+	cs := &contextSigner{localSigner: localSigner{s: key}}
+	a.NotError(j.AddSigner("ext", jwt.SigningMethodES256, cs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	token, err := j.SignContext(ctx, &testClaims{ID: 1})
+	a.NotError(err).NotEmpty(token)
+
+	cancel()
+	token, err = j.SignContext(ctx, &testClaims{ID: 1})
+	a.ErrorIs(err, context.Canceled).Empty(token)
+	var se *signError
+	a.True(errors.As(err, &se)).Equal(se.id, "ext")
+
+	// 未实现 ContextSigner 也会检测 ctx
+	_, j = newJWT(a, time.Hour, 2*time.Hour)
+	ls := &localSigner{s: key}
+	a.NotError(j.AddSigner("ext", jwt.SigningMethodES256, ls))
+	_, err = j.SignContext(ctx, &testClaims{ID: 1})
+	a.ErrorIs(err, context.Canceled).Equal(ls.calls.Load(), 0)
+
+	// 标准库的私钥不受影响
+	_, j = newJWT(a, time.Hour, 2*time.Hour)
+	a.NotError(j.AddKey("ec", jwt.SigningMethodES256, nil, key))
+	_, err = j.SignContext(ctx, &testClaims{ID: 1})
+	a.NotError(err)
+}
+
+func TestSigner_Render_external(t *testing.T) {
+	a := assert.New(t, false)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	ls := &localSigner{s: key}
+
+	s, j := newJWT(a, time.Hour, 2*time.Hour)
+	a.NotError(j.AddSigner("ext", jwt.SigningMethodES256, ls))
+
+	r := s.Routers().New("def", nil)
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, &testClaims{ID: 1, Created: ctx.Begin()})
+	})
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	servertest.Post(a, "http://localhost:8080/login", nil).Do(nil).Status(http.StatusCreated)
+	a.Equal(ls.calls.Load(), 2) // 访问令牌和刷新令牌
+
+	ls.fail.Store(true)
+	servertest.Post(a, "http://localhost:8080/login", nil).Do(nil).Status(http.StatusServiceUnavailable)
+}
+
+func TestECDSAJWS(t *testing.T) {
+	a := assert.New(t, false)
+
+	sig, err := ecdsaJWS([]byte("invalid"), 32)
+	a.Error(err).Nil(sig)
+
+	// r 超出长度
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{R: new(big.Int).Lsh(big.NewInt(1), 300), S: big.NewInt(1)})
+	a.NotError(err)
+	sig, err = ecdsaJWS(der, 32)
+	a.Equal(err, errInvalidECDSASignature).Nil(sig)
+
+	der, err = asn1.Marshal(struct{ R, S *big.Int }{R: big.NewInt(1), S: big.NewInt(2)})
+	a.NotError(err)
+	sig, err = ecdsaJWS(der, 32)
+	a.NotError(err).Length(sig, 64).Equal(sig[31], 1).Equal(sig[63], 2)
+}
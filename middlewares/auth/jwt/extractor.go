@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+// Extractor 从请求中提取令牌
+//
+// 返回空值表示未找到令牌。
+type Extractor func(*web.Context) string
+
+// 保存当前请求所使用的令牌
+type tokenSlot struct{ owner any }
+
+// HeaderExtractor 从报头中提取令牌
+//
+// header 为报头名称；prefix 为报头内容的前缀，不区分大小写，比如 Bearer 加空格；
+func HeaderExtractor(header, prefix string) Extractor {
+	prefix = strings.ToLower(prefix)
+	return func(ctx *web.Context) string {
+		if ctx.Request().Header.Get(header) == "" {
+			return ""
+		}
+		return auth.GetToken(ctx, prefix, header)
+	}
+}
+
+// CookieExtractor 从 cookie 中提取令牌
+func CookieExtractor(name string) Extractor {
+	return func(ctx *web.Context) string {
+		if c, err := ctx.Request().Cookie(name); err == nil {
+			return c.Value
+		}
+		return ""
+	}
+}
+
+// QueryExtractor 从查询参数中提取令牌
+//
+// 仅对 routes 中列出的路由有效，routes 为路由的匹配模式，比如 /events/{id}。
+// 主要用于 SSE 和 WebSocket 等无法自定义报头的场景。
+//
+// NOTE: 查询参数可能会被记录在访问日志或是浏览器历史中，应该仅用于有效期较短的令牌。
+func QueryExtractor(name string, routes ...string) Extractor {
+	if len(routes) == 0 {
+		panic("参数 routes 不能为空")
+	}
+
+	return func(ctx *web.Context) string {
+		if slices.Index(routes, ctx.Route().Node().Pattern()) < 0 {
+			return ""
+		}
+		return ctx.Request().URL.Query().Get(name)
+	}
+}
+
+// 默认的提取方式，即从 Authorization 报头中提取 Bearer 令牌。
+func defaultExtractor() Extractor { return HeaderExtractor(mauth.AuthorizationHeader, prefix) }
+
+// SetExtractors 指定提取令牌的方式
+//
+// 按顺序依次尝试，直到找到令牌为止。默认仅从 Authorization 报头中提取 Bearer 令牌。
+func (j *Verifier[T]) SetExtractors(e ...Extractor) {
+	if len(e) == 0 {
+		panic("参数 e 不能为空")
+	}
+	j.extractors = e
+}
+
+// 从请求中提取令牌
+//
+// 如果之前已经提取过，则直接返回之前的值，保证同一请求的 [Verifier.Logout] 拉黑的是实际使用的令牌。
+// 如果通过 [Verifier.SetCookie] 指定了 cookie，则优先从 cookie 中提取，refresh 表示提取刷新令牌；
+// 其次是启用了 [Verifier.SetDPoP] 之后的 DPoP 令牌。
+func (j *Verifier[T]) extract(ctx *web.Context, refresh bool) string {
+	if v, found := ctx.GetVar(tokenSlot{j}); found {
+		return v.(string)
+	}
+
+	if j.cookie != nil {
+		if token := j.cookie.token(ctx, refresh); token != "" {
+			ctx.SetVar(tokenSlot{j}, token)
+			return token
+		}
+	}
+
+	if j.dpop != nil {
+		if token := dpopExtractor(ctx); token != "" {
+			ctx.SetVar(tokenSlot{j}, token)
+			return token
+		}
+	}
+
+	for _, e := range j.extractors {
+		if token := e(ctx); token != "" {
+			ctx.SetVar(tokenSlot{j}, token)
+			return token
+		}
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+)
+
+func TestVerifier_SetExtractors(t *testing.T) {
+	a := assert.New(t, false)
+	s, j := newJWT(a, time.Hour, 2*time.Hour)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	a.PanicString(func() {
+		j.SetExtractors()
+	}, "参数 e 不能为空")
+
+	a.PanicString(func() {
+		QueryExtractor("token")
+	}, "参数 routes 不能为空")
+
+	j.SetExtractors(
+		HeaderExtractor(mauth.AuthorizationHeader, "Bearer "),
+		CookieExtractor("token"),
+		QueryExtractor("token", "/events"),
+	)
+
+	ok := func(*web.Context) web.Responser { return web.NoContent() }
+	r := s.Routers().New("def", nil)
+	r.Get("/info", j.Middleware(ok))
+	r.Get("/events", j.Middleware(ok))
+	r.Delete("/login", j.Middleware(func(ctx *web.Context) web.Responser {
+		if err := j.Logout(ctx); err != nil {
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	token, err := j.Sign(&testClaims{ID: 1})
+	a.NotError(err)
+	cookie := &http.Cookie{Name: "token", Value: token}
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Cookie(cookie).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	// 查询参数仅对指定的路由有效
+	servertest.Get(a, "http://localhost:8080/info?token="+token).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+	servertest.Get(a, "http://localhost:8080/events?token="+token).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	// 报头优先，无效的报头不会再尝试 cookie。
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer invalid").
+		Cookie(cookie).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	// 通过 cookie 退出，所有方式提交的令牌都将失效。
+	servertest.Delete(a, "http://localhost:8080/login").
+		Cookie(cookie).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+	servertest.Get(a, "http://localhost:8080/events?token="+token).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+}
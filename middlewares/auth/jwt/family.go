@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+const (
+	familyPrefix = "family_"
+	usedPrefix   = "used_" // 已经使用过的刷新令牌
+)
+
+type (
+	// FamilyClaims 支持刷新令牌家族的 [Claims]
+	//
+	// 由同一次登录以及之后的刷新所签发的令牌属于同一家族，
+	// 当已经使用过的刷新令牌再次被提交时，表示刷新令牌可能已经泄漏，
+	// 此时会通过 [FamilyBlocker] 吊销整个家族的令牌。
+	//
+	// NOTE: 客户端因网络问题重复提交同一刷新令牌也会导致整个家族被吊销。
+	FamilyClaims interface {
+		Claims
+
+		// Family 令牌所属的家族 ID
+		//
+		// 为空表示不属于任何家族。
+		Family() string
+
+		// SetFamily 设置家族 ID
+		//
+		// 由 [Signer.Render] 调用。
+		SetFamily(string)
+	}
+
+	// FamilyBlocker 支持吊销刷新令牌家族的 [Blocker]
+	FamilyBlocker interface {
+		// BlockFamily 吊销家族 family 下的所有令牌
+		BlockFamily(family string) error
+
+		// FamilyIsBlocked 家族 family 是否已经被吊销
+		FamilyIsBlocked(family string) bool
+
+		// UseRefresh 标记刷新令牌 token 已经被使用
+		//
+		// 返回值表示是否为首次使用，实现者需要保证该操作的原子性，
+		// 以保证并发提交的同一刷新令牌只有一个可以通过。
+		UseRefresh(token string) (bool, error)
+
+		// RefreshIsUsed 刷新令牌 token 是否已经通过 UseRefresh 使用过
+		//
+		// 用于区分因刷新而拉黑的令牌和因退出登录等原因拉黑的令牌，只有前者再次提交才算重复使用。
+		RefreshIsUsed(token string) bool
+	}
+
+	// 保存当前刷新令牌所属的家族 ID
+	familySlot struct{}
+)
+
+func (d *cacheBlocker[T]) BlockFamily(family string) error {
+	return d.setRevoked(familyPrefix + family) // 在家族的最后一个令牌过期之前都需要拉黑
+}
+
+func (d *cacheBlocker[T]) FamilyIsBlocked(family string) bool {
+	return d.isRevoked(familyPrefix + family)
+}
+
+func (d *cacheBlocker[T]) UseRefresh(token string) (bool, error) {
+	n, err := d.revoke.Counter(usedKey(token), 0, d.refreshTTL).Incr(1)
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (d *cacheBlocker[T]) RefreshIsUsed(token string) bool { return d.revoke.Exists(usedKey(token)) }
+
+// 以令牌的摘要作为键名，令牌本身可能较长。
+func usedKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return usedPrefix + base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func familyOf(c Claims) string {
+	if fc, ok := c.(FamilyClaims); ok {
+		return fc.Family()
+	}
+	return ""
+}
+
+// 设置 access 和 refresh 的家族 ID
+//
+// 如果 access 未指定家族，则优先采用当前刷新令牌所属的家族，否则生成新的家族 ID。
+func setFamily(ctx *web.Context, access, refresh Claims) {
+	fc, ok := access.(FamilyClaims)
+	if !ok {
+		return
+	}
+
+	family := fc.Family()
+	if family == "" {
+		if v, found := ctx.GetVar(familySlot{}); found {
+			family = v.(string)
+		} else {
+			family = mauth.RandString(16)
+		}
+		fc.SetFamily(family)
+	}
+
+	if refresh != nil {
+		if rc, ok := refresh.(FamilyClaims); ok {
+			rc.SetFamily(family)
+		}
+	}
+}
+
+// 家族是否已经被吊销
+func (j *Verifier[T]) familyIsBlocked(c T) bool {
+	fb, ok := j.blocker.(FamilyBlocker)
+	if !ok {
+		return false
+	}
+
+	family := familyOf(c)
+	return family != "" && fb.FamilyIsBlocked(family)
+}
+
+// 已经使用过的刷新令牌被再次提交，吊销其所属的整个家族。
+//
+// 被拉黑的普通令牌以及未经刷新而被拉黑（比如退出登录）的刷新令牌提交到刷新接口不属于重复使用，不会吊销家族。
+// 返回值表示是否吊销了家族。
+func (j *Verifier[T]) revokeFamily(ctx *web.Context, token string) bool {
+	fb, ok := j.blocker.(FamilyBlocker)
+	if !ok || !fb.RefreshIsUsed(token) {
+		return false
+	}
+
+	c, err := j.parse(token)
+	if err != nil || c.BaseToken() == "" || familyOf(c) == "" {
+		return false
+	}
+
+	j.reuseRefresh(ctx, fb, c)
+	return true
+}
+
+// 标记刷新令牌已经被使用
+//
+// 并发提交的同一刷新令牌只有第一个可以通过，其它的视为重复使用。
+// 返回非空值表示验证失败。
+func (j *Verifier[T]) useRefresh(ctx *web.Context, token string, c T) web.Responser {
+	fb, ok := j.blocker.(FamilyBlocker)
+	if !ok {
+		return nil
+	}
+
+	first, err := fb.UseRefresh(token)
+	if err != nil {
+		return ctx.Error(err, "")
+	}
+	if !first {
+		j.reuseRefresh(ctx, fb, c)
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+	return nil
+}
+
+// 刷新令牌被重复使用，吊销其所属的家族并发送事件。
+func (j *Verifier[T]) reuseRefresh(ctx *web.Context, fb FamilyBlocker, c T) {
+	if family := familyOf(c); family != "" {
+		if err := fb.BlockFamily(family); err != nil {
+			ctx.Logs().ERROR().Error(err)
+		}
+	}
+	auth.Emit(ctx, j.sink, &auth.Event{Type: auth.EventRefreshReuse, Source: j.source, Info: c})
+}
@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+var (
+	_ FamilyClaims  = &familyClaims{}
+	_ FamilyBlocker = &cacheBlocker[*testClaims]{}
+)
+
+type familyClaims struct {
+	testClaims
+	Fam string `json:"fam,omitempty"`
+}
+
+func (c *familyClaims) Family() string { return c.Fam }
+
+func (c *familyClaims) SetFamily(f string) { c.Fam = f }
+
+func (c *familyClaims) BuildRefresh(token string, ctx *web.Context) Claims {
+	return &familyClaims{testClaims: testClaims{Token: token, Created: ctx.Begin(), ID: c.ID}}
+}
+
+func TestJWT_family(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	events := make([]*auth.Event, 0, 10)
+	eventsMux := &sync.Mutex{}
+	sink := auth.SinkFunc(func(e *auth.Event) {
+		eventsMux.Lock()
+		defer eventsMux.Unlock()
+		events = append(events, e)
+	})
+	lastEvent := func() *auth.Event {
+		eventsMux.Lock()
+		defer eventsMux.Unlock()
+		return events[len(events)-1]
+	}
+
+	b := NewCacheBlocker[*familyClaims](s, "test_", time.Hour, 2*time.Hour)
+	j := New(b, func() *familyClaims { return &familyClaims{} }, time.Hour, 2*time.Hour, nil)
+	j.SetSink(sink)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	r := s.Routers().New("def", nil)
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, &familyClaims{testClaims: testClaims{ID: 1, Created: ctx.Begin()}})
+	})
+	r.Post("/refresh", j.VerifiyRefresh(func(ctx *web.Context) web.Responser {
+		c, _ := j.GetInfo(ctx)
+		return j.Render(ctx, http.StatusCreated, &familyClaims{testClaims: testClaims{ID: c.ID, Created: ctx.Begin()}})
+	}))
+	r.Get("/info", j.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+	r.Delete("/login", j.Middleware(func(ctx *web.Context) web.Responser {
+		if err := j.Logout(ctx); err != nil {
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	family := func(token string) string {
+		c := &familyClaims{}
+		_, _, err := jwt.NewParser().ParseUnverified(token, c)
+		a.NotError(err)
+		return c.Fam
+	}
+
+	post := func(path, token string, status int) *Response {
+		resp := &Response{}
+		req := servertest.Post(a, "http://localhost:8080"+path, nil)
+		if token != "" {
+			req.Header(mauth.AuthorizationHeader, "Bearer "+token)
+		}
+		req.Do(nil).
+			Status(status).
+			BodyFunc(func(a *assert.Assertion, body []byte) {
+				if status == http.StatusCreated {
+					a.NotError(json.Unmarshal(body, resp))
+				}
+			})
+		return resp
+	}
+
+	get := func(token string, status int) {
+		servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, "Bearer "+token).
+			Do(nil).
+			Status(status)
+	}
+
+	resp1 := post("/login", "", http.StatusCreated)
+	f := family(resp1.Access)
+	a.NotEmpty(f).Equal(family(resp1.Refresh), f)
+
+	// 刷新之后的令牌属于同一家族
+	resp2 := post("/refresh", resp1.Refresh, http.StatusCreated)
+	a.Equal(family(resp2.Access), f).Equal(family(resp2.Refresh), f)
+	get(resp2.Access, http.StatusNoContent)
+
+	// 其它登录属于不同的家族
+	other := post("/login", "", http.StatusCreated)
+	a.NotEqual(family(other.Access), f)
+
+	// 重复使用刷新令牌，吊销整个家族。
+	post("/refresh", resp1.Refresh, http.StatusUnauthorized)
+	e := lastEvent()
+	a.Equal(e.Type, auth.EventRefreshReuse).
+		Equal(e.Info.(*familyClaims).Fam, f)
+	a.True(b.(FamilyBlocker).FamilyIsBlocked(f))
+
+	get(resp2.Access, http.StatusUnauthorized)
+	a.Equal(lastEvent().Type, auth.EventBlocked)
+	post("/refresh", resp2.Refresh, http.StatusUnauthorized)
+
+	// 不影响其它家族
+	get(other.Access, http.StatusNoContent)
+	post("/refresh", other.Refresh, http.StatusCreated)
+
+	// 非刷新操作中提交已被拉黑的令牌，不会吊销家族。
+	resp3 := post("/login", "", http.StatusCreated)
+	a.NotError(b.BlockToken(resp3.Access, false))
+	get(resp3.Access, http.StatusUnauthorized)
+	a.Equal(lastEvent().Type, auth.EventBlocked)
+	a.False(b.(FamilyBlocker).FamilyIsBlocked(family(resp3.Access)))
+
+	// 已被拉黑的普通令牌提交到刷新接口，不会吊销家族。
+	post("/refresh", resp3.Access, http.StatusUnauthorized)
+	a.Equal(lastEvent().Type, auth.EventBlocked)
+	a.False(b.(FamilyBlocker).FamilyIsBlocked(family(resp3.Access)))
+	post("/refresh", resp3.Refresh, http.StatusCreated)
+
+	// 以刷新令牌退出登录之后再次提交，不属于重复使用。
+	resp4 := post("/login", "", http.StatusCreated)
+	servertest.Delete(a, "http://localhost:8080/login").
+		Header(mauth.AuthorizationHeader, "Bearer "+resp4.Refresh).
+		Do(nil).
+		Status(http.StatusNoContent)
+	post("/refresh", resp4.Refresh, http.StatusUnauthorized)
+	a.Equal(lastEvent().Type, auth.EventBlocked)
+	a.False(b.(FamilyBlocker).FamilyIsBlocked(family(resp4.Access)))
+
+	// 并发提交同一刷新令牌，只有一个可以通过。
+	resp5 := post("/login", "", http.StatusCreated)
+	var wg sync.WaitGroup
+	var created, unauthorized atomic.Int32
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := servertest.Post(a, "http://localhost:8080/refresh", nil).
+				Header(mauth.AuthorizationHeader, "Bearer "+resp5.Refresh).
+				Do(nil).
+				Resp()
+			switch resp.StatusCode {
+			case http.StatusCreated:
+				created.Add(1)
+			case http.StatusUnauthorized:
+				unauthorized.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	a.Equal(created.Load(), 1).Equal(unauthorized.Load(), 9)
+	a.True(b.(FamilyBlocker).FamilyIsBlocked(family(resp5.Access)))
+}
@@ -0,0 +1,264 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/jwe"
+)
+
+// 加密令牌时的密钥管理算法
+//
+// 内容加密始终采用 A256GCM。
+const (
+	EncryptionDir        = jwe.Dir        // 直接使用 32 字节的共享密钥
+	EncryptionRSAOAEP256 = jwe.RSAOAEP256 // RSA 公钥加密
+	EncryptionECDHES     = jwe.ECDHES     // ECDH 密钥协商，支持 P-256、P-384、P-521 和 X25519。
+)
+
+// 加密或是解密令牌的密钥
+type encKey struct {
+	id  string
+	alg string
+	key any // 加密时为公钥，解密时为私钥，dir 则为共享密钥。
+}
+
+var errInvalidJWEContentType = web.NewLocaleError("invalid jwe content type")
+
+// 在 keys 中添加 id，调用者需要保证已经加锁。
+func addEncKey(keys []*encKey, id, alg string, k any) []*encKey {
+	if slices.IndexFunc(keys, func(e *encKey) bool { return e.id == id }) >= 0 {
+		panic(fmt.Sprintf("存在同名的加密密钥 %s", id))
+	}
+	return append(keys, &encKey{id: id, alg: alg, key: k})
+}
+
+func parseDirKey(key []byte) []byte {
+	if len(key) != 32 {
+		panic("dir 密钥的长度必须为 32")
+	}
+	return key
+}
+
+func parseEncryptionKey(alg string, key []byte) any {
+	switch alg {
+	case EncryptionDir:
+		return parseDirKey(key)
+	case EncryptionRSAOAEP256:
+		pub, err := jwt.ParseRSAPublicKeyFromPEM(key)
+		if err != nil {
+			panic(err)
+		}
+		return pub
+	case EncryptionECDHES:
+		block, _ := pem.Decode(key)
+		if block == nil {
+			panic(jwt.ErrKeyMustBePEMEncoded)
+		}
+
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			panic(err)
+		}
+
+		switch p := pub.(type) {
+		case *ecdsa.PublicKey:
+			k, err := p.ECDH()
+			if err != nil {
+				panic(err)
+			}
+			return k
+		case *ecdh.PublicKey:
+			return p
+		default:
+			panic(fmt.Sprintf("%s 无法使用 %T 类型的公钥", alg, pub))
+		}
+	default:
+		panic(fmt.Sprintf("不支持的加密算法 %s", alg))
+	}
+}
+
+func parseDecryptionKey(alg string, key []byte) any {
+	switch alg {
+	case EncryptionDir:
+		return parseDirKey(key)
+	case EncryptionRSAOAEP256:
+		pvt, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+		if err != nil {
+			panic(err)
+		}
+		return pvt
+	case EncryptionECDHES:
+		block, _ := pem.Decode(key)
+		if block == nil {
+			panic(jwt.ErrKeyMustBePEMEncoded)
+		}
+
+		pvt, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			if pvt, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+				panic(err)
+			}
+		}
+
+		switch p := pvt.(type) {
+		case *ecdsa.PrivateKey:
+			k, err := p.ECDH()
+			if err != nil {
+				panic(err)
+			}
+			return k
+		case *ecdh.PrivateKey:
+			return p
+		default:
+			panic(fmt.Sprintf("%s 无法使用 %T 类型的私钥", alg, pvt))
+		}
+	default:
+		panic(fmt.Sprintf("不支持的加密算法 %s", alg))
+	}
+}
+
+// AddEncryption 添加加密令牌的密钥
+//
+// 添加之后，[Signer.Sign] 签发的令牌会再以 JWE 的紧凑格式进行加密，
+// 有多个密钥时随机选取，id 会作为 JWE 报头中的 kid。
+//
+// alg 为密钥管理算法，key 根据 alg 的不同分别为：
+//   - [EncryptionDir] 32 字节的共享密钥；
+//   - [EncryptionRSAOAEP256] PEM 格式的 RSA 公钥；
+//   - [EncryptionECDHES] PEM 格式的 PKIX 公钥；
+func (s *Signer) AddEncryption(id, alg string, key []byte) {
+	k := parseEncryptionKey(alg, key)
+
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+	s.encs = addEncKey(s.encs, id, alg, k)
+}
+
+// AddEncryptionFromFS 添加加密令牌的密钥
+//
+// 参考 [Signer.AddEncryption]。
+func (s *Signer) AddEncryptionFromFS(id, alg string, fsys fs.FS, key string) {
+	data, err := fs.ReadFile(fsys, key)
+	if err != nil {
+		panic(err)
+	}
+	s.AddEncryption(id, alg, data)
+}
+
+// RemoveEncryption 删除加密令牌的密钥
+func (s *Signer) RemoveEncryption(id string) {
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+	s.encs = slices.DeleteFunc(s.encs, func(e *encKey) bool { return e.id == id })
+}
+
+// 加密已经签名的令牌，如果没有加密密钥，则原样返回。
+func (s *Signer) encrypt(token string) (string, error) {
+	s.keysMux.Lock()
+	var k *encKey
+	if l := len(s.encs); l > 0 {
+		k = s.encs[rand.Intn(l)]
+	}
+	s.keysMux.Unlock()
+
+	if k == nil {
+		return token, nil
+	}
+	return jwe.Encrypt(k.alg, k.id, "JWT", k.key, []byte(token))
+}
+
+// AddDecryption 添加解密令牌的密钥
+//
+// 添加之后，[Verifier.Middleware] 会先解密 JWE 格式的令牌再进行验证，
+// 未加密的令牌依然可以正常验证。
+//
+// alg 为密钥管理算法，key 根据 alg 的不同分别为：
+//   - [EncryptionDir] 32 字节的共享密钥；
+//   - [EncryptionRSAOAEP256] PEM 格式的 RSA 私钥；
+//   - [EncryptionECDHES] PEM 格式的 PKCS8 或是 SEC1 私钥；
+func (j *Verifier[T]) AddDecryption(id, alg string, key []byte) {
+	k := parseDecryptionKey(alg, key)
+
+	j.keysMux.Lock()
+	defer j.keysMux.Unlock()
+	j.decs = addEncKey(j.decs, id, alg, k)
+}
+
+// AddDecryptionFromFS 添加解密令牌的密钥
+//
+// 参考 [Verifier.AddDecryption]。
+func (j *Verifier[T]) AddDecryptionFromFS(id, alg string, fsys fs.FS, key string) {
+	data, err := fs.ReadFile(fsys, key)
+	if err != nil {
+		panic(err)
+	}
+	j.AddDecryption(id, alg, data)
+}
+
+// RemoveDecryption 删除解密令牌的密钥
+func (j *Verifier[T]) RemoveDecryption(id string) {
+	j.keysMux.Lock()
+	defer j.keysMux.Unlock()
+	j.decs = slices.DeleteFunc(j.decs, func(e *encKey) bool { return e.id == id })
+}
+
+// 解密 JWE 格式的令牌，返回其中嵌套的 JWT。
+func (j *Verifier[T]) decrypt(token string) (string, error) {
+	payload, h, err := jwe.Decrypt(token, func(h *jwe.Header) (any, error) {
+		j.keysMux.RLock()
+		defer j.keysMux.RUnlock()
+
+		index := slices.IndexFunc(j.decs, func(e *encKey) bool { return e.id == h.Kid && e.alg == h.Alg })
+		if index < 0 {
+			return nil, errKeyNotFound(h.Kid)
+		}
+		return j.decs[index].key, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if h.Cty != "JWT" {
+		return "", errInvalidJWEContentType
+	}
+	return string(payload), nil
+}
+
+// AddEncryption 添加加密令牌的密钥
+//
+// pub 和 pvt 分别用于 [Signer.AddEncryption] 和 [Verifier.AddDecryption]，
+// 如果 alg 为 [EncryptionDir]，两者需要相同。
+func (j *JWT[T]) AddEncryption(id, alg string, pub, pvt []byte) {
+	j.v.AddDecryption(id, alg, pvt)
+	j.s.AddEncryption(id, alg, pub)
+}
+
+// AddEncryptionFromFS 添加加密令牌的密钥
+//
+// 参考 [JWT.AddEncryption]。
+func (j *JWT[T]) AddEncryptionFromFS(id, alg string, fsys fs.FS, pub, pvt string) {
+	j.v.AddDecryptionFromFS(id, alg, fsys, pvt)
+	j.s.AddEncryptionFromFS(id, alg, fsys, pub)
+}
+
+// RemoveEncryption 删除加密令牌的密钥
+//
+// 由该密钥加密的令牌将立即失效。
+func (j *JWT[T]) RemoveEncryption(id string) {
+	j.s.RemoveEncryption(id)
+	j.v.RemoveDecryption(id)
+}
@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/jwe"
+	"github.com/issue9/webuse/v7/internal/mauth"
+)
+
+func x25519PEM(a *assert.Assertion) (pub, pvt []byte) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	a.NotError(err)
+
+	p, err := x509.MarshalPKIXPublicKey(key.PublicKey())
+	a.NotError(err)
+	v, err := x509.MarshalPKCS8PrivateKey(key)
+	a.NotError(err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: p}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: v})
+}
+
+func TestJWT_AddEncryption(t *testing.T) {
+	a := assert.New(t, false)
+	fsys := os.DirFS("./testdata")
+	dirKey := bytes.Repeat([]byte("k"), 32)
+
+	add := map[string]func(*JWT[*testClaims]){
+		"dir": func(j *JWT[*testClaims]) {
+			j.AddEncryption("enc", EncryptionDir, dirKey, dirKey)
+		},
+		"rsa": func(j *JWT[*testClaims]) {
+			j.AddEncryptionFromFS("enc", EncryptionRSAOAEP256, fsys, "rsa-public.pem", "rsa-private.pem")
+		},
+		"ec": func(j *JWT[*testClaims]) {
+			j.AddEncryptionFromFS("enc", EncryptionECDHES, fsys, "ec256-public.pem", "ec256-private.pem")
+		},
+		"x25519": func(j *JWT[*testClaims]) {
+			pub, pvt := x25519PEM(a)
+			j.AddEncryption("enc", EncryptionECDHES, pub, pvt)
+		},
+	}
+
+	for name, f := range add {
+		s, j := newJWT(a, time.Hour, 2*time.Hour)
+		j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+		f(j)
+
+		token, err := j.Sign(&testClaims{ID: 1})
+		a.NotError(err).True(jwe.IsJWE(token), name)
+
+		// 无法从令牌中读取 claims
+		_, _, err = jwt.NewParser().ParseUnverified(token, &testClaims{})
+		a.Error(err, name)
+
+		verifierMiddleware(a, s, j)
+	}
+
+	a.PanicString(func() {
+		_, j := newJWT(a, time.Hour, 2*time.Hour)
+		j.AddEncryption("enc", EncryptionDir, []byte("short"), []byte("short"))
+	}, "dir 密钥的长度必须为 32")
+
+	a.PanicString(func() {
+		_, j := newJWT(a, time.Hour, 2*time.Hour)
+		j.AddEncryption("enc", "A128KW", dirKey, dirKey)
+	}, "不支持的加密算法 A128KW")
+
+	a.PanicString(func() {
+		_, j := newJWT(a, time.Hour, 2*time.Hour)
+		j.AddEncryption("enc", EncryptionDir, dirKey, dirKey)
+		j.AddEncryption("enc", EncryptionDir, dirKey, dirKey)
+	}, "存在同名的加密密钥 enc")
+
+	a.Panic(func() {
+		_, j := newJWT(a, time.Hour, 2*time.Hour)
+		j.AddEncryptionFromFS("enc", EncryptionECDHES, fsys, "rsa-public.pem", "rsa-private.pem")
+	})
+}
+
+func TestVerifier_decrypt(t *testing.T) {
+	a := assert.New(t, false)
+	s, j := newJWT(a, time.Hour, 2*time.Hour)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	dirKey := bytes.Repeat([]byte("k"), 32)
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", j.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	get := func(token string, status int) {
+		a.TB().Helper()
+		servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, "Bearer "+token).
+			Do(nil).
+			Status(status)
+	}
+
+	plain, err := j.Sign(&testClaims{ID: 1})
+	a.NotError(err)
+
+	j.AddEncryption("enc", EncryptionDir, dirKey, dirKey)
+	encrypted, err := j.Sign(&testClaims{ID: 1})
+	a.NotError(err)
+
+	get(plain, http.StatusNoContent) // 未加密的令牌依然有效
+	get(encrypted, http.StatusNoContent)
+
+	// 内容不是 JWT
+	token, err := jwe.Encrypt(EncryptionDir, "enc", "", dirKey, []byte(plain))
+	a.NotError(err)
+	get(token, http.StatusUnauthorized)
+
+	// 未签名的内容
+	token, err = jwe.Encrypt(EncryptionDir, "enc", "JWT", dirKey, []byte("claims"))
+	a.NotError(err)
+	get(token, http.StatusUnauthorized)
+
+	// alg 与密钥不符
+	j.v.AddDecryptionFromFS("rsa", EncryptionRSAOAEP256, os.DirFS("./testdata"), "rsa-private.pem")
+	token, err = jwe.Encrypt(EncryptionDir, "rsa", "JWT", dirKey, []byte(plain))
+	a.NotError(err)
+	get(token, http.StatusUnauthorized)
+
+	// 删除密钥之后无法解密
+	j.RemoveEncryption("enc")
+	get(encrypted, http.StatusUnauthorized)
+	token, err = j.Sign(&testClaims{ID: 1})
+	a.NotError(err).False(jwe.IsJWE(token))
+}
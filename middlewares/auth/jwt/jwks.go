@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+)
+
+// JWKSPath 公开 JWKS 的默认地址
+//
+// https://datatracker.ietf.org/doc/html/rfc8615
+const JWKSPath = "/.well-known/jwks.json"
+
+const (
+	jwksRefetchInterval = time.Minute      // 两次因未知 kid 而重新拉取 JWKS 的最小间隔
+	jwksMaxSize         = 1 << 20          // JWKS 内容的最大长度
+	jwksTimeout         = 10 * time.Second // 拉取 JWKS 的超时时间
+)
+
+// 外部 JWKS 的来源
+type jwksSource struct {
+	name string
+	load func(context.Context) ([]byte, error)
+	logs web.Logs
+
+	mux  sync.Mutex
+	last time.Time // 最后一次拉取的时间
+}
+
+// JWKS 以 JSON Web Key Set 的格式公开所有非对称密钥的公钥
+//
+// 第三方可以据此验证由当前对象签发的令牌，kid 即为添加密钥时指定的 ID，HMAC 类型的密钥不会被公开。
+// 尚未激活和已经退役但由其签发的令牌还未过期的密钥也会被公开。
+// 一般将返回值注册在 [JWKSPath]。
+//
+// maxAge 为客户端缓存的时间，同时会输出根据内容生成的 ETag 报头，在添加密钥之后会发生变化。
+func (s *Signer) JWKS(maxAge time.Duration) web.HandlerFunc {
+	cacheControl := "public, max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+
+	return func(ctx *web.Context) web.Responser {
+		set, err := s.keySet()
+		if err != nil {
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+
+		data, err := json.Marshal(set)
+		if err != nil {
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+		sum := sha256.Sum256(data)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		if ctx.Request().Header.Get("If-None-Match") == etag {
+			return web.Status(http.StatusNotModified, "ETag", etag, "Cache-Control", cacheControl)
+		}
+		return web.Response(http.StatusOK, set, "ETag", etag, "Cache-Control", cacheControl)
+	}
+}
+
+// 包含尚未激活和已经退役的密钥，以便于第三方提前获取和继续验证由其签发的令牌。
+func (s *Signer) keySet() (*jwk.Set, error) {
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+
+	s.rotate(time.Now())
+
+	set := &jwk.Set{Keys: make([]*jwk.Key, 0, len(s.keys))}
+	for _, k := range s.keys {
+		signer, ok := k.key.(crypto.Signer) // HMAC 的密钥为 []byte
+		if !ok {
+			continue
+		}
+
+		key, err := jwk.FromPublicKey(k.id.(string), k.sign.Alg(), signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, key)
+	}
+	return set, nil
+}
+
+// JWKS 以 JSON Web Key Set 的格式公开所有非对称密钥的公钥
+//
+// 参考 [Signer.JWKS]。
+func (j *JWT[T]) JWKS(maxAge time.Duration) web.HandlerFunc { return j.s.JWKS(maxAge) }
+
+// AddJWKS 从远程地址加载 JWKS 作为验证令牌的公钥
+//
+// 一般用于验证由外部 IdP 签发的令牌。kid 即为密钥的 ID，签名算法由 alg 字段决定，
+// 未指定 alg 时根据密钥类型采用 RS256、ES256/ES384/ES512 或是 EdDSA，对称密钥会被忽略。
+//
+// client 为拉取 JWKS 的客户端，如果为空则采用一个超时时间为 10 秒的客户端；
+// interval 为定时刷新的间隔，会注册在 s.Services() 中，如果为 0 表示不定时刷新。
+// 刷新时会删除 JWKS 中已经不存在的密钥，不支持的密钥会被忽略并记录在日志中。
+// 此外当令牌中的 kid 不存在时，也会尝试重新拉取，但两次拉取之间至少间隔一分钟，
+// 且每次拉取的时间不会超过 10 秒。
+func (j *Verifier[T]) AddJWKS(s web.Server, client *http.Client, url string, interval time.Duration) error {
+	if client == nil {
+		client = &http.Client{Timeout: jwksTimeout}
+	}
+
+	return j.addJWKS(s, url, func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, web.NewLocaleError("request %s return status %d", url, resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+	}, interval)
+}
+
+// AddJWKSFromFS 从文件加载 JWKS 作为验证令牌的公钥
+//
+// 除了数据来源不同，其它与 [Verifier.AddJWKS] 相同。
+func (j *Verifier[T]) AddJWKSFromFS(s web.Server, fsys fs.FS, name string, interval time.Duration) error {
+	return j.addJWKS(s, name, func(context.Context) ([]byte, error) { return fs.ReadFile(fsys, name) }, interval)
+}
+
+func (j *Verifier[T]) addJWKS(s web.Server, name string, load func(context.Context) ([]byte, error), interval time.Duration) error {
+	src := &jwksSource{name: name, load: load, logs: s.Logs()}
+	if err := j.refreshJWKS(src); err != nil {
+		return err
+	}
+
+	j.keysMux.Lock()
+	j.sources = append(j.sources, src)
+	j.keysMux.Unlock()
+
+	if interval > 0 {
+		s.Services().AddTicker(web.Phrase("refresh jwks %s", name), func(time.Time) error {
+			return j.refreshJWKS(src)
+		}, interval, false, false)
+	}
+	return nil
+}
+
+// 重新拉取所有来源的 JWKS
+//
+// 在找不到 kid 时调用，每个来源在 [jwksRefetchInterval] 内最多拉取一次。
+// 返回值表示是否有来源被重新拉取。
+func (j *Verifier[T]) refetchJWKS() bool {
+	j.keysMux.RLock()
+	sources := slices.Clone(j.sources)
+	j.keysMux.RUnlock()
+
+	var refreshed bool
+	for _, src := range sources {
+		if !src.start(time.Now()) { // 其它请求已经在此间隔内拉取过
+			continue
+		}
+
+		if err := j.loadJWKS(src); err == nil {
+			refreshed = true
+		}
+	}
+	return refreshed
+}
+
+// 如果距上次拉取已经超过 [jwksRefetchInterval]，则将 now 记为拉取时间并返回 true。
+//
+// 判断和更新在同一个临界区内，保证并发请求中只有一个会真正拉取。
+func (src *jwksSource) start(now time.Time) bool {
+	src.mux.Lock()
+	defer src.mux.Unlock()
+
+	if now.Sub(src.last) < jwksRefetchInterval {
+		return false
+	}
+	src.last = now
+	return true
+}
+
+// 记录被忽略的密钥
+func (src *jwksSource) skip(kid string, err error) {
+	src.logs.WARN().LocaleString(web.Phrase("skip jwks key %s in %s, %s", kid, src.name, err))
+}
+
+// 拉取 src 并用其内容替换由 src 加载的所有密钥
+func (j *Verifier[T]) refreshJWKS(src *jwksSource) error {
+	src.mux.Lock()
+	src.last = time.Now()
+	src.mux.Unlock()
+
+	return j.loadJWKS(src)
+}
+
+func (j *Verifier[T]) loadJWKS(src *jwksSource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksTimeout)
+	defer cancel()
+
+	data, err := src.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	set := &jwk.Set{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return err
+	}
+
+	keys := make([]*key, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kid == "" || k.Kty == "oct" || (k.Use != "" && k.Use != "sig") { // 对称密钥不应该出现在公开的 JWKS 中
+			continue
+		}
+
+		pub, err := k.PublicKey()
+		if err != nil { // 不支持的密钥不影响其它密钥的使用
+			src.skip(k.Kid, err)
+			continue
+		}
+
+		sign, err := jwkSigningMethod(k.Alg, pub)
+		if err != nil {
+			src.skip(k.Kid, err)
+			continue
+		}
+		keys = append(keys, &key{id: k.Kid, sign: sign, key: pub, source: src})
+	}
+
+	j.keysMux.Lock()
+	defer j.keysMux.Unlock()
+
+	others := slices.DeleteFunc(slices.Clone(j.keys), func(e *key) bool { return e.source == src })
+	for _, k := range keys {
+		if slices.IndexFunc(others, func(e *key) bool { return e.id == k.id }) >= 0 {
+			return web.NewLocaleError("duplicate jwks key %s", k.id)
+		}
+	}
+	j.keys = append(others, keys...)
+	return nil
+}
+
+// 根据 alg 和公钥类型确定签名算法
+func jwkSigningMethod(alg string, pub any) (SigningMethod, error) {
+	if alg == "" {
+		switch p := pub.(type) {
+		case *rsa.PublicKey:
+			alg = jwt.SigningMethodRS256.Alg()
+		case *ecdsa.PublicKey:
+			switch p.Curve.Params().BitSize {
+			case 256:
+				alg = jwt.SigningMethodES256.Alg()
+			case 384:
+				alg = jwt.SigningMethodES384.Alg()
+			case 521:
+				alg = jwt.SigningMethodES512.Alg()
+			}
+		case ed25519.PublicKey:
+			alg = jwt.SigningMethodEdDSA.Alg()
+		}
+	}
+
+	if m := methodForKey(alg, pub); m != nil {
+		return m, nil
+	}
+	return nil, web.NewLocaleError("unsupported jwks alg %s", alg)
+}
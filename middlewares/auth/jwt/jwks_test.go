@@ -0,0 +1,276 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+)
+
+func TestSigner_JWKS(t *testing.T) {
+	a := assert.New(t, false)
+	s, j := newJWT(a, time.Hour, 2*time.Hour)
+	fsys := os.DirFS("./testdata")
+
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	j.AddFromFS("rsa", jwt.SigningMethodRS256, fsys, "rsa-public.pem", "rsa-private.pem")
+	j.AddFromFS("ecdsa", jwt.SigningMethodES256, fsys, "ec256-public.pem", "ec256-private.pem")
+
+	r := s.Routers().New("def", nil)
+	r.Get(JWKSPath, j.JWKS(time.Hour))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	get := func(a *assert.Assertion) (*jwk.Set, string) {
+		set := &jwk.Set{}
+		resp := servertest.Get(a, "http://localhost:8080"+JWKSPath).
+			Do(nil).
+			Status(http.StatusOK).
+			Header("Cache-Control", "public, max-age=3600").
+			BodyFunc(func(a *assert.Assertion, body []byte) {
+				a.NotError(json.Unmarshal(body, set))
+			}).
+			Resp()
+		return set, resp.Header.Get("ETag")
+	}
+
+	set, etag := get(a)
+	a.NotEmpty(etag).Length(set.Keys, 2) // 不包含 HMAC
+	for _, k := range set.Keys {
+		a.Equal(k.Use, "sig").NotEqual(k.Kty, "oct")
+
+		index := -1
+		for i, key := range j.v.keys {
+			if key.id == k.Kid {
+				index = i
+			}
+		}
+		a.True(index >= 0).Equal(k.Alg, j.v.keys[index].sign.Alg())
+
+		pub, err := k.PublicKey()
+		a.NotError(err).Equal(pub, j.v.keys[index].key)
+	}
+
+	servertest.Get(a, "http://localhost:8080"+JWKSPath).
+		Header("If-None-Match", etag).
+		Do(nil).
+		Status(http.StatusNotModified)
+
+	// 添加密钥之后 ETag 发生变化
+	j.AddFromFS("ed25519", jwt.SigningMethodEdDSA, fsys, "ed25519-public.pem", "ed25519-private.pem")
+	servertest.Get(a, "http://localhost:8080"+JWKSPath).
+		Header("If-None-Match", etag).
+		Do(nil).
+		Status(http.StatusOK)
+	set, etag2 := get(a)
+	a.NotEqual(etag, etag2).Length(set.Keys, 3)
+}
+
+func newVerifier(a *assert.Assertion, s web.Server) *Verifier[*testClaims] {
+	a.NotError(s.Cache().Clean())
+	b := NewCacheBlocker[*testClaims](s, "test_", time.Hour, 2*time.Hour)
+	return NewVerifier(b, func() *testClaims { return &testClaims{} })
+}
+
+type jwksServer struct {
+	mux  sync.Mutex
+	set  *jwk.Set
+	hits int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.hits++
+	json.NewEncoder(w).Encode(s.set)
+}
+
+func (s *jwksServer) setKeys(keys ...*jwk.Key) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.set = &jwk.Set{Keys: keys}
+}
+
+func (s *jwksServer) getHits() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.hits
+}
+
+func TestVerifier_AddJWKS(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	v := newVerifier(a, s)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NotError(err)
+	rsaJWK, err := jwk.FromPublicKey("k1", jwt.SigningMethodRS256.Alg(), rsaKey.Public())
+	a.NotError(err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+	edJWK, err := jwk.FromPublicKey("k2", jwt.SigningMethodEdDSA.Alg(), edKey.Public())
+	a.NotError(err)
+
+	js := &jwksServer{}
+	js.setKeys(rsaJWK)
+	srv := httptest.NewServer(js)
+	defer srv.Close()
+
+	a.NotError(v.AddJWKS(s, nil, srv.URL, 0))
+	a.Equal(js.getHits(), 1)
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", v.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	sign := func(kid string, m SigningMethod, k any) string {
+		token := jwt.NewWithClaims(m, &testClaims{ID: 1})
+		token.Header["kid"] = kid
+		str, err := token.SignedString(k)
+		a.NotError(err)
+		return str
+	}
+	rsaToken := sign("k1", jwt.SigningMethodRS256, rsaKey)
+	edToken := sign("k2", jwt.SigningMethodEdDSA, edKey)
+
+	get := func(token string, status int) {
+		servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, "Bearer "+token).
+			Do(nil).
+			Status(status)
+	}
+	get(rsaToken, http.StatusNoContent)
+
+	// 以 kid 对应的算法为准
+	get(sign("k1", jwt.SigningMethodPS256, rsaKey), http.StatusUnauthorized)
+
+	// 未知的 kid，但是距上次拉取不足一分钟。
+	js.setKeys(edJWK)
+	get(edToken, http.StatusUnauthorized)
+	a.Equal(js.getHits(), 1)
+
+	// 未知的 kid，重新拉取，且删除已经不存在的 k1。
+	v.sources[0].last = time.Now().Add(-jwksRefetchInterval)
+	get(edToken, http.StatusNoContent)
+	a.Equal(js.getHits(), 2)
+	get(rsaToken, http.StatusUnauthorized)
+	a.Equal(js.getHits(), 2)
+
+	// 并发的请求只会拉取一次
+	v.sources[0].last = time.Now().Add(-jwksRefetchInterval)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.refetchJWKS()
+		}()
+	}
+	wg.Wait()
+	a.Equal(js.getHits(), 3)
+
+	// 与已有的 kid 冲突
+	v.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	hmacJWK := *rsaJWK
+	hmacJWK.Kid = "hmac"
+	js.setKeys(edJWK, &hmacJWK)
+	a.ErrorString(v.refreshJWKS(v.sources[0]), "hmac")
+	get(edToken, http.StatusNoContent) // 出错时不改变已有的密钥
+}
+
+func TestVerifier_AddJWKSFromFS(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	v := newVerifier(a, s)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	a.NotError(err)
+	ecJWK, err := jwk.FromPublicKey("ec", "", ecKey.Public())
+	a.NotError(err)
+	hmacJWK := &jwk.Key{Kty: "oct", Kid: "hmac", K: "c2VjcmV0"}
+	x448JWK := &jwk.Key{Kty: "OKP", Kid: "x448", Crv: "X448", X: "eA"}
+	algJWK := *ecJWK
+	algJWK.Kid, algJWK.Alg = "alg", jwt.SigningMethodRS256.Alg()
+	data, err := json.Marshal(&jwk.Set{Keys: []*jwk.Key{ecJWK, hmacJWK, x448JWK, &algJWK}})
+	a.NotError(err)
+
+	fsys := fstest.MapFS{"jwks.json": &fstest.MapFile{Data: data}}
+	a.NotError(v.AddJWKSFromFS(s, fsys, "jwks.json", 0))
+	a.Length(v.keys, 1). // 忽略对称密钥和不支持的密钥
+				Equal(v.keys[0].id, "ec").
+				Equal(v.keys[0].sign, jwt.SigningMethodES384) // 未指定 alg，根据曲线决定。
+
+	a.Error(v.AddJWKSFromFS(s, fsys, "not-exists.json", 0))
+}
+
+func TestVerifier_AddJWKS_ticker(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	v := newVerifier(a, s)
+
+	js := &jwksServer{}
+	js.setKeys()
+	srv := httptest.NewServer(js)
+	defer srv.Close()
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	a.NotError(v.AddJWKS(s, srv.Client(), srv.URL, 50*time.Millisecond))
+	time.Sleep(300 * time.Millisecond)
+	a.True(js.getHits() > 2)
+}
+
+func TestJWKSigningMethod(t *testing.T) {
+	a := assert.New(t, false)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NotError(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+
+	m, err := jwkSigningMethod("", rsaKey.Public())
+	a.NotError(err).Equal(m, jwt.SigningMethodRS256)
+	m, err = jwkSigningMethod("PS384", rsaKey.Public())
+	a.NotError(err).Equal(m, jwt.SigningMethodPS384)
+	m, err = jwkSigningMethod("", ecKey.Public())
+	a.NotError(err).Equal(m, jwt.SigningMethodES256)
+	m, err = jwkSigningMethod("", edPub)
+	a.NotError(err).Equal(m, jwt.SigningMethodEdDSA)
+
+	_, err = jwkSigningMethod("ES384", ecKey.Public()) // 曲线不匹配
+	a.Error(err)
+	_, err = jwkSigningMethod("HS256", rsaKey.Public())
+	a.Error(err)
+	_, err = jwkSigningMethod("none", rsaKey.Public())
+	a.Error(err)
+	_, err = jwkSigningMethod("RS256", edPub)
+	a.Error(err)
+}
@@ -5,7 +5,7 @@
 // Package jwt JSON Web Tokens 验证
 //
 //	sign := NewSigner(...)
-//	v := NewVerifier[*jwt.RegisterClaims](nil, builder)
+//	v := NewVerifier[*jwt.RegisterClaims](nil, builder, nil)
 //
 //	// 添加多种编码方式
 //	sign.Add("hmac", jwt.SigningMethodHS256, []byte("secret"))
@@ -18,11 +18,14 @@
 package jwt
 
 import (
+	"context"
 	"io/fs"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth"
 )
 
 var errSigningMethodNotFound = web.NewLocaleError("not found jwt signing method")
@@ -34,6 +37,19 @@ type (
 		id   any
 		sign SigningMethod
 		key  any // 公钥或是私钥
+
+		// 以下仅对 [Signer] 有效
+
+		weight    int       // 签名时被选中的权重，0 表示不参与签名。
+		activate  time.Time // 开始参与签名的时间，零值表示立即参与。
+		exclusive bool      // 在 activate 之后是否作为唯一的签名密钥
+		retired   time.Time // 退役时间，退役之后不再参与签名，但仍会公开其公钥。
+
+		// 以下仅对 [Verifier] 有效
+
+		expires time.Time   // 过期时间，之后不再用于验证，零值表示永不过期。
+		source  *jwksSource // 密钥的来源，仅对从 JWKS 加载的密钥有效。
+		algs    []string    // 允许的 alg 报头，为空表示仅允许 none 和 sign.Alg()。
 	}
 
 	// JWT JWT 管理
@@ -66,8 +82,18 @@ func (j *JWT[T]) VerifiyRefresh(next web.HandlerFunc) web.HandlerFunc {
 // Middleware 解码用户的 token 并写入 [web.Context]
 func (j *JWT[T]) Middleware(next web.HandlerFunc) web.HandlerFunc { return j.v.Middleware(next) }
 
+// SetSink 指定接收验证相关事件的对象
+//
+// 参考 [Verifier.SetSink]。
+func (j *JWT[T]) SetSink(sink auth.Sink) { j.v.SetSink(sink) }
+
 func (j *JWT[T]) GetInfo(ctx *web.Context) (T, bool) { return j.v.GetInfo(ctx) }
 
+// SetExtractors 指定提取令牌的方式
+//
+// 参考 [Verifier.SetExtractors]。
+func (j *JWT[T]) SetExtractors(e ...Extractor) { j.v.SetExtractors(e...) }
+
 // Render 向客户端输出令牌
 //
 // 当前方法会将 accessClaims 进行签名，并返回 [web.Responser] 对象。
@@ -77,9 +103,16 @@ func (j *JWT[T]) Render(ctx *web.Context, status int, accessClaims Claims) web.R
 
 // Sign 对 claims 进行签名
 //
-// 算法从添加的库里随机选取。
+// 参考 [Signer.Sign]。
 func (j *JWT[T]) Sign(claims Claims) (string, error) { return j.s.Sign(claims) }
 
+// SignContext 对 claims 进行签名
+//
+// 参考 [Signer.SignContext]。
+func (j *JWT[T]) SignContext(ctx context.Context, claims Claims) (string, error) {
+	return j.s.SignContext(ctx, claims)
+}
+
 // AddHMAC 添加 HMAC 算法
 //
 // NOTE: 调用者需要保证每次重启之后，id 值不能改变，否则所有的登录信息 token 将失效。
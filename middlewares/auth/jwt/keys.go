@@ -0,0 +1,348 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+)
+
+func errDuplicateKey(id string) error { return web.NewLocaleError("duplicate jwt key %s", id) }
+
+// 返回私钥对应的公钥，HMAC 的密钥原样返回。
+func publicOf(k any) any {
+	if s, ok := k.(crypto.Signer); ok {
+		return s.Public()
+	}
+	return k
+}
+
+// 判断 pub 与 pvt 是否为同一密钥对
+//
+// HMAC 的密钥需要完全相同。
+func keyPairMatch(pub, pvt any) bool {
+	switch k := pvt.(type) {
+	case []byte:
+		p, ok := pub.([]byte)
+		return ok && bytes.Equal(p, k)
+	case crypto.Signer:
+		p, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+		return ok && p.Equal(k.Public())
+	default:
+		return false
+	}
+}
+
+// 验证密钥 k 是否可用于 sign
+//
+// k 可以是公钥、私钥或是 HMAC 的密钥。
+func checkKey(sign SigningMethod, k any) error {
+	if sign == nil || methodForKey(sign.Alg(), publicOf(k)) == nil {
+		return web.NewLocaleError("jwt key does not match signing method")
+	}
+	return nil
+}
+
+// 如果是 PEM 格式，返回其中的内容，否则原样返回。
+func pemBytes(data []byte) []byte {
+	if b, _ := pem.Decode(data); b != nil {
+		return b.Bytes
+	}
+	return data
+}
+
+// 解析私钥
+//
+// data 可以是 PEM 或是 DER 格式，优先采用 PKCS#8，同时兼容 PKCS#1 和 SEC 1。
+// 对于 HMAC，data 即为密钥本身。
+func parsePrivateKey(sign SigningMethod, data []byte) (any, error) {
+	if _, ok := sign.(*jwt.SigningMethodHMAC); ok {
+		return data, nil
+	}
+
+	der := pemBytes(data)
+	pvt, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		if k, err1 := x509.ParsePKCS1PrivateKey(der); err1 == nil {
+			pvt, err = k, nil
+		} else if k, err1 := x509.ParseECPrivateKey(der); err1 == nil {
+			pvt, err = k, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKey(sign, pvt); err != nil {
+		return nil, err
+	}
+	return pvt, nil
+}
+
+// 解析公钥
+//
+// data 可以是 PEM 或是 DER 格式的 PKIX 公钥，也可以是证书，同时兼容 PKCS#1 格式的 RSA 公钥。
+// 对于 HMAC，data 即为密钥本身。
+func parsePublicKey(sign SigningMethod, data []byte) (any, error) {
+	if _, ok := sign.(*jwt.SigningMethodHMAC); ok {
+		return data, nil
+	}
+
+	der := pemBytes(data)
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		if cert, err1 := x509.ParseCertificate(der); err1 == nil {
+			pub, err = cert.PublicKey, nil
+		} else if k, err1 := x509.ParsePKCS1PublicKey(der); err1 == nil {
+			pub, err = k, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKey(sign, pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// 解析 JWK
+//
+// alg 为 JWK 中未指定 alg 时采用的算法，为空则根据密钥的类型选择；
+// private 表示是否需要私钥，如果为 false，JWK 中包含私钥时也只返回其公钥部分。
+func parseJWK(data []byte, alg string, private bool) (id string, sign SigningMethod, k any, err error) {
+	jk := &jwk.Key{}
+	if err = json.Unmarshal(data, jk); err != nil {
+		return "", nil, nil, err
+	}
+	if jk.Kid == "" {
+		return "", nil, nil, web.NewLocaleError("jwk kid can not be empty")
+	}
+
+	pub, err := jk.PublicKey()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if jk.Alg != "" {
+		alg = jk.Alg
+	}
+	if sign, err = jwkSigningMethod(alg, pub); err != nil {
+		return "", nil, nil, err
+	}
+
+	if !private {
+		return jk.Kid, sign, pub, nil
+	}
+
+	if k, err = jk.PrivateKey(); err != nil {
+		return "", nil, nil, err
+	}
+	return jk.Kid, sign, k, nil
+}
+
+// 判断内容是否为 JSON 格式的 JWK
+func isJWK(data []byte) bool { return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) }
+
+// 从环境变量中读取 base64 编码的内容
+func readEnv(name string) ([]byte, error) {
+	val := os.Getenv(name)
+	if val == "" {
+		return nil, web.NewLocaleError("env %s is empty", name)
+	}
+	return decodeBase64(val)
+}
+
+// 解码 base64，同时兼容标准和 URL 两种编码，以及是否包含填充。
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if data, err := base64.RawStdEncoding.DecodeString(s); err == nil {
+		return data, nil
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// AddKey 添加私钥
+//
+// private 可以是 *rsa.PrivateKey、*ecdsa.PrivateKey、ed25519.PrivateKey 或是 HMAC 的 []byte，
+// 也可以是由外部签名的 [crypto.Signer]，可参考 [Signer.AddSigner]，且需要与 sign 相匹配。
+//
+// 与其它的 Add 方法不同，出错时返回错误而不是 panic。
+func (s *Signer) AddKey(id string, sign SigningMethod, private any) error {
+	if err := checkKey(sign, private); err != nil {
+		return err
+	}
+	return s.insertKey(id, sign, private)
+}
+
+// AddDER 添加 DER 格式的私钥
+//
+// der 为 PKCS#8 格式的私钥，同时兼容 PKCS#1 和 SEC 1，也可以是 PEM 格式。
+func (s *Signer) AddDER(id string, sign SigningMethod, der []byte) error {
+	pvt, err := parsePrivateKey(sign, der)
+	if err != nil {
+		return err
+	}
+	return s.insertKey(id, sign, pvt)
+}
+
+// AddJWK 添加 JSON 格式的 JWK 私钥
+//
+// kid 作为密钥的 ID，不能为空；alg 为空时根据密钥的类型选择默认的算法，oct 类型必须指定 alg。
+func (s *Signer) AddJWK(data []byte) error {
+	id, sign, pvt, err := parseJWK(data, "", true)
+	if err != nil {
+		return err
+	}
+	return s.insertKey(id, sign, pvt)
+}
+
+// AddFromEnv 从环境变量 name 中加载私钥
+//
+// 环境变量的值为 base64 编码的内容，解码之后可以是 PEM 或是 DER 格式，对于 HMAC 则为密钥本身。
+func (s *Signer) AddFromEnv(id string, sign SigningMethod, name string) error {
+	data, err := readEnv(name)
+	if err != nil {
+		return err
+	}
+	return s.AddDER(id, sign, data)
+}
+
+// AddKey 添加公钥
+//
+// public 可以是 *rsa.PublicKey、*ecdsa.PublicKey、ed25519.PublicKey 或是 HMAC 的 []byte，
+// 且需要与 sign 相匹配。
+//
+// 与其它的 Add 方法不同，出错时返回错误而不是 panic。
+func (j *Verifier[T]) AddKey(id string, sign SigningMethod, public any) error {
+	if err := checkKey(sign, public); err != nil {
+		return err
+	}
+	return j.insertKey(id, sign, public)
+}
+
+// AddDER 添加 DER 格式的公钥
+//
+// der 为 PKIX 格式的公钥，也可以是证书或是 PKCS#1 格式的 RSA 公钥，同时兼容 PEM 格式。
+func (j *Verifier[T]) AddDER(id string, sign SigningMethod, der []byte) error {
+	pub, err := parsePublicKey(sign, der)
+	if err != nil {
+		return err
+	}
+	return j.insertKey(id, sign, pub)
+}
+
+// AddJWK 添加 JSON 格式的 JWK 公钥
+//
+// 如果 JWK 中包含私钥，仅采用其公钥部分。其它说明可参考 [Signer.AddJWK]。
+func (j *Verifier[T]) AddJWK(data []byte) error {
+	id, sign, pub, err := parseJWK(data, "", false)
+	if err != nil {
+		return err
+	}
+	return j.insertKey(id, sign, pub)
+}
+
+// AddFromEnv 从环境变量 name 中加载公钥
+//
+// 环境变量的格式可参考 [Signer.AddFromEnv]。
+func (j *Verifier[T]) AddFromEnv(id string, sign SigningMethod, name string) error {
+	data, err := readEnv(name)
+	if err != nil {
+		return err
+	}
+	return j.AddDER(id, sign, data)
+}
+
+// 同时向 [Verifier] 和 [Signer] 添加密钥，任意一方失败都不会添加。
+func (j *JWT[T]) insertKey(id string, sign SigningMethod, pub, pvt any) error {
+	if err := j.v.insertKey(id, sign, pub); err != nil {
+		return err
+	}
+	if err := j.s.insertKey(id, sign, pvt); err != nil {
+		j.v.Remove(id)
+		return err
+	}
+	return nil
+}
+
+// AddKey 添加密钥对
+//
+// 参数说明可参考 [Signer.AddKey] 和 [Verifier.AddKey]，pub 为空时从 pvt 中获取公钥，
+// 否则 pub 必须与 pvt 相匹配。
+func (j *JWT[T]) AddKey(id string, sign SigningMethod, pub, pvt any) error {
+	if pub == nil {
+		pub = publicOf(pvt)
+	} else if !keyPairMatch(pub, pvt) {
+		return web.NewLocaleError("jwt public key %s does not match private key", id)
+	}
+
+	if err := checkKey(sign, pub); err != nil {
+		return err
+	}
+	if err := checkKey(sign, pvt); err != nil {
+		return err
+	}
+	return j.insertKey(id, sign, pub, pvt)
+}
+
+// AddDER 添加 DER 格式的密钥对
+//
+// 参数说明可参考 [Signer.AddDER] 和 [Verifier.AddDER]，pub 为空时从 pvt 中获取公钥。
+func (j *JWT[T]) AddDER(id string, sign SigningMethod, pub, pvt []byte) error {
+	private, err := parsePrivateKey(sign, pvt)
+	if err != nil {
+		return err
+	}
+
+	var public any
+	if len(pub) > 0 {
+		if public, err = parsePublicKey(sign, pub); err != nil {
+			return err
+		}
+	}
+	return j.AddKey(id, sign, public, private)
+}
+
+// AddJWK 添加 JSON 格式的 JWK 密钥
+//
+// data 必须包含私钥部分，其它说明可参考 [Signer.AddJWK]。
+func (j *JWT[T]) AddJWK(data []byte) error {
+	id, sign, pvt, err := parseJWK(data, "", true)
+	if err != nil {
+		return err
+	}
+	return j.AddKey(id, sign, nil, pvt)
+}
+
+// AddFromEnv 从环境变量中加载密钥对
+//
+// pub 和 pvt 分别为保存公钥和私钥的环境变量名称，pub 为空时从私钥中获取公钥。
+// 环境变量的格式可参考 [Signer.AddFromEnv]。
+func (j *JWT[T]) AddFromEnv(id string, sign SigningMethod, pub, pvt string) error {
+	private, err := readEnv(pvt)
+	if err != nil {
+		return err
+	}
+
+	var public []byte
+	if pub != "" {
+		if public, err = readEnv(pub); err != nil {
+			return err
+		}
+	}
+	return j.AddDER(id, sign, public, private)
+}
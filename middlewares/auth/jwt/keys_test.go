@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+)
+
+// 验证 Signer 中的密钥 id 签发的令牌可以被 Verifier 验证
+func checkKeyPair(a *assert.Assertion, j *JWT[*testClaims], id string) {
+	a.TB().Helper()
+
+	k := j.s.findKey(id)
+	a.NotNil(k, id)
+
+	t := jwt.NewWithClaims(k.sign, &testClaims{ID: 1})
+	t.Header["kid"] = id
+	token, err := t.SignedString(k.key)
+	a.NotError(err, id)
+
+	c, err := j.v.parse(token)
+	a.NotError(err, id).Equal(c.ID, 1, id)
+}
+
+func readDER(a *assert.Assertion, name string) []byte {
+	data, err := os.ReadFile("./testdata/" + name)
+	a.NotError(err)
+	b, _ := pem.Decode(data)
+	a.NotNil(b)
+	return b.Bytes
+}
+
+func ecJWK(a *assert.Assertion, kid string) ([]byte, *ecdsa.PrivateKey) {
+	pvt, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+
+	k, err := jwk.FromPublicKey(kid, "", &pvt.PublicKey)
+	a.NotError(err)
+	k.D = base64.RawURLEncoding.EncodeToString(pvt.D.FillBytes(make([]byte, 32)))
+
+	data, err := json.Marshal(k)
+	a.NotError(err)
+	return data, pvt
+}
+
+func TestJWT_AddKey(t *testing.T) {
+	a := assert.New(t, false)
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+
+	pvt, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	a.NotError(j.AddKey("ec", jwt.SigningMethodES256, nil, pvt))
+	checkKeyPair(a, j, "ec")
+
+	a.NotError(j.AddKey("hmac", jwt.SigningMethodHS256, nil, []byte("secret")))
+	checkKeyPair(a, j, "hmac")
+
+	// 曲线不匹配
+	a.Error(j.AddKey("es384", jwt.SigningMethodES384, nil, pvt))
+	a.Nil(j.v.findKey("es384")).Nil(j.s.findKey("es384"))
+
+	// 公私钥类型不匹配
+	a.Error(j.AddKey("mixed", jwt.SigningMethodES256, []byte("secret"), pvt))
+
+	// 公私钥不是同一密钥对
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+	a.ErrorString(j.AddKey("pair", jwt.SigningMethodES256, &other.PublicKey, pvt), "pair").
+		Nil(j.v.findKey("pair")).
+		Nil(j.s.findKey("pair"))
+	a.NotError(j.AddKey("pair", jwt.SigningMethodES256, &pvt.PublicKey, pvt))
+	a.Error(j.AddKey("hmac2", jwt.SigningMethodHS256, []byte("other"), []byte("secret")))
+
+	// 重复的 ID
+	a.Error(j.AddKey("ec", jwt.SigningMethodES256, nil, pvt))
+
+	// 仅 Signer 中存在，添加失败时 Verifier 也不会保留。
+	j.s.AddHMAC("signer", jwt.SigningMethodHS256, []byte("secret"))
+	a.Error(j.AddKey("signer", jwt.SigningMethodHS256, nil, []byte("secret")))
+	a.Nil(j.v.findKey("signer"))
+
+	// Verifier 和 Signer 单独添加
+	v := NewVerifier[*testClaims](nil, nil)
+	a.NotError(v.AddKey("ec", jwt.SigningMethodES256, &pvt.PublicKey)).
+		Error(v.AddKey("ec", jwt.SigningMethodES256, &pvt.PublicKey)).
+		Error(v.AddKey("rsa", jwt.SigningMethodRS256, &pvt.PublicKey))
+	s := NewSigner(time.Hour, 0, nil)
+	a.NotError(s.AddKey("ec", jwt.SigningMethodES256, pvt)).
+		Error(s.AddKey("rsa", jwt.SigningMethodRS256, pvt)).
+		Error(s.AddKey("nil", nil, pvt))
+}
+
+func TestJWT_AddDER(t *testing.T) {
+	a := assert.New(t, false)
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+
+	a.NotError(j.AddDER("rsa", jwt.SigningMethodRS256, readDER(a, "rsa-public.pem"), readDER(a, "rsa-private.pem")))
+	checkKeyPair(a, j, "rsa")
+
+	a.NotError(j.AddDER("ec", jwt.SigningMethodES256, nil, readDER(a, "ec256-private.pem")))
+	checkKeyPair(a, j, "ec")
+
+	// PEM 格式也可以
+	pvt, err := os.ReadFile("./testdata/ed25519-private.pem")
+	a.NotError(err)
+	a.NotError(j.AddDER("ed", jwt.SigningMethodEdDSA, readDER(a, "ed25519-public.pem"), pvt))
+	checkKeyPair(a, j, "ed")
+
+	a.NotError(j.AddDER("hmac", jwt.SigningMethodHS256, nil, []byte("secret")))
+	checkKeyPair(a, j, "hmac")
+
+	a.Error(j.AddDER("invalid", jwt.SigningMethodRS256, nil, []byte("invalid")))
+	a.Error(j.AddDER("invalid", jwt.SigningMethodRS256, []byte("invalid"), readDER(a, "rsa-private.pem")))
+	a.Error(j.AddDER("invalid", jwt.SigningMethodES256, nil, readDER(a, "rsa-private.pem")))
+	a.Error(j.AddDER("invalid", jwt.SigningMethodRS256, readDER(a, "ec256-public.pem"), readDER(a, "rsa-private.pem")))
+	a.Nil(j.v.findKey("invalid")).Nil(j.s.findKey("invalid"))
+}
+
+func TestJWT_AddJWK(t *testing.T) {
+	a := assert.New(t, false)
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+
+	data, pvt := ecJWK(a, "ec")
+	a.NotError(j.AddJWK(data))
+	checkKeyPair(a, j, "ec")
+	a.Equal(j.s.findKey("ec").sign, jwt.SigningMethodES256)
+
+	a.NotError(j.AddJWK([]byte(`{"kty":"oct","kid":"hmac","alg":"HS384","k":"c2VjcmV0"}`)))
+	checkKeyPair(a, j, "hmac")
+
+	// Verifier 仅采用公钥部分
+	v := NewVerifier[*testClaims](nil, nil)
+	a.NotError(v.AddJWK(data))
+	a.Equal(v.findKey("ec").key, &pvt.PublicKey)
+
+	pub, err := jwk.FromPublicKey("pub", "", &pvt.PublicKey)
+	a.NotError(err)
+	pubData, err := json.Marshal(pub)
+	a.NotError(err)
+	a.NotError(v.AddJWK(pubData))
+
+	// Signer 需要私钥
+	s := NewSigner(time.Hour, 0, nil)
+	a.Error(s.AddJWK(pubData)).
+		NotError(s.AddJWK(data))
+
+	a.Error(j.AddJWK([]byte(`{"kty":"oct","k":"c2VjcmV0","alg":"HS256"}`))) // 缺少 kid
+	a.Error(j.AddJWK([]byte(`{"kty":"oct","kid":"oct","k":"c2VjcmV0"}`)))   // 缺少 alg
+	a.Error(j.AddJWK([]byte(`{"kty":`)))
+	a.Error(j.AddJWK(data)) // 重复
+}
+
+func TestJWT_AddFromEnv(t *testing.T) {
+	a := assert.New(t, false)
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+
+	env := func(name, file string) {
+		data, err := os.ReadFile("./testdata/" + file)
+		a.NotError(err)
+		t.Setenv(name, base64.StdEncoding.EncodeToString(data))
+	}
+	env("JWT_RSA_PUBLIC", "rsa-public.pem")
+	env("JWT_RSA_PRIVATE", "rsa-private.pem")
+	t.Setenv("JWT_EC_PRIVATE", base64.RawURLEncoding.EncodeToString(readDER(a, "ec256-private.pem")))
+	t.Setenv("JWT_HMAC", base64.StdEncoding.EncodeToString([]byte("secret")))
+
+	a.NotError(j.AddFromEnv("rsa", jwt.SigningMethodRS256, "JWT_RSA_PUBLIC", "JWT_RSA_PRIVATE"))
+	checkKeyPair(a, j, "rsa")
+	a.NotError(j.AddFromEnv("ec", jwt.SigningMethodES256, "", "JWT_EC_PRIVATE"))
+	checkKeyPair(a, j, "ec")
+	a.NotError(j.AddFromEnv("hmac", jwt.SigningMethodHS256, "", "JWT_HMAC"))
+	checkKeyPair(a, j, "hmac")
+
+	v := NewVerifier[*testClaims](nil, nil)
+	a.NotError(v.AddFromEnv("rsa", jwt.SigningMethodRS256, "JWT_RSA_PUBLIC"))
+	s := NewSigner(time.Hour, 0, nil)
+	a.NotError(s.AddFromEnv("rsa", jwt.SigningMethodRS256, "JWT_RSA_PRIVATE"))
+
+	a.Error(j.AddFromEnv("not-exists", jwt.SigningMethodRS256, "", "JWT_NOT_EXISTS"))
+	a.Error(j.AddFromEnv("not-exists", jwt.SigningMethodRS256, "JWT_NOT_EXISTS", "JWT_RSA_PRIVATE"))
+	t.Setenv("JWT_INVALID", "!!!")
+	a.Error(j.AddFromEnv("invalid", jwt.SigningMethodRS256, "", "JWT_INVALID"))
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+// 验证策略失败时返回的问题类型，状态码均为 401。
+const (
+	ProblemTokenExpired     = "jwt-token-expired"
+	ProblemTokenNotValidYet = "jwt-token-not-valid-yet"
+	ProblemTokenTooOld      = "jwt-token-too-old"
+	ProblemInvalidIssuer    = "jwt-invalid-issuer"
+	ProblemInvalidAudience  = "jwt-invalid-audience"
+	ProblemMissingClaim     = "jwt-missing-claim"
+	ProblemInvalidClaims    = "jwt-invalid-claims"
+)
+
+// 验证策略失败的原因
+//
+// 令牌过期采用 [auth.ReasonExpired]。
+const (
+	ReasonNotValidYet   = "not-valid-yet"  // 未到 nbf 或是 iat 指定的时间
+	ReasonTooOld        = "too-old"        // 超过了 [Policy.MaxAge]
+	ReasonInvalidIssuer = "invalid-issuer" // iss 不在 [Policy.Issuers] 之中
+	ReasonInvalidAud    = "invalid-aud"    // aud 与 [Policy.Audiences] 没有交集
+	ReasonMissingClaim  = "missing-claim"  // 缺少 [Policy.Required] 中的声明
+	ReasonInvalidClaims = "invalid-claims" // [Policy.Validators] 返回错误
+)
+
+// 失败原因与问题类型的对应关系
+var policyProblems = map[string]string{
+	auth.ReasonExpired:  ProblemTokenExpired,
+	ReasonNotValidYet:   ProblemTokenNotValidYet,
+	ReasonTooOld:        ProblemTokenTooOld,
+	ReasonInvalidIssuer: ProblemInvalidIssuer,
+	ReasonInvalidAud:    ProblemInvalidAudience,
+	ReasonMissingClaim:  ProblemMissingClaim,
+	ReasonInvalidClaims: ProblemInvalidClaims,
+}
+
+// 可以出现在 [Policy.Required] 中的声明
+var requiredClaims = []string{"exp", "iat", "nbf", "iss", "sub", "aud"}
+
+type (
+	// Policy 令牌中注册声明的验证策略
+	//
+	// 所有字段的零值均表示不作验证。
+	Policy[T Claims] struct {
+		// 允许的签发者
+		//
+		// 令牌的 iss 必须是其中之一。
+		Issuers []string
+
+		// 允许的接收者
+		//
+		// 令牌的 aud 至少需要包含其中之一。
+		Audiences []string
+
+		// 验证 exp、nbf、iat 以及 MaxAge 时允许的时间误差
+		Leeway time.Duration
+
+		// 必须存在的声明
+		//
+		// 可以是 exp、iat、nbf、iss、sub 和 aud。
+		Required []string
+
+		// 令牌的最长使用时间
+		//
+		// 从 iat 开始计算，指定此值时 iat 是必须的。
+		MaxAge time.Duration
+
+		// 自定义的验证函数
+		//
+		// 在其它验证都通过之后按顺序调用。
+		Validators []func(T) error
+	}
+
+	policyError struct {
+		reason string
+		err    error
+	}
+)
+
+func (e *policyError) Error() string { return e.err.Error() }
+
+func (e *policyError) Unwrap() error { return e.err }
+
+// SetPolicy 设置验证策略
+//
+// 设置之后，验证失败时会根据失败的原因返回不同的问题类型，比如 [ProblemTokenExpired] 等，
+// 同时 [auth.Event.Reason] 也会是对应的值，比如 [ReasonInvalidIssuer] 等。
+//
+// NOTE: 同一个 [web.Server] 只能调用一次，该方法会向 s 注册所有的问题类型。
+func (j *Verifier[T]) SetPolicy(s web.Server, p *Policy[T]) {
+	if p == nil {
+		panic("参数 p 不能为空")
+	}
+	for _, c := range p.Required {
+		if !slices.Contains(requiredClaims, c) {
+			panic(fmt.Sprintf("不支持的声明 %s", c))
+		}
+	}
+
+	s.Problems().Add(http.StatusUnauthorized,
+		&web.LocaleProblem{ID: ProblemTokenExpired, Title: web.Phrase("jwt token expired"), Detail: web.Phrase("the token has expired, refresh it or login again")},
+		&web.LocaleProblem{ID: ProblemTokenNotValidYet, Title: web.Phrase("jwt token not valid yet"), Detail: web.Phrase("the token can not be used before its nbf or iat time")},
+		&web.LocaleProblem{ID: ProblemTokenTooOld, Title: web.Phrase("jwt token too old"), Detail: web.Phrase("the token has exceeded the maximum age since it was issued")},
+		&web.LocaleProblem{ID: ProblemInvalidIssuer, Title: web.Phrase("untrusted jwt issuer"), Detail: web.Phrase("the token was issued by an untrusted issuer")},
+		&web.LocaleProblem{ID: ProblemInvalidAudience, Title: web.Phrase("untrusted jwt audience"), Detail: web.Phrase("the token is not intended for this service")},
+		&web.LocaleProblem{ID: ProblemMissingClaim, Title: web.Phrase("missing required jwt claim"), Detail: web.Phrase("the token is missing a required claim")},
+		&web.LocaleProblem{ID: ProblemInvalidClaims, Title: web.Phrase("invalid jwt claims"), Detail: web.Phrase("the token claims are rejected by the validation policy")},
+	)
+
+	opts := []jwt.ParserOption{jwt.WithLeeway(p.Leeway), jwt.WithIssuedAt()}
+	if slices.Contains(p.Required, "exp") {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+
+	j.policy = p
+	j.parser = jwt.NewParser(opts...)
+}
+
+// 验证由 parser 之外的其它策略
+func (p *Policy[T]) validate(c T) error {
+	for _, name := range p.Required {
+		if !hasClaim(c, name) {
+			return &policyError{reason: ReasonMissingClaim, err: web.NewLocaleError("missing jwt claim %s", name)}
+		}
+	}
+
+	if len(p.Issuers) > 0 {
+		iss, err := c.GetIssuer()
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(p.Issuers, iss) {
+			return &policyError{reason: ReasonInvalidIssuer, err: web.NewLocaleError("invalid jwt issuer %s", iss)}
+		}
+	}
+
+	if len(p.Audiences) > 0 {
+		aud, err := c.GetAudience()
+		if err != nil {
+			return err
+		}
+		if slices.IndexFunc(aud, func(a string) bool { return slices.Contains(p.Audiences, a) }) < 0 {
+			return &policyError{reason: ReasonInvalidAud, err: web.NewLocaleError("invalid jwt audience %s", aud)}
+		}
+	}
+
+	if p.MaxAge > 0 {
+		iat, err := c.GetIssuedAt()
+		if err != nil {
+			return err
+		}
+		if iat == nil {
+			return &policyError{reason: ReasonMissingClaim, err: web.NewLocaleError("missing jwt claim %s", "iat")}
+		}
+		if time.Since(iat.Time) > p.MaxAge+p.Leeway {
+			return &policyError{reason: ReasonTooOld, err: web.NewLocaleError("jwt token is too old")}
+		}
+	}
+
+	for _, v := range p.Validators {
+		if err := v(c); err != nil {
+			return &policyError{reason: ReasonInvalidClaims, err: err}
+		}
+	}
+
+	return nil
+}
+
+func hasClaim(c jwt.Claims, name string) bool {
+	switch name {
+	case "exp":
+		t, err := c.GetExpirationTime()
+		return err == nil && t != nil
+	case "iat":
+		t, err := c.GetIssuedAt()
+		return err == nil && t != nil
+	case "nbf":
+		t, err := c.GetNotBefore()
+		return err == nil && t != nil
+	case "iss":
+		s, err := c.GetIssuer()
+		return err == nil && s != ""
+	case "sub":
+		s, err := c.GetSubject()
+		return err == nil && s != ""
+	case "aud":
+		s, err := c.GetAudience()
+		return err == nil && len(s) > 0
+	default:
+		return false
+	}
+}
+
+// 根据错误信息判断验证失败的原因
+func failReason(err error) string {
+	var pe *policyError
+	switch {
+	case errors.As(err, &pe):
+		return pe.reason
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return auth.ReasonExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ReasonNotValidYet
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return ReasonMissingClaim
+	default:
+		return auth.ReasonInvalidCredential
+	}
+}
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+type policyClaims struct {
+	jwt.RegisteredClaims
+	Tenant string `json:"tenant,omitempty"`
+}
+
+func (c *policyClaims) BuildRefresh(string, *web.Context) Claims { return &policyClaims{} }
+
+func (c *policyClaims) BaseToken() string { return "" }
+
+func TestVerifier_SetPolicy(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	var reason string
+	reasonMux := &sync.Mutex{}
+	sink := auth.SinkFunc(func(e *auth.Event) {
+		reasonMux.Lock()
+		defer reasonMux.Unlock()
+		reason = e.Reason
+	})
+
+	b := NewCacheBlocker[*policyClaims](s, "test_", time.Hour, 2*time.Hour)
+	v := NewVerifier(b, func() *policyClaims { return &policyClaims{} })
+	v.SetSink(sink)
+	v.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	signer := NewSigner(time.Hour, 0, nil)
+	signer.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	a.PanicString(func() {
+		v.SetPolicy(s, nil)
+	}, "参数 p 不能为空")
+
+	a.PanicString(func() {
+		v.SetPolicy(s, &Policy[*policyClaims]{Required: []string{"jti"}})
+	}, "不支持的声明 jti")
+
+	v.SetPolicy(s, &Policy[*policyClaims]{
+		Issuers:   []string{"https://issuer.example.com"},
+		Audiences: []string{"api", "admin"},
+		Leeway:    time.Minute,
+		Required:  []string{"exp", "sub"},
+		MaxAge:    time.Hour,
+		Validators: []func(*policyClaims) error{
+			func(c *policyClaims) error {
+				if c.Tenant == "" {
+					return errors.New("tenant is empty")
+				}
+				return nil
+			},
+		},
+	})
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", v.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	now := time.Now()
+	valid := func() *policyClaims {
+		return &policyClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "https://issuer.example.com",
+				Subject:   "1",
+				Audience:  jwt.ClaimStrings{"web", "api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(now),
+			},
+			Tenant: "t1",
+		}
+	}
+
+	get := func(name string, c *policyClaims, problem, r string) {
+		token, err := signer.Sign(c)
+		a.NotError(err)
+
+		req := servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, "Bearer "+token).
+			Do(nil)
+
+		if problem == "" {
+			req.Status(http.StatusNoContent)
+			return
+		}
+
+		req.Status(http.StatusUnauthorized).
+			BodyFunc(func(a *assert.Assertion, body []byte) {
+				a.Contains(string(body), problem, name)
+			})
+
+		reasonMux.Lock()
+		defer reasonMux.Unlock()
+		a.Equal(reason, r, name)
+	}
+
+	get("valid", valid(), "", "")
+
+	c := valid()
+	c.ExpiresAt = jwt.NewNumericDate(now.Add(-2 * time.Minute))
+	get("expired", c, ProblemTokenExpired, auth.ReasonExpired)
+
+	c = valid()
+	c.ExpiresAt = jwt.NewNumericDate(now.Add(-30 * time.Second))
+	get("leeway", c, "", "")
+
+	c = valid()
+	c.NotBefore = jwt.NewNumericDate(now.Add(time.Hour))
+	get("nbf", c, ProblemTokenNotValidYet, ReasonNotValidYet)
+
+	c = valid()
+	c.IssuedAt = jwt.NewNumericDate(now.Add(time.Hour))
+	get("iat in future", c, ProblemTokenNotValidYet, ReasonNotValidYet)
+
+	c = valid()
+	c.Issuer = "https://other.example.com"
+	get("iss", c, ProblemInvalidIssuer, ReasonInvalidIssuer)
+
+	c = valid()
+	c.Audience = jwt.ClaimStrings{"web"}
+	get("aud", c, ProblemInvalidAudience, ReasonInvalidAud)
+
+	c = valid()
+	c.ExpiresAt = nil
+	get("no exp", c, ProblemMissingClaim, ReasonMissingClaim)
+
+	c = valid()
+	c.Subject = ""
+	get("no sub", c, ProblemMissingClaim, ReasonMissingClaim)
+
+	c = valid()
+	c.IssuedAt = nil
+	get("no iat", c, ProblemMissingClaim, ReasonMissingClaim)
+
+	c = valid()
+	c.IssuedAt = jwt.NewNumericDate(now.Add(-2 * time.Hour))
+	get("max age", c, ProblemTokenTooOld, ReasonTooOld)
+
+	c = valid()
+	c.Tenant = ""
+	get("validator", c, ProblemInvalidClaims, ReasonInvalidClaims)
+
+	// 签名错误
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer invalid").
+		Do(nil).
+		Status(http.StatusUnauthorized).
+		BodyFunc(func(a *assert.Assertion, body []byte) {
+			a.NotContains(string(body), "jwt-")
+		})
+	reasonMux.Lock()
+	a.Equal(reason, auth.ReasonInvalidCredential)
+	reasonMux.Unlock()
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/issue9/cache"
+)
+
+const (
+	tokenPrefix   = "token_"  // 拉黑的令牌
+	revokePrefix  = "revoke_" // 吊销记录，包括主体、会话和家族等。
+	subjectPrefix = "sub_"
+	sessionPrefix = "sid_"
+	epochKey      = "epoch"
+)
+
+type (
+	// SessionClaims 包含设备或会话 ID 的 [Claims]
+	SessionClaims interface {
+		Claims
+
+		// Session 令牌所属的设备或会话 ID
+		//
+		// 为空表示不属于任何会话。
+		Session() string
+	}
+
+	// RevokeBlocker 支持按主体、会话以及时间吊销令牌的 [Blocker]
+	//
+	// 吊销记录的有效期与刷新令牌的拉黑时间相同，
+	// 所以该时间不应该小于刷新令牌的有效期。
+	RevokeBlocker interface {
+		// RevokeSubject 吊销主体 sub 在 before 之前签发的所有令牌
+		//
+		// 根据令牌的 sub 和 iat 进行判断，没有 iat 的令牌无法判断签发时间，也会被吊销。
+		// iat 的精度为秒，before 也会被截断至秒，与 before 处于同一秒内签发的令牌同样会被吊销。
+		RevokeSubject(sub string, before time.Time) error
+
+		// RevokeSession 吊销设备或会话 sid 的所有令牌
+		//
+		// 需要 [Claims] 实现 [SessionClaims]。
+		RevokeSession(sid string) error
+
+		// RevokeAll 吊销在 before 之前签发的所有令牌
+		//
+		// 对 iat 的处理与 RevokeSubject 相同。
+		RevokeAll(before time.Time) error
+	}
+)
+
+func (d *cacheBlocker[T]) RevokeSubject(sub string, before time.Time) error {
+	return d.setTime(subjectPrefix+sub, before)
+}
+
+func (d *cacheBlocker[T]) RevokeSession(sid string) error {
+	return d.setRevoked(sessionPrefix + sid)
+}
+
+func (d *cacheBlocker[T]) RevokeAll(before time.Time) error { return d.setTime(epochKey, before) }
+
+// 保存时间 t，精度为秒。如果已经存在相同或是更晚的时间，则不作修改。
+//
+// NOTE: 读取和写入由 revokeMux 保护，仅保证当前进程内的原子性。
+func (d *cacheBlocker[T]) setTime(key string, t time.Time) error {
+	d.revokeMux.Lock()
+	defer d.revokeMux.Unlock()
+
+	sec := t.Unix()
+	if prev, found := d.getTime(key); found && prev >= sec {
+		return nil
+	}
+
+	err := d.revoke.Set(key, sec, d.refreshTTL)
+	if errors.Is(err, cache.ErrCacheMiss()) {
+		return nil
+	}
+	return err
+}
+
+// 获取 setTime 保存的时间，以秒为单位。
+func (d *cacheBlocker[T]) getTime(key string) (int64, bool) {
+	var val int64
+	if err := d.revoke.Get(key, &val); err != nil {
+		return 0, false
+	}
+	return val, true
+}
+
+// 记录 key 已经被吊销，有效期与刷新令牌的拉黑时间相同。
+func (d *cacheBlocker[T]) setRevoked(key string) error {
+	err := d.revoke.Set(key, true, d.refreshTTL)
+	if errors.Is(err, cache.ErrCacheMiss()) {
+		return nil
+	}
+	return err
+}
+
+func (d *cacheBlocker[T]) isRevoked(key string) bool { return d.revoke.Exists(key) }
+
+// 判断签发时间为 iat 的令牌是否已经被 key 对应的时间吊销
+//
+// iat 为空表示令牌没有签发时间，只要存在吊销记录即视为已经吊销。
+func (d *cacheBlocker[T]) revokedBefore(key string, iat *int64) bool {
+	before, found := d.getTime(key)
+	if !found {
+		return false
+	}
+	return iat == nil || *iat <= before
+}
+
+func (d *cacheBlocker[T]) ClaimsIsBlocked(c T) bool {
+	if sc, ok := any(c).(SessionClaims); ok {
+		if sid := sc.Session(); sid != "" && d.isRevoked(sessionPrefix+sid) {
+			return true
+		}
+	}
+
+	var iat *int64
+	if t, err := c.GetIssuedAt(); err == nil && t != nil {
+		sec := t.Unix()
+		iat = &sec
+	}
+
+	if d.revokedBefore(epochKey, iat) {
+		return true
+	}
+
+	if sub, err := c.GetSubject(); err == nil && sub != "" && d.revokedBefore(subjectPrefix+sub, iat) {
+		return true
+	}
+
+	return false
+}
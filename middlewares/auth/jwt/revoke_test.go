@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+)
+
+var _ RevokeBlocker = &cacheBlocker[*testClaims]{}
+
+func TestCacheBlocker_revoke(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := NewCacheBlocker[*userClaims](s, "test_", time.Hour, 2*time.Hour)
+	rb := b.(RevokeBlocker)
+	now := time.Now().Truncate(time.Second)
+
+	claims := func(sub, sid string, iat time.Time) *userClaims {
+		c := &userClaims{SID: sid}
+		c.Subject = sub
+		if !iat.IsZero() {
+			c.IssuedAt = jwt.NewNumericDate(iat)
+		}
+		return c
+	}
+
+	old := claims("1", "s1", now.Add(-time.Hour))
+	c2 := claims("2", "s2", now.Add(-time.Hour))
+	a.False(b.ClaimsIsBlocked(old)).False(b.ClaimsIsBlocked(c2))
+
+	// sub
+	a.NotError(rb.RevokeSubject("1", now))
+	a.True(b.ClaimsIsBlocked(old)).
+		True(b.ClaimsIsBlocked(claims("1", "", time.Time{}))). // 没有 iat
+		True(b.ClaimsIsBlocked(claims("1", "", now))).         // 同一秒内签发
+		False(b.ClaimsIsBlocked(claims("1", "", now.Add(time.Second)))).
+		False(b.ClaimsIsBlocked(c2))
+
+	// before 的精度为秒
+	a.NotError(rb.RevokeSubject("5", now.Add(500*time.Millisecond)))
+	a.True(b.ClaimsIsBlocked(claims("5", "", now))).
+		False(b.ClaimsIsBlocked(claims("5", "", now.Add(time.Second))))
+
+	// 更早的时间不会覆盖已有的记录
+	a.NotError(rb.RevokeSubject("1", now.Add(-2*time.Hour)))
+	a.True(b.ClaimsIsBlocked(old))
+	a.NotError(rb.RevokeSubject("1", now.Add(time.Hour)))
+	a.True(b.ClaimsIsBlocked(claims("1", "", now.Add(time.Minute))))
+
+	// sid
+	c3 := claims("3", "s3", now.Add(time.Hour))
+	a.NotError(rb.RevokeSession("s2"))
+	a.True(b.ClaimsIsBlocked(c2)).
+		False(b.ClaimsIsBlocked(c3)).
+		False(b.ClaimsIsBlocked(claims("2", "", now)))
+
+	// epoch
+	a.NotError(rb.RevokeAll(now))
+	a.True(b.ClaimsIsBlocked(claims("4", "", now.Add(-time.Second)))).
+		True(b.ClaimsIsBlocked(claims("4", "", time.Time{}))).
+		True(b.ClaimsIsBlocked(claims("4", "", now))).
+		False(b.ClaimsIsBlocked(claims("4", "", now.Add(time.Second)))).
+		False(b.ClaimsIsBlocked(c3))
+
+	// 吊销记录与拉黑的令牌处于不同的命名空间
+	a.NotError(b.BlockToken(sessionPrefix+"s6", true))
+	a.False(b.ClaimsIsBlocked(claims("6", "s6", now.Add(time.Hour))))
+	a.NotError(rb.RevokeSession("s7"))
+	a.False(b.TokenIsBlocked(sessionPrefix + "s7")).
+		False(b.TokenIsBlocked(revokePrefix + sessionPrefix + "s7"))
+
+	// 并发写入时保留最晚的时间
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.NotError(rb.RevokeSubject("8", now.Add(time.Duration(i)*time.Second)))
+		}()
+	}
+	wg.Wait()
+	a.True(b.ClaimsIsBlocked(claims("8", "", now.Add(9*time.Second)))).
+		False(b.ClaimsIsBlocked(claims("8", "", now.Add(10*time.Second))))
+
+	// 不影响其它 Blocker
+	b2 := NewCacheBlocker[*userClaims](s, "other_", time.Hour, 2*time.Hour)
+	a.False(b2.ClaimsIsBlocked(old)).False(b2.ClaimsIsBlocked(c2))
+}
+
+func TestVerifier_revoke(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := NewCacheBlocker[*userClaims](s, "test_", time.Hour, 2*time.Hour)
+	j := New(b, func() *userClaims { return &userClaims{} }, time.Hour, 2*time.Hour, nil)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", j.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+	r.Post("/refresh", j.VerifiyRefresh(func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, NewUserClaims[int64](1, &userPayload{}))
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	now := time.Now().Truncate(time.Second)
+	sign := func(uid int64, sid string, iat time.Time) string {
+		c := NewUserClaims[int64](uid, &userPayload{})
+		c.SID = sid
+		c.SetTimes(iat, iat.Add(time.Hour))
+		token, err := j.Sign(c)
+		a.NotError(err)
+		return token
+	}
+
+	get := func(token string, status int) {
+		a.TB().Helper()
+		servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, "Bearer "+token).
+			Do(nil).
+			Status(status)
+	}
+
+	t1 := sign(1, "d1", now.Add(-time.Minute))
+	t2 := sign(2, "d2", now.Add(-time.Minute))
+	get(t1, http.StatusNoContent)
+	get(t2, http.StatusNoContent)
+
+	rb := b.(RevokeBlocker)
+	a.NotError(rb.RevokeSubject("1", now))
+	get(t1, http.StatusUnauthorized)
+	get(t2, http.StatusNoContent)
+	get(sign(1, "d1", now.Add(time.Second)), http.StatusNoContent)
+
+	a.NotError(rb.RevokeSession("d2"))
+	get(t2, http.StatusUnauthorized)
+	get(sign(2, "d3", now), http.StatusNoContent)
+
+	// 刷新令牌同样被吊销
+	c := NewUserClaims[int64](3, &userPayload{})
+	c.SetTimes(now.Add(-time.Minute), now.Add(time.Hour))
+	rc := c.BuildRefresh("base", nil).(*userClaims)
+	rc.SetTimes(now.Add(-time.Minute), now.Add(time.Hour))
+	refresh, err := j.Sign(rc)
+	a.NotError(err)
+	a.NotError(rb.RevokeAll(now))
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Header(mauth.AuthorizationHeader, "Bearer "+refresh).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+	get(sign(3, "", now.Add(time.Second)), http.StatusNoContent)
+}
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"slices"
+	"time"
+
+	"github.com/issue9/web"
+)
+
+func errKeyNotFound(id string) error { return web.NewLocaleError("not found jwt key %s", id) }
+
+// 是否可在 now 时用于签名
+func (k *key) signable(now time.Time) bool {
+	return k.weight > 0 && k.retired.IsZero() && !k.activate.After(now)
+}
+
+// 是否在 now 时已经过期
+func (k *key) expired(now time.Time) bool { return !k.expires.IsZero() && now.After(k.expires) }
+
+// 令牌的最长有效期
+func (s *Signer) lifetime() time.Duration { return max(s.expired, s.refreshExpired) }
+
+func (s *Signer) findKey(id string) *key {
+	if index := slices.IndexFunc(s.keys, func(e *key) bool { return e.id == id }); index >= 0 {
+		return s.keys[index]
+	}
+	return nil
+}
+
+// 处理计划中的激活以及删除由其签发的令牌都已经过期的退役密钥
+//
+// 调用者需要保证已经加锁。
+func (s *Signer) rotate(now time.Time) {
+	for _, k := range s.keys {
+		if !k.exclusive || k.activate.After(now) {
+			continue
+		}
+
+		k.exclusive = false
+		for _, e := range s.keys {
+			if e != k && e.retired.IsZero() && !e.activate.After(k.activate) {
+				e.retired = k.activate
+			}
+		}
+	}
+
+	lifetime := s.lifetime()
+	s.keys = slices.DeleteFunc(s.keys, func(k *key) bool {
+		return !k.retired.IsZero() && now.Sub(k.retired) > lifetime
+	})
+}
+
+// Activate 将密钥 id 指定为唯一的签名密钥
+//
+// at 为生效时间，在此之前仍由原有的密钥签名，零值表示立即生效。
+// 在 at 之后，当时正在参与签名的其它密钥都将退役，
+// 如果在此之前修改了其它密钥的状态，以 at 时的状态为准。
+//
+// 返回值为在 at 时将要退役的密钥 ID，可用于同步 [Verifier] 中对应密钥的过期时间，
+// 即 at 加上令牌的最长有效期。
+func (s *Signer) Activate(id string, at time.Time) ([]string, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+
+	k := s.findKey(id)
+	if k == nil || !k.retired.IsZero() {
+		return nil, errKeyNotFound(id)
+	}
+
+	k.activate = at
+	k.exclusive = true
+	k.weight = max(k.weight, 1)
+
+	ids := make([]string, 0, len(s.keys))
+	for _, e := range s.keys {
+		if e != k && e.retired.IsZero() && !e.activate.After(at) {
+			ids = append(ids, e.id.(string))
+		}
+	}
+	return ids, nil
+}
+
+// SetWeight 设置密钥 id 参与签名的权重
+//
+// 多个密钥同时参与签名时，按权重随机选取。weight 为 0 表示暂停参与签名，
+// 但是由其签发的令牌依然有效。已经退役的密钥无法再修改。
+func (s *Signer) SetWeight(id string, weight int) error {
+	if weight < 0 {
+		panic("参数 weight 不能小于 0")
+	}
+
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+
+	k := s.findKey(id)
+	if k == nil || !k.retired.IsZero() {
+		return errKeyNotFound(id)
+	}
+	k.weight = weight
+	return nil
+}
+
+// Retire 退役密钥 id
+//
+// 退役之后不再参与签名，但是在由其签发的令牌过期之前依然会通过 [Signer.JWKS] 公开，
+// 之后会被删除。
+//
+// 返回值为由该密钥签发的令牌的最晚过期时间，可用于 [Verifier.Retire]。
+func (s *Signer) Retire(id string) (time.Time, error) {
+	now := time.Now()
+
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+
+	k := s.findKey(id)
+	if k == nil {
+		return time.Time{}, errKeyNotFound(id)
+	}
+	if k.retired.IsZero() {
+		k.retired = now
+	}
+	return k.retired.Add(s.lifetime()), nil
+}
+
+// Remove 删除密钥 id
+//
+// 与 [Signer.Retire] 不同，会立即删除密钥。
+func (s *Signer) Remove(id string) {
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+	s.keys = slices.DeleteFunc(s.keys, func(e *key) bool { return e.id == id })
+}
+
+// 删除已经过期的密钥
+//
+// 调用者需要保证已经加锁。
+func (j *Verifier[T]) prune(now time.Time) {
+	j.keys = slices.DeleteFunc(j.keys, func(k *key) bool { return k.expired(now) })
+}
+
+// Retire 指定密钥 id 的过期时间
+//
+// 在 until 之后，由该密钥签名的令牌将无法通过验证，并且该密钥会被删除。
+// until 一般为 [Signer.Retire] 的返回值。
+func (j *Verifier[T]) Retire(id string, until time.Time) error {
+	j.keysMux.Lock()
+	defer j.keysMux.Unlock()
+
+	j.prune(time.Now())
+	index := slices.IndexFunc(j.keys, func(e *key) bool { return e.id == id })
+	if index < 0 {
+		return errKeyNotFound(id)
+	}
+	j.keys[index].expires = until
+	return nil
+}
+
+// Remove 删除密钥 id
+//
+// 由该密钥签名的令牌将立即无法通过验证。
+func (j *Verifier[T]) Remove(id string) {
+	j.keysMux.Lock()
+	defer j.keysMux.Unlock()
+	j.keys = slices.DeleteFunc(j.keys, func(e *key) bool { return e.id == id })
+}
+
+// Activate 将密钥 id 指定为唯一的签名密钥
+//
+// 参考 [Signer.Activate]，被退役的密钥会在由其签发的令牌过期之后从 [Verifier] 中删除。
+func (j *JWT[T]) Activate(id string, at time.Time) error {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	ids, err := j.s.Activate(id, at)
+	if err != nil {
+		return err
+	}
+
+	until := at.Add(j.s.lifetime())
+	for _, id := range ids {
+		_ = j.v.Retire(id, until) // 不存在于 Verifier 中的密钥无需处理
+	}
+	return nil
+}
+
+// SetWeight 设置密钥 id 参与签名的权重
+//
+// 参考 [Signer.SetWeight]。
+func (j *JWT[T]) SetWeight(id string, weight int) error { return j.s.SetWeight(id, weight) }
+
+// Retire 退役密钥 id
+//
+// 参考 [Signer.Retire]，该密钥会在由其签发的令牌过期之后从 [Verifier] 中删除。
+func (j *JWT[T]) Retire(id string) error {
+	until, err := j.s.Retire(id)
+	if err != nil {
+		return err
+	}
+	return j.v.Retire(id, until)
+}
+
+// Remove 删除密钥 id
+//
+// 同时从 [Signer] 和 [Verifier] 中删除，由该密钥签发的令牌将立即失效。
+func (j *JWT[T]) Remove(id string) {
+	j.s.Remove(id)
+	j.v.Remove(id)
+}
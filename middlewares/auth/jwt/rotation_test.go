@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+)
+
+func signedKID(a *assert.Assertion, s *Signer) string {
+	token, err := s.Sign(&testClaims{ID: 1})
+	a.NotError(err)
+
+	t, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	a.NotError(err)
+	return t.Header["kid"].(string)
+}
+
+func TestSigner_rotation(t *testing.T) {
+	a := assert.New(t, false)
+	s := NewSigner(time.Hour, 2*time.Hour, nil)
+	s.AddHMAC("a", jwt.SigningMethodHS256, []byte("a"))
+	s.AddHMAC("b", jwt.SigningMethodHS256, []byte("b"))
+
+	a.PanicString(func() {
+		s.SetWeight("a", -1)
+	}, "参数 weight 不能小于 0")
+	a.Error(s.SetWeight("not-exists", 1))
+
+	// 权重
+	a.NotError(s.SetWeight("b", 0))
+	for range 10 {
+		a.Equal(signedKID(a, s), "a")
+	}
+
+	// 计划激活
+	now := time.Now()
+	ids, err := s.Activate("b", now.Add(time.Hour))
+	a.NotError(err).Equal(ids, []string{"a"})
+	a.Equal(signedKID(a, s), "a")
+	a.Equal(s.selectKey(now.Add(time.Hour)).id, "b")
+	a.Equal(s.findKey("a").retired, now.Add(time.Hour))
+	a.Error(s.SetWeight("a", 1)) // 已退役
+
+	// 退役的密钥在令牌过期之后删除
+	a.Equal(s.selectKey(now.Add(3*time.Hour)).id, "b")
+	a.NotNil(s.findKey("a"))
+	a.Equal(s.selectKey(now.Add(3*time.Hour+time.Second)).id, "b")
+	a.Nil(s.findKey("a"))
+
+	// 退役之后没有可用的密钥
+	until, err := s.Retire("b")
+	a.NotError(err).True(until.After(now.Add(2 * time.Hour)))
+	_, err = s.Sign(&testClaims{})
+	a.Equal(err, ErrSigningMethodNotFound())
+	_, err = s.Activate("b", time.Time{})
+	a.Error(err)
+	_, err = s.Retire("not-exists")
+	a.Error(err)
+
+	s.Remove("b")
+	a.Empty(s.keys)
+}
+
+func TestJWT_rotation(t *testing.T) {
+	a := assert.New(t, false)
+	s, j := newJWT(a, time.Hour, 2*time.Hour)
+	j.AddHMAC("a", jwt.SigningMethodHS256, []byte("a"))
+	j.AddHMAC("b", jwt.SigningMethodHS256, []byte("b"))
+	j.AddHMAC("c", jwt.SigningMethodHS256, []byte("c"))
+	a.NotError(j.SetWeight("b", 0)).
+		NotError(j.SetWeight("c", 0))
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", j.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	get := func(token string, status int) {
+		servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, "Bearer "+token).
+			Do(nil).
+			Status(status)
+	}
+
+	tokenA, err := j.Sign(&testClaims{ID: 1})
+	a.NotError(err)
+
+	a.NotError(j.Activate("b", time.Time{}))
+	a.Equal(signedKID(a, j.s), "b")
+	get(tokenA, http.StatusNoContent) // 退役的密钥依然可以验证
+	k := j.v.findKey("a")
+	a.NotNil(k).False(k.expires.IsZero())
+
+	// 过期之后无法验证
+	a.NotError(j.v.Retire("a", time.Now().Add(-time.Second)))
+	get(tokenA, http.StatusUnauthorized)
+	a.Error(j.v.Retire("a", time.Now())) // 已经被删除
+
+	tokenB, err := j.Sign(&testClaims{ID: 1})
+	a.NotError(err)
+	a.NotError(j.Retire("b"))
+	_, err = j.Sign(&testClaims{ID: 1})
+	a.Equal(err, ErrSigningMethodNotFound())
+	get(tokenB, http.StatusNoContent)
+
+	j.Remove("b")
+	get(tokenB, http.StatusUnauthorized)
+	a.Error(j.Retire("b"))
+	a.Error(j.Activate("b", time.Time{}))
+}
+
+func TestSigner_concurrent(t *testing.T) {
+	a := assert.New(t, false)
+	_, j := newJWT(a, time.Hour, 2*time.Hour)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	wg := &sync.WaitGroup{}
+	for i := range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := j.Sign(&testClaims{ID: int64(i)})
+			a.NotError(err)
+		}()
+
+		go func() {
+			defer wg.Done()
+			id := "k" + strconv.Itoa(i)
+			j.AddHMAC(id, jwt.SigningMethodHS256, []byte(id))
+			a.NotError(j.Activate(id, time.Now().Add(time.Hour)))
+			j.Remove(id)
+		}()
+	}
+	wg.Wait()
+
+	a.Equal(signedKID(a, j.s), "hmac")
+}
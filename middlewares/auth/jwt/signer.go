@@ -5,10 +5,12 @@
 package jwt
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"math/rand"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -22,6 +24,11 @@ import (
 // expires 表示 access 的过期时间；
 type BuildResponseFunc = func(access, refresh string, expires int) any
 
+// SignFunc 对 claims 进行签名或是加密
+//
+// 用于非 JWT 格式的令牌，参考 [NewSignerWith]。
+type SignFunc = func(ctx context.Context, claims Claims) (string, error)
+
 type Response struct {
 	XMLName struct{} `json:"-" xml:"token"`
 	Access  string   `json:"access_token" xml:"access_token"`
@@ -35,13 +42,18 @@ type Response struct {
 // 同时需要保证 [Verifier] 添加的证书数量和 ID 与当前对象是相同的。
 type Signer struct {
 	keys    []*key
+	encs    []*encKey
+	keysMux sync.Mutex
 	expires int
 	expired time.Duration
 
 	refresh        bool
 	refreshExpired time.Duration
 
-	br BuildResponseFunc
+	br      BuildResponseFunc
+	interop bool
+	cookie  *Cookie
+	sign    SignFunc // 不为空时，由此函数代替内置的签名。
 }
 
 // NewSigner 声明签名对象
@@ -77,58 +89,151 @@ func NewSigner(expired, refresh time.Duration, br BuildResponseFunc) *Signer {
 	}
 }
 
+// NewSignerWith 声明以 sign 生成令牌的 [Signer] 对象
+//
+// [Signer.Render] 的流程与 [NewSigner] 相同，但是令牌由 sign 生成，
+// 用于实现其它格式的令牌，比如 PASETO。此时添加密钥等与签名相关的设置均无效。
+//
+// 其它参数可参考 [NewSigner]。
+func NewSignerWith(expired, refresh time.Duration, br BuildResponseFunc, sign SignFunc) *Signer {
+	if sign == nil {
+		panic("参数 sign 不能为空")
+	}
+
+	s := NewSigner(expired, refresh, br)
+	s.sign = sign
+	return s
+}
+
 // Render 向客户端输出令牌
 //
 // 当前方法会将 accessClaims 进行签名，并返回 [web.Responser] 对象。
+// 如果 accessClaims 实现了 [FamilyClaims]，会为令牌设置家族 ID，
+// 在 [Verifier.VerifyRefresh] 中调用时沿用刷新令牌的家族 ID，否则生成新的家族 ID。
+// 如果实现了 [TimeClaims]，会根据 expired 和 refresh 参数设置 iat 和 exp。
+// 如果实现了 [ConfirmationClaims] 且当前请求通过了 DPoP 验证，令牌会绑定到 DPoP 证明中的公钥。
 //
 // status 返回给客户端的状态码；
 func (s *Signer) Render(ctx *web.Context, status int, accessClaims Claims) web.Responser {
-	accessToken, err := s.Sign(accessClaims)
+	now := ctx.Begin()
+	if tc, ok := accessClaims.(TimeClaims); ok {
+		tc.SetTimes(now, now.Add(s.expired))
+	}
+	setFamily(ctx, accessClaims, nil)
+	setJKT(ctx, accessClaims)
+	accessToken, err := s.SignContext(ctx.Request().Context(), accessClaims)
 	if err != nil {
-		return ctx.Error(err, "")
+		return signFailed(ctx, err)
 	}
 
 	var refreshToken string
 	if s.refresh {
-		refreshToken, err = s.Sign(accessClaims.BuildRefresh(accessToken, ctx))
+		refreshClaims := accessClaims.BuildRefresh(accessToken, ctx)
+		if tc, ok := refreshClaims.(TimeClaims); ok {
+			tc.SetTimes(now, now.Add(s.refreshExpired))
+		}
+		setFamily(ctx, accessClaims, refreshClaims)
+		setJKT(ctx, refreshClaims)
+		refreshToken, err = s.SignContext(ctx.Request().Context(), refreshClaims)
 		if err != nil {
-			return ctx.Error(err, "")
+			return signFailed(ctx, err)
 		}
 	}
 
+	if s.cookie != nil {
+		s.cookie.set(ctx, accessToken, refreshToken, s.expired, s.refreshExpired)
+		return web.Status(status)
+	}
 	return web.Response(status, s.br(accessToken, refreshToken, s.expires))
 }
 
 // Sign 对 claims 进行签名
 //
-// 算法随机从 [Signer.AddKey] 添加的库里选取。
+// 算法从当前参与签名的密钥中按权重随机选取，默认情况下所有密钥的权重相同。
+// 可以通过 [Signer.Activate]、[Signer.SetWeight] 和 [Signer.Retire] 调整。
+//
+// 如果通过 [Signer.AddEncryption] 添加了加密密钥，返回的是加密之后的令牌。
 func (s *Signer) Sign(claims Claims) (string, error) {
-	var k *key
-	switch l := len(s.keys); l {
-	case 0:
+	return s.SignContext(context.Background(), claims)
+}
+
+// SignContext 对 claims 进行签名
+//
+// 与 [Signer.Sign] 相同，ctx 会传递给实现了 [ContextSigner] 的外部签名服务。
+func (s *Signer) SignContext(ctx context.Context, claims Claims) (string, error) {
+	if s.sign != nil {
+		return s.sign(ctx, claims)
+	}
+
+	k := s.selectKey(time.Now())
+	if k == nil {
 		return "", ErrSigningMethodNotFound()
-	case 1:
-		k = s.keys[0]
-	default:
-		k = s.keys[rand.Intn(l)]
 	}
 
 	t := jwt.NewWithClaims(k.sign, claims)
 	t.Header["kid"] = k.id
-	t.Header["alg"] = jwt.SigningMethodNone.Alg() // 不应该让用户知道算法，防止攻击。
-	return t.SignedString(k.key)
+	if !s.interop {
+		t.Header["alg"] = algNone // 不应该让用户知道算法，防止攻击。
+	}
+
+	token, err := signToken(ctx, t, k)
+	if err != nil {
+		return "", err
+	}
+	return s.encrypt(token)
+}
+
+func (s *Signer) selectKey(now time.Time) *key {
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+
+	s.rotate(now)
+
+	var total int
+	for _, k := range s.keys {
+		if k.signable(now) {
+			total += k.weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	n := rand.Intn(total)
+	for _, k := range s.keys {
+		if !k.signable(now) {
+			continue
+		}
+
+		if n < k.weight {
+			return k
+		}
+		n -= k.weight
+	}
+	return nil
 }
 
 func (s *Signer) addKey(id string, sign SigningMethod, private any) {
-	if slices.IndexFunc(s.keys, func(e *key) bool { return e.id == id }) >= 0 {
+	if err := s.insertKey(id, sign, private); err != nil {
 		panic(fmt.Sprintf("存在同名的签名方法 %s", id))
 	}
+}
+
+func (s *Signer) insertKey(id string, sign SigningMethod, private any) error {
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+
+	if slices.IndexFunc(s.keys, func(e *key) bool { return e.id == id }) >= 0 {
+		return errDuplicateKey(id)
+	}
 
 	s.keys = append(s.keys, &key{
-		id:   id,
-		sign: sign,
-		key:  private,
+		id:     id,
+		sign:   sign,
+		key:    private,
+		weight: 1,
 	})
+	return nil
 }
 
 func (s *Signer) AddHMAC(id string, sign *jwt.SigningMethodHMAC, secret []byte) {
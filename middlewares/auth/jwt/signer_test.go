@@ -5,9 +5,12 @@
 package jwt
 
 import (
+	"context"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/issue9/assert/v4"
 )
 
@@ -26,3 +29,18 @@ func TestNewSigner(t *testing.T) {
 		NewSigner(time.Hour, 0, nil)
 	})
 }
+
+func TestNewSignerWith(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.PanicString(func() {
+		NewSignerWith(time.Hour, 0, nil, nil)
+	}, "参数 sign 不能为空")
+
+	s := NewSignerWith(time.Hour, 0, nil, func(_ context.Context, c Claims) (string, error) {
+		return strconv.FormatInt(c.(*testClaims).ID, 10), nil
+	})
+	s.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret")) // 不影响签名
+	token, err := s.Sign(&testClaims{ID: 5})
+	a.NotError(err).Equal(token, "5")
+}
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// 缓存项在 exp 之前多久失效
+const tokenCacheMargin = time.Second
+
+type (
+	// 已验证令牌的缓存
+	//
+	// 以令牌的 SHA-256 作为键名，超过容量时淘汰最久未使用的项。
+	tokenCache[T Claims] struct {
+		mux   sync.Mutex
+		size  int
+		ttl   time.Duration
+		items map[[sha256.Size]byte]*list.Element
+		lru   *list.List
+	}
+
+	tokenCacheItem[T Claims] struct {
+		key     [sha256.Size]byte
+		claims  T
+		sign    *key // 验证签名时使用的密钥
+		expires time.Time
+	}
+
+	// 拉黑令牌时可以通知其它对象的 [Blocker]
+	blockNotifier interface {
+		onBlock(func(token string))
+	}
+)
+
+func newTokenCache[T Claims](size int, ttl time.Duration) *tokenCache[T] {
+	return &tokenCache[T]{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[[sha256.Size]byte]*list.Element, size),
+		lru:   list.New(),
+	}
+}
+
+func (c *tokenCache[T]) get(token string, now time.Time) (claims T, sign *key, found bool) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	elem, found := c.items[key]
+	if !found {
+		return claims, nil, false
+	}
+
+	item := elem.Value.(*tokenCacheItem[T])
+	if !now.Before(item.expires) {
+		c.lru.Remove(elem)
+		delete(c.items, key)
+		return claims, nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return item.claims, item.sign, true
+}
+
+// 缓存 claims，有效期为 ttl，但不会超过 exp 之前的 [tokenCacheMargin]。
+//
+// sign 为验证签名时使用的密钥。
+func (c *tokenCache[T]) set(token string, claims T, sign *key, now time.Time) {
+	expires := now.Add(c.ttl)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		if e := exp.Add(-tokenCacheMargin); e.Before(expires) {
+			expires = e
+		}
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	key := sha256.Sum256([]byte(token))
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if elem, found := c.items[key]; found {
+		item := elem.Value.(*tokenCacheItem[T])
+		item.claims, item.sign, item.expires = claims, sign, expires
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	for c.lru.Len() >= c.size {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.items, last.Value.(*tokenCacheItem[T]).key)
+	}
+
+	c.items[key] = c.lru.PushFront(&tokenCacheItem[T]{key: key, claims: claims, sign: sign, expires: expires})
+}
+
+func (c *tokenCache[T]) delete(token string) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if elem, found := c.items[key]; found {
+		c.lru.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+func (c *tokenCache[T]) len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.lru.Len()
+}
+
+// SetCache 缓存验证通过的令牌
+//
+// 对于 RSA 等验证开销较大的算法，同一令牌多次请求时可以省去验证签名的开销。
+// size 为最多缓存的令牌数量，超出时淘汰最久未使用的项，小于等于 0 表示不缓存；
+// ttl 为缓存的最长时间，同时也不会超过令牌的 exp。
+//
+// 命中缓存时依然会通过 [Blocker] 判断令牌是否已经被拉黑，也会判断签名所用的密钥是否依然有效，
+// 密钥被删除、停用或是因为 JWKS 的更新而被替换时，会重新验证令牌。
+// 同时由 [Verifier] 拉黑的令牌会从缓存中删除，由 [NewCacheBlocker] 创建的对象拉黑令牌时也会删除。
+//
+// NOTE: 命中缓存时，同一令牌的多个请求会得到同一个 T 对象，不应该修改其内容。
+func (j *Verifier[T]) SetCache(size int, ttl time.Duration) {
+	if size <= 0 {
+		j.cache = nil
+		return
+	}
+
+	if ttl <= 0 {
+		panic("参数 ttl 必须大于 0")
+	}
+
+	c := newTokenCache[T](size, ttl)
+	if n, ok := j.blocker.(blockNotifier); ok {
+		n.onBlock(c.delete)
+	}
+	j.cache = c
+}
+
+// SetCache 缓存验证通过的令牌
+//
+// 参考 [Verifier.SetCache]。
+func (j *JWT[T]) SetCache(size int, ttl time.Duration) { j.v.SetCache(size, ttl) }
+
+// 拉黑令牌并从缓存中删除
+func (j *Verifier[T]) block(token string, refresh bool) error {
+	if j.cache != nil {
+		j.cache.delete(token)
+	}
+	return j.blocker.BlockToken(token, refresh)
+}
@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/jwe"
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+)
+
+var _ blockNotifier = &cacheBlocker[*testClaims]{}
+
+func TestTokenCache(t *testing.T) {
+	a := assert.New(t, false)
+	now := time.Now().Truncate(time.Second) // exp 的精度为秒
+
+	claims := func(exp time.Duration) *userClaims {
+		c := NewUserClaims[int64](1, &userPayload{})
+		if exp != 0 {
+			c.SetTimes(now, now.Add(exp))
+		}
+		return c
+	}
+
+	c := newTokenCache[*userClaims](2, time.Minute)
+	c1, c2, c3 := claims(time.Hour), claims(time.Hour), claims(0)
+	c.set("t1", c1, nil, now)
+	c.set("t2", c2, nil, now)
+	a.Equal(c.len(), 2)
+
+	v, _, found := c.get("t1", now)
+	a.True(found).True(v == c1)
+
+	// 淘汰最久未使用的 t2
+	c.set("t3", c3, nil, now)
+	a.Equal(c.len(), 2)
+	_, _, found = c.get("t2", now)
+	a.False(found)
+	_, _, found = c.get("t1", now)
+	a.True(found)
+
+	// 没有 exp 的令牌由 ttl 决定
+	_, _, found = c.get("t3", now.Add(time.Minute-time.Millisecond))
+	a.True(found)
+	_, _, found = c.get("t3", now.Add(time.Minute))
+	a.False(found)
+	a.Equal(c.len(), 1)
+
+	// 在 exp 之前失效
+	c = newTokenCache[*userClaims](10, time.Hour)
+	c.set("t1", claims(time.Minute), nil, now)
+	_, _, found = c.get("t1", now.Add(time.Minute-tokenCacheMargin-time.Millisecond))
+	a.True(found)
+	_, _, found = c.get("t1", now.Add(time.Minute-tokenCacheMargin))
+	a.False(found)
+
+	// 即将过期的令牌不缓存
+	c.set("t2", claims(tokenCacheMargin), nil, now)
+	a.Equal(c.len(), 0)
+
+	// 更新
+	c.set("t1", c1, nil, now)
+	c.set("t1", c2, nil, now)
+	v, _, found = c.get("t1", now)
+	a.True(found).True(v == c2).Equal(c.len(), 1)
+
+	c.delete("t1")
+	c.delete("not-exists")
+	a.Equal(c.len(), 0)
+}
+
+func TestVerifier_SetCache(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := NewCacheBlocker[*userClaims](s, "test_", time.Hour, 2*time.Hour)
+	j := New(b, func() *userClaims { return &userClaims{} }, time.Hour, 2*time.Hour, nil)
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	a.PanicString(func() {
+		j.SetCache(10, 0)
+	}, "参数 ttl 必须大于 0")
+
+	var validated atomic.Int64
+	j.v.SetPolicy(s, &Policy[*userClaims]{Validators: []func(*userClaims) error{
+		func(*userClaims) error { validated.Add(1); return nil },
+	}})
+	j.SetCache(10, time.Minute)
+
+	sign := func() string {
+		c := NewUserClaims[int64](1, &userPayload{})
+		c.SetTimes(time.Now(), time.Now().Add(time.Hour))
+		token, err := j.Sign(c)
+		a.NotError(err)
+		return token
+	}
+
+	token := sign()
+	c1, err := j.v.parse(token)
+	a.NotError(err).Equal(j.v.cache.len(), 1)
+	c2, err := j.v.parse(token)
+	a.NotError(err).True(c1 == c2)
+	a.Equal(validated.Load(), 2) // 命中缓存时依然会执行验证策略
+
+	// 签名错误的令牌不缓存
+	_, err = j.v.parse(token + "x")
+	a.Error(err).Equal(j.v.cache.len(), 1)
+
+	// 拉黑之后从缓存中删除
+	a.NotError(b.BlockToken(token, false))
+	a.Equal(j.v.cache.len(), 0)
+
+	// 密钥被删除之后，缓存的令牌也需要重新验证
+	token = sign()
+	_, err = j.v.parse(token)
+	a.NotError(err).Equal(j.v.cache.len(), 1)
+	j.v.Remove("hmac")
+	_, err = j.v.parse(token)
+	a.Error(err)
+	j.v.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+	c1, err = j.v.parse(token)
+	a.NotError(err)
+	c2, err = j.v.parse(token)
+	a.NotError(err).True(c1 == c2)
+
+	// 密钥停用
+	a.NotError(j.v.Retire("hmac", time.Now().Add(-time.Second)))
+	_, err = j.v.parse(token)
+	a.Error(err)
+	j.v.Remove("hmac")
+	j.v.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	// JWE 以解密之前的令牌作为键名
+	dirKey := bytes.Repeat([]byte("k"), 32)
+	j.AddEncryption("enc", EncryptionDir, dirKey, dirKey)
+	token = sign()
+	a.True(jwe.IsJWE(token))
+	c1, err = j.v.parse(token)
+	a.NotError(err)
+	c2, err = j.v.parse(token)
+	a.NotError(err).True(c1 == c2)
+	a.NotError(b.BlockToken(token, false))
+	_, _, found := j.v.cache.get(token, time.Now())
+	a.False(found)
+	j.RemoveEncryption("enc")
+
+	j.SetCache(0, 0)
+	a.Nil(j.v.cache)
+	_, err = j.v.parse(sign())
+	a.NotError(err)
+
+	// 通过中间件
+	j.SetCache(10, time.Minute)
+	r := s.Routers().New("def", nil)
+	r.Get("/info", j.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+	r.Delete("/login", j.Middleware(func(ctx *web.Context) web.Responser {
+		a.NotError(j.Logout(ctx))
+		return web.NoContent()
+	}))
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, NewUserClaims[int64](1, &userPayload{}))
+	})
+	r.Post("/refresh", j.VerifiyRefresh(func(ctx *web.Context) web.Responser {
+		c, _ := j.GetInfo(ctx)
+		return j.Render(ctx, http.StatusCreated, c)
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	token = sign()
+	for range 3 {
+		servertest.Get(a, "http://localhost:8080/info").
+			Header(mauth.AuthorizationHeader, "Bearer "+token).
+			Do(nil).
+			Status(http.StatusNoContent)
+	}
+	a.Equal(j.v.cache.len(), 1)
+
+	servertest.Delete(a, "http://localhost:8080/login").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusNoContent)
+	a.Equal(j.v.cache.len(), 0)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	// 刷新时基本令牌的 claims 会被 Render 修改，不能进入缓存。
+	resp := &Response{}
+	servertest.Post(a, "http://localhost:8080/login", nil).
+		Header("Accept", "application/json").
+		Do(nil).
+		Status(http.StatusCreated).
+		BodyFunc(func(a *assert.Assertion, body []byte) { a.NotError(json.Unmarshal(body, resp)) })
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+resp.Access).
+		Do(nil).
+		Status(http.StatusNoContent)
+	a.Equal(j.v.cache.len(), 1)
+
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Header(mauth.AuthorizationHeader, "Bearer "+resp.Refresh).
+		Header("Accept", "application/json").
+		Do(nil).
+		Status(http.StatusCreated)
+	a.Equal(j.v.cache.len(), 0)
+}
+
+func BenchmarkVerifier_parse(b *testing.B) {
+	a := assert.New(b, false)
+	fsys := os.DirFS("./testdata")
+
+	keys := map[string]func(*JWT[*userClaims]){
+		"RS256": func(j *JWT[*userClaims]) {
+			j.AddRSAFromFS("rsa", jwt.SigningMethodRS256, fsys, "rsa-public.pem", "rsa-private.pem")
+		},
+		"ES256": func(j *JWT[*userClaims]) {
+			j.AddECDSAFromFS("ec", jwt.SigningMethodES256, fsys, "ec256-public.pem", "ec256-private.pem")
+		},
+	}
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		for _, size := range []int{0, 1000} {
+			b.Run(alg+"/cache="+strconv.Itoa(size), func(b *testing.B) {
+				s := testserver.New(a)
+				blocker := NewCacheBlocker[*userClaims](s, "bench_", time.Hour, 2*time.Hour)
+				j := New(blocker, func() *userClaims { return &userClaims{} }, time.Hour, 2*time.Hour, nil)
+				keys[alg](j)
+				j.SetCache(size, time.Minute)
+
+				c := NewUserClaims[int64](1, &userPayload{})
+				c.SetTimes(time.Now(), time.Now().Add(time.Hour))
+				token, err := j.Sign(c)
+				a.NotError(err)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for range b.N {
+					if _, err := j.v.parse(token); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"io/fs"
 	"slices"
+	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/issue9/web"
 
+	"github.com/issue9/webuse/v7/internal/jwe"
 	"github.com/issue9/webuse/v7/internal/mauth"
 	"github.com/issue9/webuse/v7/middlewares/auth"
 )
@@ -29,12 +32,31 @@ type (
 	// 同时需要保证 [Signer] 添加的证书数量和 ID 与当前对象是相同的。
 	Verifier[T Claims] struct {
 		blocker       Blocker[T]
-		keyFunc       jwt.Keyfunc
 		claimsBuilder BuildClaimsFunc[T]
 		keys          []*key
+		decs          []*encKey
+		keysMux       sync.RWMutex
+		sources       []*jwksSource
+		sink          auth.Sink
+		extractors    []Extractor
+		policy        *Policy[T]
+		parser        *jwt.Parser
+		cookie        *Cookie
+		dpop          *DPoP
+		cache         *tokenCache[T]
+		source        string       // 事件的来源
+		decode        ParseFunc[T] // 不为空时，由此函数代替内置的解码。
 	}
 
 	BuildClaimsFunc[T Claims] func() T
+
+	// ParseFunc 解码并验证令牌
+	//
+	// 用于非 JWT 格式的令牌，参考 [NewVerifierWith]。
+	ParseFunc[T Claims] func(token string) (T, error)
+
+	// 未指定 [Blocker] 时的默认实现，不会拉黑任何令牌。
+	nopBlocker[T Claims] struct{}
 )
 
 // NewVerifier 声明 [Verifier] 对象
@@ -42,34 +64,48 @@ type (
 // b 为处理丢弃令牌的对象，如果为空表示不会对任何令牌作特殊处理；
 // f 为 [Claims] 对象的生成方法；
 func NewVerifier[T Claims](b Blocker[T], f BuildClaimsFunc[T]) *Verifier[T] {
-	j := &Verifier[T]{
+	if b == nil {
+		b = nopBlocker[T]{}
+	}
+
+	return &Verifier[T]{
 		blocker:       b,
 		claimsBuilder: f,
 		keys:          make([]*key, 0, 10),
+		extractors:    []Extractor{defaultExtractor()},
+		parser:        jwt.NewParser(),
+		source:        "jwt",
 	}
+}
 
-	j.keyFunc = func(t *jwt.Token) (any, error) {
-		if len(j.keys) == 0 || len(t.Header) == 0 {
-			return nil, ErrSigningMethodNotFound()
-		}
-
-		if kid, found := t.Header["kid"]; found {
-			if index := slices.IndexFunc(j.keys, func(e *key) bool { return e.id == kid }); index >= 0 {
-				k := j.keys[index]
-				t.Method = k.sign // 忽略由用户指定的 header['alg']，而是有 kid 指定。
-				return k.key, nil
-			}
-		}
-
-		return nil, ErrSigningMethodNotFound()
+// NewVerifierWith 声明以 parse 解码令牌的 [Verifier] 对象
+//
+// 令牌的提取、拉黑、刷新以及事件等流程与 [NewVerifier] 相同，但是令牌的解码由 parse 完成，
+// 用于实现其它格式的令牌，比如 PASETO。此时添加密钥和 [Verifier.SetCache] 等与解码相关的设置均无效。
+//
+// source 为事件的来源，即 [auth.Event.Source]；
+// b 为处理丢弃令牌的对象，如果为空表示不会对任何令牌作特殊处理；
+func NewVerifierWith[T Claims](source string, b Blocker[T], parse ParseFunc[T]) *Verifier[T] {
+	if parse == nil {
+		panic("参数 parse 不能为空")
 	}
 
-	return j
+	v := NewVerifier(b, nil)
+	v.source = source
+	v.decode = parse
+	return v
 }
 
+// Logout 退出登录
+//
+// 会拉黑当前请求所使用的令牌，无论该令牌是从何处提取的。
 func (j *Verifier[T]) Logout(ctx *web.Context) error {
 	if c, found := j.GetInfo(ctx); found {
-		return j.blocker.BlockToken(auth.GetToken(ctx, prefix, mauth.AuthorizationHeader), c.BaseToken() != "")
+		auth.Emit(ctx, j.sink, &auth.Event{Type: auth.EventLogout, Source: j.source, Info: c})
+		if j.cookie != nil {
+			j.cookie.delete(ctx)
+		}
+		return j.block(j.extract(ctx, false), c.BaseToken() != "")
 	}
 	return nil
 }
@@ -89,8 +125,17 @@ func (j *Verifier[T]) Middleware(next web.HandlerFunc) web.HandlerFunc {
 }
 
 func (j *Verifier[T]) resp(ctx *web.Context, refresh bool, next web.HandlerFunc) web.Responser {
-	token := auth.GetToken(ctx, prefix, mauth.AuthorizationHeader)
-	if token == "" || j.blocker.TokenIsBlocked(token) {
+	token := j.extract(ctx, refresh)
+	if token == "" {
+		return j.fail(ctx, auth.ReasonMissingCredential, nil)
+	}
+	if j.cookie != nil && !j.cookie.checkCSRF(ctx, token, refresh) {
+		return j.failCSRF(ctx)
+	}
+	if j.blocker.TokenIsBlocked(token) {
+		if !refresh || !j.revokeFamily(ctx, token) {
+			auth.Emit(ctx, j.sink, &auth.Event{Type: auth.EventBlocked, Source: j.source})
+		}
 		return ctx.Problem(web.ProblemUnauthorized)
 	}
 
@@ -99,61 +144,212 @@ func (j *Verifier[T]) resp(ctx *web.Context, refresh bool, next web.HandlerFunc)
 		return resp
 	}
 
-	if j.blocker.ClaimsIsBlocked(claims) {
+	if j.blocker.ClaimsIsBlocked(claims) || j.familyIsBlocked(claims) {
+		auth.Emit(ctx, j.sink, &auth.Event{Type: auth.EventBlocked, Source: j.source, Info: claims})
 		return ctx.Problem(web.ProblemUnauthorized)
 	}
 
+	if resp := j.checkDPoP(ctx, token, claims, refresh); resp != nil {
+		return resp
+	}
+
+	typ := auth.EventSuccess
 	if refresh { // 刷新令牌是一次性的
 		baseToken := claims.BaseToken()
 		if baseToken == "" { // 不是刷新令牌
-			return ctx.Problem(web.ProblemUnauthorized)
+			return j.fail(ctx, auth.ReasonNotRefreshToken, nil)
 		}
 
-		if err := j.blocker.BlockToken(token, true); err != nil {
+		if resp := j.useRefresh(ctx, token, claims); resp != nil {
+			return resp
+		}
+
+		if err := j.block(token, true); err != nil {
 			ctx.Logs().ERROR().Error(err)
 		}
 
-		if err := j.blocker.BlockToken(baseToken, false); err != nil {
+		if err := j.block(baseToken, false); err != nil {
 			ctx.Logs().ERROR().Error(err)
 		}
 
-		claims, resp = j.parseClaims(ctx, baseToken) // 拿到基本的用户信息，由之的一的 SetVar 写入上下文
-		if resp != nil {
-			return resp
+		if family := familyOf(claims); family != "" { // 由 Signer.Render 沿用
+			ctx.SetVar(familySlot{}, family)
+		}
+
+		// 拿到基本的用户信息，由之后的 mauth.Set 写入上下文。
+		// 返回的对象可能会被 Signer.Render 修改，所以不能经过缓存。
+		var err error
+		if claims, err = j.parseWith(baseToken, nil); err != nil {
+			return j.fail(ctx, failReason(err), err)
 		}
+		typ = auth.EventRefresh
 	}
 
-	mauth.Set(ctx, claims)
+	mauth.Set(ctx, j, claims)
+	auth.Emit(ctx, j.sink, &auth.Event{Type: typ, Source: j.source, Info: claims})
 	return next(ctx)
 }
 
 func (j *Verifier[T]) parseClaims(ctx *web.Context, token string) (T, web.Responser) {
 	var zero T
 
-	t, err := jwt.ParseWithClaims(token, j.claimsBuilder(), j.keyFunc)
+	claims, err := j.parse(token)
 	if err != nil { // 都算验证错误
-		return zero, ctx.Problem(web.ProblemUnauthorized)
+		return zero, j.fail(ctx, failReason(err), err)
+	}
+	return claims, nil
+}
+
+// 解码令牌，如果是 JWE 格式，会先解密。
+func (j *Verifier[T]) parse(token string) (T, error) { return j.parseWith(token, j.cache) }
+
+// 以 cache 作为缓存解码令牌，cache 为空表示不使用缓存。
+func (j *Verifier[T]) parseWith(token string, cache *tokenCache[T]) (T, error) {
+	var zero T
+
+	if j.decode != nil {
+		return j.decode(token)
+	}
+
+	now := time.Now()
+	raw := token // 缓存以原始的令牌为键名，JWE 格式的令牌会在解密之后改变 token 的值。
+	if cache != nil {
+		// 签名所用的密钥已经不可用时，需要重新验证。
+		if claims, k, found := cache.get(raw, now); found && j.findKey(k.id) == k {
+			if j.policy != nil { // MaxAge 等与时间相关的验证
+				if err := j.policy.validate(claims); err != nil {
+					return zero, err
+				}
+			}
+			return claims, nil
+		}
+	}
+
+	if jwe.IsJWE(token) {
+		var err error
+		if token, err = j.decrypt(token); err != nil {
+			return zero, err
+		}
+	}
+
+	var k *key
+	t, err := j.parser.ParseWithClaims(token, j.claimsBuilder(), func(t *jwt.Token) (any, error) {
+		var err error
+		if k, err = j.tokenKey(t); err != nil {
+			return nil, err
+		}
+		return k.key, nil
+	})
+	if err != nil {
+		return zero, err
 	}
 
 	if !t.Valid {
-		return zero, ctx.Problem(web.ProblemUnauthorized)
+		return zero, jwt.ErrTokenSignatureInvalid
+	}
+
+	claims := t.Claims.(T)
+	if j.policy != nil {
+		if err := j.policy.validate(claims); err != nil {
+			return zero, err
+		}
 	}
 
-	return t.Claims.(T), nil
+	if cache != nil {
+		cache.set(raw, claims, k, now)
+	}
+	return claims, nil
 }
 
-func (j *Verifier[T]) GetInfo(ctx *web.Context) (claims T, found bool) { return mauth.Get[T](ctx) }
+// 查找令牌对应的密钥，同时根据 alg 设置 t.Method。
+func (j *Verifier[T]) tokenKey(t *jwt.Token) (*key, error) {
+	if len(t.Header) == 0 {
+		return nil, ErrSigningMethodNotFound()
+	}
+
+	kid, found := t.Header["kid"]
+	if !found {
+		return nil, ErrSigningMethodNotFound()
+	}
+
+	k := j.findKey(kid)
+	if k == nil && j.refetchJWKS() { // 可能是远程的密钥已经更新
+		k = j.findKey(kid)
+	}
+	if k == nil {
+		return nil, ErrSigningMethodNotFound()
+	}
+
+	alg, _ := t.Header["alg"].(string)
+	sign := k.method(alg)
+	if sign == nil {
+		return nil, ErrSigningMethodNotFound()
+	}
+
+	t.Method = sign
+	return k, nil
+}
+
+func (j *Verifier[T]) fail(ctx *web.Context, reason string, err error) web.Responser {
+	auth.Emit(ctx, j.sink, &auth.Event{Type: auth.EventFailure, Source: j.source, Reason: reason, Err: err})
+
+	if j.policy != nil {
+		if err != nil {
+			ctx.Logs().DEBUG().Error(err)
+		}
+		if p, found := policyProblems[reason]; found {
+			return ctx.Problem(p)
+		}
+	}
+	return ctx.Problem(web.ProblemUnauthorized)
+}
+
+// SetSink 指定接收验证相关事件的对象
+//
+// sink 可以为空，表示不发送事件。
+func (j *Verifier[T]) SetSink(sink auth.Sink) { j.sink = sink }
+
+func (j *Verifier[T]) GetInfo(ctx *web.Context) (claims T, found bool) { return mauth.Get[T](ctx, j) }
+
+func (nopBlocker[T]) BlockToken(string, bool) error { return nil }
+
+func (nopBlocker[T]) TokenIsBlocked(string) bool { return false }
+
+func (nopBlocker[T]) ClaimsIsBlocked(T) bool { return false }
+
+func (j *Verifier[T]) findKey(id any) *key {
+	j.keysMux.RLock()
+	defer j.keysMux.RUnlock()
+
+	if index := slices.IndexFunc(j.keys, func(e *key) bool { return e.id == id }); index >= 0 {
+		if k := j.keys[index]; !k.expired(time.Now()) {
+			return k
+		}
+	}
+	return nil
+}
 
 func (j *Verifier[T]) addKey(id string, sign SigningMethod, keyData any) {
-	if slices.IndexFunc(j.keys, func(e *key) bool { return e.id == id }) >= 0 {
+	if err := j.insertKey(id, sign, keyData); err != nil {
 		panic(fmt.Sprintf("存在同名的签名方法 %s", id))
 	}
+}
+
+func (j *Verifier[T]) insertKey(id string, sign SigningMethod, keyData any) error {
+	j.keysMux.Lock()
+	defer j.keysMux.Unlock()
+
+	j.prune(time.Now())
+	if slices.IndexFunc(j.keys, func(e *key) bool { return e.id == id }) >= 0 {
+		return errDuplicateKey(id)
+	}
 
 	j.keys = append(j.keys, &key{
 		id:   id,
 		sign: sign,
 		key:  keyData,
 	})
+	return nil
 }
 
 func (j *Verifier[T]) AddHMAC(id string, sign *jwt.SigningMethodHMAC, secret []byte) {
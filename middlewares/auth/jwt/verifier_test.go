@@ -5,8 +5,18 @@
 package jwt
 
 import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
 	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
 
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
 	"github.com/issue9/webuse/v7/middlewares/auth"
 )
 
@@ -14,3 +24,126 @@ var (
 	_ web.MiddlewareFunc     = (&Verifier[*testClaims]{}).VerifyRefresh
 	_ auth.Auth[*testClaims] = &Verifier[*testClaims]{}
 )
+
+func TestVerifier_events(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	events := make([]*auth.Event, 0, 10)
+	m := NewCacheBlocker[*testClaims](s, "test_", time.Hour, 2*time.Hour)
+	j := New(m, func() *testClaims { return &testClaims{} }, time.Hour, 2*time.Hour, nil)
+	j.SetSink(auth.SinkFunc(func(e *auth.Event) { events = append(events, e) }))
+	j.AddHMAC("hmac", jwt.SigningMethodHS256, []byte("secret"))
+
+	r := s.Routers().New("def", nil)
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, &testClaims{ID: 1, Created: ctx.Begin()})
+	})
+	r.Post("/refresh", j.VerifiyRefresh(func(ctx *web.Context) web.Responser {
+		return j.Render(ctx, http.StatusCreated, &testClaims{ID: 1, Created: ctx.Begin()})
+	}))
+	r.Get("/info", j.Middleware(func(*web.Context) web.Responser { return web.OK(nil) }))
+	r.Delete("/login", j.Middleware(func(ctx *web.Context) web.Responser {
+		if err := j.Logout(ctx); err != nil {
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	resp := &Response{}
+	servertest.Post(a, "http://localhost:8080/login", nil).
+		Do(nil).
+		Status(http.StatusCreated).
+		BodyFunc(func(a *assert.Assertion, body []byte) { a.NotError(json.Unmarshal(body, resp)) })
+
+	servertest.Get(a, "http://localhost:8080/info").Do(nil).Status(http.StatusUnauthorized)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, prefix+"invalid").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, prefix+resp.Access).
+		Do(nil).
+		Status(http.StatusOK)
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Header(mauth.AuthorizationHeader, prefix+resp.Access).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Header(mauth.AuthorizationHeader, prefix+resp.Refresh).
+		Do(nil).
+		Status(http.StatusCreated)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, prefix+resp.Access).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	a.Length(events, 6)
+	a.Equal(events[0].Type, auth.EventFailure).Equal(events[0].Reason, auth.ReasonMissingCredential).
+		Equal(events[1].Type, auth.EventFailure).Equal(events[1].Reason, auth.ReasonInvalidCredential).NotNil(events[1].Err).
+		Equal(events[2].Type, auth.EventSuccess).Equal(events[2].Source, "jwt").Equal(events[2].Info.(*testClaims).ID, int64(1)).
+		Equal(events[3].Type, auth.EventFailure).Equal(events[3].Reason, auth.ReasonNotRefreshToken).
+		Equal(events[4].Type, auth.EventRefresh).
+		Equal(events[5].Type, auth.EventBlocked)
+}
+
+func TestNewVerifierWith(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+
+	a.PanicString(func() {
+		NewVerifierWith[*testClaims]("custom", nil, nil)
+	}, "参数 parse 不能为空")
+
+	events := make([]*auth.Event, 0, 10)
+	v := NewVerifierWith("custom", nil, func(token string) (*testClaims, error) {
+		if token != "5" {
+			return nil, jwt.ErrTokenMalformed
+		}
+		return &testClaims{ID: 5}, nil
+	})
+	v.SetSink(auth.SinkFunc(func(e *auth.Event) { events = append(events, e) }))
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", v.Middleware(func(ctx *web.Context) web.Responser {
+		c, _ := v.GetInfo(ctx)
+		return web.OK(c.ID)
+	}))
+	r.Delete("/login", v.Middleware(func(ctx *web.Context) web.Responser {
+		if err := v.Logout(ctx); err != nil { // 空的 blocker 不会拉黑令牌
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer 5").
+		Do(nil).
+		Status(http.StatusOK).
+		StringBody("5")
+	servertest.Delete(a, "http://localhost:8080/login").
+		Header(mauth.AuthorizationHeader, "Bearer 5").
+		Do(nil).
+		Status(http.StatusNoContent)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer 5").
+		Do(nil).
+		Status(http.StatusOK)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer 6").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	a.Length(events, 5).
+		Equal(events[0].Source, "custom").
+		Equal(events[2].Type, auth.EventLogout).
+		Equal(events[4].Type, auth.EventFailure).
+		Equal(events[4].Reason, auth.ReasonInvalidCredential)
+}
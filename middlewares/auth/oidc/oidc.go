@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package oidc [OpenID Connect] 依赖方（Relying Party）的实现
+//
+// 采用授权码 + [PKCE] 的流程，登录成功之后将用户信息写入 [session.Session]：
+//
+//	sess := session.New(...)
+//	o, err := oidc.New(srv, sess, nil, "https://idp.example.com", "client", "secret", "https://example.com/callback", build)
+//
+//	srv.Routers().Use(sess)
+//	r.Get("/login", o.Login)
+//	r.Get("/callback", o.Callback)
+//
+// [OpenID Connect]: https://openid.net/specs/openid-connect-core-1_0.html
+// [PKCE]: https://datatracker.ietf.org/doc/html/rfc7636
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/middlewares/auth/session"
+)
+
+const (
+	// 从发起登录到 IdP 回调的最长时间
+	authRequestTTL = 10 * time.Minute
+
+	// 验证 ID 令牌时间相关字段时允许的误差
+	leeway = time.Minute
+
+	// 登录成功之后默认的跳转地址
+	defaultRedirect = "/"
+)
+
+// RedirectQuery 在 [OIDC.Login] 中指定登录成功之后跳转地址的查询参数名
+const RedirectQuery = "redirect"
+
+// 允许的 ID 令牌签名算法，不包含 none 和 HMAC。
+var supportedAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+type (
+	// OIDC OpenID Connect 登录管理
+	//
+	// T 为保存在 [session.Session] 中的用户数据类型。
+	OIDC[T any] struct {
+		session  *session.Session[T]
+		provider *provider
+		cache    web.Cache
+		build    BuildInfoFunc[T]
+		algs     []string
+
+		clientID, clientSecret string
+		redirectURL            string
+		scope                  string
+	}
+
+	// BuildInfoFunc 根据已验证的 ID 令牌生成保存在 session 中的用户数据
+	//
+	// 如果返回的 [web.Responser] 不为空，则表示拒绝该用户登录，直接将其返回给客户端。
+	BuildInfoFunc[T any] func(ctx *web.Context, token *IDToken) (T, web.Responser)
+
+	// IDToken 已验证的 ID 令牌
+	IDToken struct {
+		jwt.RegisteredClaims
+		Nonce             string `json:"nonce,omitempty"`
+		AuthTime          int64  `json:"auth_time,omitempty"`
+		AZP               string `json:"azp,omitempty"`
+		Name              string `json:"name,omitempty"`
+		PreferredUsername string `json:"preferred_username,omitempty"`
+		Email             string `json:"email,omitempty"`
+		EmailVerified     bool   `json:"email_verified,omitempty"`
+
+		// 以下字段并不来自 ID 令牌本身
+
+		Raw         string `json:"-"` // ID 令牌的原始内容
+		AccessToken string `json:"-"` // 与 ID 令牌一同返回的访问令牌
+	}
+
+	// 发起登录时保存的数据，以 state 为键名保存在缓存中。
+	authRequest struct {
+		SessionID string
+		Nonce     string
+		Verifier  string
+		Redirect  string
+	}
+
+	tokenResponse struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+)
+
+// New 声明 [OIDC] 对象
+//
+// 会从 issuer 获取 IdP 的元数据和公钥，如果无法获取会返回错误。
+//
+// sess 用于保存登录状态，[OIDC.Login] 和 [OIDC.Callback] 必须在 sess 的中间件之后调用；
+// client 访问 IdP 的客户端，如果为空则采用一个超时时间为 10 秒的客户端；
+// issuer 为 IdP 的标识，同时也是获取元数据的基地址；
+// clientID 和 clientSecret 为在 IdP 注册的客户端信息，clientSecret 为空表示公开客户端；
+// redirectURL 为 IdP 回调的地址，即 [OIDC.Callback] 所在的地址；
+// build 根据 ID 令牌生成用户数据；
+// scopes 额外申请的权限，openid 总是会被添加；
+func New[T any](s web.Server, sess *session.Session[T], client *http.Client, issuer, clientID, clientSecret, redirectURL string, build BuildInfoFunc[T], scopes ...string) (*OIDC[T], error) {
+	if sess == nil {
+		panic("参数 sess 不能为空")
+	}
+	if build == nil {
+		panic("参数 build 不能为空")
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: clientTimeout}
+	}
+
+	p, err := discover(client, issuer, s.Logs())
+	if err != nil {
+		return nil, err
+	}
+
+	algs := supportedAlgs
+	if len(p.meta.SigningAlgs) > 0 {
+		algs = slices.DeleteFunc(slices.Clone(p.meta.SigningAlgs), func(alg string) bool {
+			return slices.Index(supportedAlgs, alg) < 0
+		})
+	}
+
+	if slices.Index(scopes, "openid") < 0 {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	return &OIDC[T]{
+		session:  sess,
+		provider: p,
+		cache:    web.NewCache("oidc_"+clientID+"_", s.Cache()),
+		build:    build,
+		algs:     algs,
+
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+// Metadata 返回 IdP 的元数据
+func (o *OIDC[T]) Metadata() *Metadata { return o.provider.meta }
+
+// Login 跳转到 IdP 的登录页面
+//
+// 可以通过查询参数 [RedirectQuery] 指定登录成功之后跳转的地址，仅支持站内的地址。
+func (o *OIDC[T]) Login(ctx *web.Context) web.Responser {
+	sid, err := o.session.GetSessionID(ctx)
+	if err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+
+	req := &authRequest{
+		SessionID: sid,
+		Nonce:     mauth.RandString(32),
+		Verifier:  mauth.RandString(32),
+		Redirect:  localRedirect(ctx.Request().URL.Query().Get(RedirectQuery)),
+	}
+	state := mauth.RandString(32)
+	if err := o.cache.Set(state, req, authRequestTTL); err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.clientID)
+	q.Set("redirect_uri", o.redirectURL)
+	q.Set("scope", o.scope)
+	q.Set("state", state)
+	q.Set("nonce", req.Nonce)
+	q.Set("code_challenge", codeChallenge(req.Verifier))
+	q.Set("code_challenge_method", "S256")
+
+	u := o.provider.meta.AuthorizationEndpoint
+	if strings.IndexByte(u, '?') >= 0 {
+		u += "&" + q.Encode()
+	} else {
+		u += "?" + q.Encode()
+	}
+	return web.Status(http.StatusFound, "Location", u)
+}
+
+// Callback 处理 IdP 的回调
+//
+// 验证通过之后，会通过 [session.Session.Regenerate] 生成新的 session id，
+// 由 [BuildInfoFunc] 生成的数据将通过 [session.Session.Login] 保存，
+// 并跳转到 [OIDC.Login] 时指定的地址。
+func (o *OIDC[T]) Callback(ctx *web.Context) web.Responser {
+	q := ctx.Request().URL.Query()
+
+	state := q.Get("state")
+	if state == "" {
+		return ctx.Problem(web.ProblemBadRequest)
+	}
+	req := &authRequest{}
+	if err := o.cache.Get(state, req); err != nil {
+		ctx.Logs().DEBUG().Error(err)
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+	if err := o.cache.Delete(state); err != nil { // state 是一次性的
+		ctx.Logs().ERROR().Error(err)
+	}
+
+	// 防止将他人发起的登录请求注入到当前会话
+	if sid, err := o.session.GetSessionID(ctx); err != nil || sid != req.SessionID {
+		ctx.Logs().DEBUG().LocaleString(web.Phrase("oidc state does not belong to current session"))
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	if e := q.Get("error"); e != "" {
+		ctx.Logs().DEBUG().LocaleString(web.Phrase("oidc provider return error %s (%s)", e, q.Get("error_description")))
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	code := q.Get("code")
+	if code == "" {
+		return ctx.Problem(web.ProblemBadRequest)
+	}
+
+	resp, err := o.exchange(code, req.Verifier)
+	if err != nil {
+		ctx.Logs().ERROR().Error(err)
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	token, err := o.verify(resp.IDToken, req.Nonce)
+	if err != nil {
+		ctx.Logs().DEBUG().Error(err)
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+	token.AccessToken = resp.AccessToken
+
+	v, r := o.build(ctx, token)
+	if r != nil {
+		return r
+	}
+	if err := o.session.Regenerate(ctx); err != nil { // 防止会话固定攻击
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+	if err := o.session.Login(ctx, v); err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+
+	return web.Status(http.StatusFound, "Location", req.Redirect)
+}
+
+// 用授权码换取令牌
+func (o *OIDC[T]) exchange(code, verifier string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.redirectURL)
+	form.Set("code_verifier", verifier)
+	if o.clientSecret == "" { // 公开客户端
+		form.Set("client_id", o.clientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, o.provider.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.clientSecret != "" { // client_secret_basic
+		req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+	}
+
+	resp, err := o.provider.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tr := &tokenResponse{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(tr); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		return nil, web.NewLocaleError("oidc provider return error %s (%s)", tr.Error, tr.ErrorDescription)
+	}
+	if tr.IDToken == "" {
+		return nil, web.NewLocaleError("oidc provider not return id token")
+	}
+	return tr, nil
+}
+
+// 验证 ID 令牌
+//
+// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+func (o *OIDC[T]) verify(raw, nonce string) (*IDToken, error) {
+	token := &IDToken{}
+	_, err := jwt.ParseWithClaims(raw, token, o.provider.keyFunc,
+		jwt.WithValidMethods(o.algs),
+		jwt.WithIssuer(o.provider.meta.Issuer),
+		jwt.WithAudience(o.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Nonce != nonce {
+		return nil, web.NewLocaleError("invalid oidc nonce")
+	}
+	if (len(token.Audience) > 1 || token.AZP != "") && token.AZP != o.clientID {
+		return nil, web.NewLocaleError("invalid oidc authorized party %s", token.AZP)
+	}
+
+	token.Raw = raw
+	return token, nil
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// 仅允许站内的相对地址，防止开放重定向。
+func localRedirect(u string) string {
+	if u == "" || u[0] != '/' || strings.HasPrefix(u, "//") || strings.HasPrefix(u, "/\\") {
+		return defaultRedirect
+	}
+	return u
+}
@@ -0,0 +1,315 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth/session"
+)
+
+type user struct {
+	Sub   string
+	Email string
+}
+
+// 模拟的 IdP
+type idp struct {
+	a      *assert.Assertion
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	codes  map[string]url.Values // code => authorize 时的参数
+	mux    sync.Mutex
+	nonce  string // 不为空时，替换 ID 令牌中的 nonce
+	secret string
+	hits   int // 拉取 JWKS 的次数
+}
+
+func newIDP(a *assert.Assertion) *idp {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NotError(err)
+
+	p := &idp{a: a, key: key, codes: map[string]url.Values{}, secret: "secret"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&Metadata{
+			Issuer:                p.srv.URL,
+			AuthorizationEndpoint: p.srv.URL + "/authorize",
+			TokenEndpoint:         p.srv.URL + "/token",
+			JWKSURI:               p.srv.URL + "/jwks",
+			SigningAlgs:           []string{"RS256", "HS256"},
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mux.Lock()
+		p.hits++
+		p.mux.Unlock()
+
+		k, err := jwk.FromPublicKey("k1", "RS256", &p.key.PublicKey)
+		a.NotError(err)
+		x448 := &jwk.Key{Kty: "OKP", Kid: "x448", Crv: "X448", X: "eA"} // 不支持的密钥
+		json.NewEncoder(w).Encode(&jwk.Set{Keys: []*jwk.Key{k, x448}})
+	})
+
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := q.Get("state") + "-code"
+		p.mux.Lock()
+		p.codes[code] = q
+		p.mux.Unlock()
+
+		u := q.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, u, http.StatusFound)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != p.secret {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		a.NotError(r.ParseForm())
+		p.mux.Lock()
+		q, found := p.codes[r.PostForm.Get("code")]
+		delete(p.codes, r.PostForm.Get("code"))
+		p.mux.Unlock()
+		if !found || codeChallenge(r.PostForm.Get("code_verifier")) != q.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		nonce := q.Get("nonce")
+		if p.nonce != "" {
+			nonce = p.nonce
+		}
+		now := time.Now()
+		claims := &IDToken{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    p.srv.URL,
+				Subject:   "u1",
+				Audience:  jwt.ClaimStrings{"client"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			Nonce: nonce,
+			Email: "u1@example.com",
+		}
+		t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		t.Header["kid"] = "k1"
+		idToken, err := t.SignedString(p.key)
+		a.NotError(err)
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+
+	p.srv = httptest.NewServer(mux)
+	return p
+}
+
+func TestOIDC(t *testing.T) {
+	a := assert.New(t, false)
+	p := newIDP(a)
+	defer p.srv.Close()
+
+	srv := testserver.New(a)
+	store := session.NewCacheStore[*user](srv.Cache(), time.Minute)
+	sess := session.New(srv, store, 60, "session_id", "/", "localhost", false, true)
+	srv.Routers().Use(sess)
+
+	_, err := New(srv, sess, nil, p.srv.URL+"/not-exists", "client", "secret", "", func(*web.Context, *IDToken) (*user, web.Responser) {
+		return nil, nil
+	})
+	a.Error(err)
+
+	o, err := New(srv, sess, nil, p.srv.URL, "client", "secret", "http://localhost:8080/callback", func(ctx *web.Context, token *IDToken) (*user, web.Responser) {
+		return &user{Sub: token.Subject, Email: token.Email}, nil
+	}, "email")
+	a.NotError(err).NotNil(o).
+		Equal(o.scope, "openid email").
+		Equal(o.algs, []string{"RS256"}) // HS256 被过滤
+
+	r := srv.Routers().New("def", nil)
+	r.Get("/login", o.Login)
+	r.Get("/callback", o.Callback)
+	r.Get("/info", func(ctx *web.Context) web.Responser {
+		u, found := sess.GetInfo(ctx)
+		if !found || u.Sub == "" {
+			return ctx.Problem(web.ProblemUnauthorized)
+		}
+		return web.OK(u)
+	})
+
+	defer servertest.Run(a, srv)()
+	defer srv.Close(0)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	login := func() (*http.Cookie, string) {
+		resp := servertest.Get(a, "http://localhost:8080/login?redirect=/info").
+			Client(client).
+			Do(nil).
+			Status(http.StatusFound).
+			Resp()
+		cookie := resp.Cookies()[0]
+
+		loc, err := url.Parse(resp.Header.Get("Location"))
+		a.NotError(err)
+		q := loc.Query()
+		a.Equal(q.Get("client_id"), "client").
+			Equal(q.Get("code_challenge_method"), "S256").
+			Equal(q.Get("scope"), "openid email").
+			NotEmpty(q.Get("nonce")).
+			NotEmpty(q.Get("state"))
+
+		// IdP 回调地址
+		resp = servertest.Get(a, loc.String()).Client(client).Do(nil).Status(http.StatusFound).Resp()
+		return cookie, resp.Header.Get("Location")
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		a := assert.New(t, false)
+		cookie, callback := login()
+
+		cookies := servertest.Get(a, callback).
+			Client(client).
+			Cookie(cookie).
+			Do(nil).
+			Status(http.StatusFound).
+			Header("Location", "/info").
+			Resp().Cookies()
+		newCookie := cookies[len(cookies)-1] // 登录之后生成了新的 session id
+		a.NotEqual(newCookie.Value, cookie.Value)
+
+		// 旧的 session 不再有效
+		servertest.Get(a, "http://localhost:8080/info").
+			Cookie(cookie).
+			Do(nil).
+			Status(http.StatusUnauthorized)
+
+		servertest.Get(a, "http://localhost:8080/info").
+			Cookie(newCookie).
+			Do(nil).
+			Status(http.StatusOK).
+			BodyFunc(func(a *assert.Assertion, body []byte) {
+				u := &user{}
+				a.NotError(json.Unmarshal(body, u)).
+					Equal(u, &user{Sub: "u1", Email: "u1@example.com"})
+			})
+
+		// state 只能使用一次
+		servertest.Get(a, callback).
+			Client(client).
+			Cookie(cookie).
+			Do(nil).
+			Status(http.StatusUnauthorized)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		a := assert.New(t, false)
+		_, callback := login()
+
+		// 不同的会话
+		servertest.Get(a, callback).
+			Client(client).
+			Do(nil).
+			Status(http.StatusUnauthorized)
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		a := assert.New(t, false)
+		cookie, callback := login()
+
+		p.nonce = "invalid"
+		defer func() { p.nonce = "" }()
+		servertest.Get(a, callback).
+			Client(client).
+			Cookie(cookie).
+			Do(nil).
+			Status(http.StatusUnauthorized)
+	})
+
+	t.Run("client secret", func(t *testing.T) {
+		a := assert.New(t, false)
+		cookie, callback := login()
+
+		p.secret = "other"
+		defer func() { p.secret = "secret" }()
+		servertest.Get(a, callback).
+			Client(client).
+			Cookie(cookie).
+			Do(nil).
+			Status(http.StatusUnauthorized)
+	})
+}
+
+func TestProvider_keyFunc(t *testing.T) {
+	a := assert.New(t, false)
+	s := testserver.New(a)
+	idp := newIDP(a)
+	defer idp.srv.Close()
+
+	p, err := discover(idp.srv.Client(), idp.srv.URL, s.Logs())
+	a.NotError(err).Length(p.keys, 1) // 忽略不支持的密钥
+	a.Equal(idp.hits, 1)
+
+	token := &jwt.Token{Header: map[string]any{"kid": "k1"}}
+	k, err := p.keyFunc(token)
+	a.NotError(err).Equal(k, &idp.key.PublicKey)
+
+	// 未知的 kid，但是距上次拉取不足一分钟。
+	token.Header["kid"] = "k2"
+	_, err = p.keyFunc(token)
+	a.Error(err).Equal(idp.hits, 1)
+
+	// 并发的请求只会拉取一次
+	p.lastRefresh = time.Now().Add(-jwksRefreshInterval)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.keyFunc(&jwt.Token{Header: map[string]any{"kid": "k2"}})
+			a.Error(err)
+		}()
+	}
+	wg.Wait()
+	idp.mux.Lock()
+	a.Equal(idp.hits, 2)
+	idp.mux.Unlock()
+}
+
+func TestLocalRedirect(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Equal(localRedirect(""), defaultRedirect).
+		Equal(localRedirect("/path?a=1"), "/path?a=1").
+		Equal(localRedirect("//example.com"), defaultRedirect).
+		Equal(localRedirect("/\\example.com"), defaultRedirect).
+		Equal(localRedirect("https://example.com"), defaultRedirect)
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package oidc
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/internal/jwk"
+)
+
+const (
+	jwksRefreshInterval = time.Minute      // 两次因未知 kid 而重新拉取 JWKS 的最小间隔
+	clientTimeout       = 10 * time.Second // 默认客户端的超时时间
+	maxBodySize         = 1 << 20          // IdP 返回内容的最大长度
+)
+
+// Metadata OpenID Provider 的元数据
+//
+// 由 {issuer}/.well-known/openid-configuration 返回，仅包含了用到的字段。
+type Metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI               string   `json:"jwks_uri"`
+	EndSessionEndpoint    string   `json:"end_session_endpoint,omitempty"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+type provider struct {
+	client *http.Client
+	meta   *Metadata
+	logs   web.Logs
+
+	keys        map[string]any // kid => 公钥
+	keysMux     sync.RWMutex
+	lastRefresh time.Time
+}
+
+func discover(client *http.Client, issuer string, logs web.Logs) (*provider, error) {
+	meta := &Metadata{}
+	if err := getJSON(client, strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", meta); err != nil {
+		return nil, err
+	}
+
+	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if meta.Issuer != issuer {
+		return nil, web.NewLocaleError("oidc issuer %s does not match %s", meta.Issuer, issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, web.NewLocaleError("incomplete oidc provider metadata")
+	}
+
+	p := &provider{client: client, meta: meta, logs: logs}
+	if err := p.refreshKeys(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *provider) refreshKeys() error {
+	set := &jwk.Set{}
+	if err := getJSON(p.client, p.meta.JWKSURI, set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Kty == "oct" { // 对称密钥不应该出现在公开的 JWKS 中
+			continue
+		}
+
+		pub, err := k.PublicKey()
+		if err != nil { // 不支持的密钥不影响其它密钥的使用
+			p.logs.WARN().LocaleString(web.Phrase("skip jwks key %s in %s, %s", k.Kid, p.meta.JWKSURI, err))
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	p.keysMux.Lock()
+	p.keys = keys
+	p.lastRefresh = time.Now()
+	p.keysMux.Unlock()
+	return nil
+}
+
+// keyFunc 查找验证 ID 令牌的公钥
+//
+// 如果 kid 不存在，会尝试重新拉取 JWKS，以应对 IdP 的密钥轮换。
+func (p *provider) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	p.keysMux.RLock()
+	k, found := p.keys[kid]
+	p.keysMux.RUnlock()
+	if found {
+		return k, nil
+	}
+
+	if !p.startRefresh(time.Now()) {
+		return nil, web.NewLocaleError("not found oidc key %s", kid)
+	}
+
+	if err := p.refreshKeys(); err != nil {
+		return nil, err
+	}
+
+	p.keysMux.RLock()
+	defer p.keysMux.RUnlock()
+	if k, found = p.keys[kid]; found {
+		return k, nil
+	}
+	return nil, web.NewLocaleError("not found oidc key %s", kid)
+}
+
+// 如果距上次拉取已经超过 [jwksRefreshInterval]，则将 now 记为拉取时间并返回 true。
+//
+// 判断和更新在同一个临界区内，保证并发请求中只有一个会真正拉取。
+func (p *provider) startRefresh(now time.Time) bool {
+	p.keysMux.Lock()
+	defer p.keysMux.Unlock()
+
+	if now.Sub(p.lastRefresh) < jwksRefreshInterval {
+		return false
+	}
+	p.lastRefresh = now
+	return true
+}
+
+func getJSON(client *http.Client, url string, v any) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return web.NewLocaleError("request %s return status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(v)
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package paseto PASETO v4 令牌的验证
+//
+// 与 [jwt] 有着相同的使用方式，同时复用了 [jwt.Claims]、[jwt.Blocker] 和 [jwt.Extractor] 等类型，
+// 令牌的提取、拉黑、刷新和输出等流程也由 [jwt.NewVerifierWith] 和 [jwt.NewSignerWith] 实现，
+// 但是令牌格式不包含算法字段，不存在算法混淆的问题。
+//
+//	p := New[*jwt.UserClaims[int64, struct{}]](blocker, builder, time.Hour, 2*time.Hour, nil)
+//
+//	// 添加密钥
+//	p.AddPublic("ed25519", pvt)
+//	p.AddLocal("local", secret)
+//
+// 支持 v4.public 和 v4.local 两种令牌，密钥的 ID 以 {"kid":"id"} 的形式保存在 footer 中。
+//
+// NOTE: claims 采用 [json] 编码，时间字段沿用 [jwt.Claims] 的 Unix 时间戳格式，
+// 而不是 PASETO 规范中推荐的 ISO 8601 格式。
+//
+// https://github.com/paseto-standard/paseto-spec
+package paseto
+
+import (
+	"crypto/ed25519"
+	"time"
+
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth"
+	"github.com/issue9/webuse/v7/middlewares/auth/jwt"
+)
+
+var (
+	errKeyNotFound  = web.NewLocaleError("not found paseto key")
+	errInvalidToken = web.NewLocaleError("invalid paseto token")
+)
+
+type (
+	key struct {
+		id      string
+		local   []byte             // v4.local 的密钥
+		public  ed25519.PublicKey  // v4.public 的公钥
+		private ed25519.PrivateKey // v4.public 的私钥，仅对 [Signer] 有效。
+	}
+
+	// 令牌的 footer
+	footer struct {
+		Kid string `json:"kid"`
+	}
+
+	// PASETO PASETO 管理
+	//
+	// 同时包含了 [Verifier] 和 [Signer]，大部分时候这是比直接使用 [Verifier] 和 [Signer] 更方便的方法。
+	PASETO[T jwt.Claims] struct {
+		v *Verifier[T]
+		s *Signer
+	}
+)
+
+func ErrKeyNotFound() error { return errKeyNotFound }
+
+func ErrInvalidToken() error { return errInvalidToken }
+
+// New 声明 [PASETO] 对象
+//
+// 参数可参考 [NewVerifier] 和 [NewSigner]
+func New[T jwt.Claims](b jwt.Blocker[T], f jwt.BuildClaimsFunc[T], expired, refresh time.Duration, br jwt.BuildResponseFunc) *PASETO[T] {
+	v := NewVerifier(b, f)
+	s := NewSigner(expired, refresh, br)
+	return &PASETO[T]{v: v, s: s}
+}
+
+func (p *PASETO[T]) Logout(ctx *web.Context) error { return p.v.Logout(ctx) }
+
+// VerifyRefresh 验证刷新令牌
+func (p *PASETO[T]) VerifyRefresh(next web.HandlerFunc) web.HandlerFunc {
+	return p.v.VerifyRefresh(next)
+}
+
+// Middleware 解码用户的令牌并写入 [web.Context]
+func (p *PASETO[T]) Middleware(next web.HandlerFunc) web.HandlerFunc { return p.v.Middleware(next) }
+
+func (p *PASETO[T]) GetInfo(ctx *web.Context) (T, bool) { return p.v.GetInfo(ctx) }
+
+// SetSink 指定接收验证相关事件的对象
+//
+// 参考 [Verifier.SetSink]。
+func (p *PASETO[T]) SetSink(sink auth.Sink) { p.v.SetSink(sink) }
+
+// SetExtractors 指定提取令牌的方式
+//
+// 参考 [Verifier.SetExtractors]。
+func (p *PASETO[T]) SetExtractors(e ...jwt.Extractor) { p.v.SetExtractors(e...) }
+
+// Render 向客户端输出令牌
+//
+// 参考 [Signer.Render]。
+func (p *PASETO[T]) Render(ctx *web.Context, status int, accessClaims jwt.Claims) web.Responser {
+	return p.s.Render(ctx, status, accessClaims)
+}
+
+// Sign 对 claims 进行签名或是加密
+//
+// 参考 [Signer.Sign]。
+func (p *PASETO[T]) Sign(claims jwt.Claims) (string, error) { return p.s.Sign(claims) }
+
+// AddPublic 添加 v4.public 的密钥
+//
+// 公钥由 pvt 导出。
+//
+// NOTE: 调用者需要保证每次重启之后，id 值不能改变，否则所有的登录信息令牌将失效。
+func (p *PASETO[T]) AddPublic(id string, pvt ed25519.PrivateKey) {
+	p.v.AddPublic(id, checkPrivate(pvt).Public().(ed25519.PublicKey))
+	p.s.AddPublic(id, pvt)
+}
+
+// AddLocal 添加 v4.local 的密钥
+//
+// key 的长度必须为 [LocalKeySize]。
+//
+// NOTE: 调用者需要保证每次重启之后，id 值不能改变，否则所有的登录信息令牌将失效。
+func (p *PASETO[T]) AddLocal(id string, key []byte) {
+	p.v.AddLocal(id, key)
+	p.s.AddLocal(id, key)
+}
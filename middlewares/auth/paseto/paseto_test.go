@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package paseto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	xjwt "github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	xjson "github.com/issue9/web/mimetype/json"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+	"github.com/issue9/webuse/v7/middlewares/auth/jwt"
+)
+
+type testClaims = jwt.UserClaims[int64, struct{}]
+
+var _ auth.Auth[*testClaims] = &PASETO[*testClaims]{}
+
+func newPASETO(a *assert.Assertion) (web.Server, *PASETO[*testClaims]) {
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := jwt.NewCacheBlocker[*testClaims](s, "test_", time.Hour, 2*time.Hour)
+	p := New(b, func() *testClaims { return &testClaims{} }, time.Hour, 2*time.Hour, nil)
+	a.NotNil(p)
+	return s, p
+}
+
+func randKey(a *assert.Assertion) []byte {
+	key := make([]byte, LocalKeySize)
+	_, err := rand.Read(key)
+	a.NotError(err)
+	return key
+}
+
+func TestPASETO_Middleware(t *testing.T) {
+	a := assert.New(t, false)
+
+	_, pvt, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+
+	s, p := newPASETO(a)
+	p.AddPublic("public", pvt)
+	verifierMiddleware(a, s, p, headerPublic)
+
+	s, p = newPASETO(a)
+	p.AddLocal("local", randKey(a))
+	verifierMiddleware(a, s, p, headerLocal)
+
+	a.PanicString(func() {
+		p.AddLocal("local", randKey(a))
+	}, "存在同名的密钥 local")
+
+	a.PanicString(func() {
+		p.AddLocal("short", []byte("secret"))
+	}, "参数 key 的长度必须为 32")
+
+	a.PanicString(func() {
+		p.AddPublic("short", ed25519.PrivateKey("secret"))
+	}, "参数 pvt 的长度必须为 64")
+
+	a.PanicString(func() {
+		p.v.AddPublic("short", ed25519.PublicKey("secret"))
+	}, "参数 pub 的长度必须为 32")
+}
+
+func verifierMiddleware(a *assert.Assertion, s web.Server, p *PASETO[*testClaims], header string) {
+	a.TB().Helper()
+
+	const id = 1
+
+	r := s.Routers().New("def", nil)
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		return p.Render(ctx, http.StatusCreated, jwt.NewUserClaims(int64(id), struct{}{}))
+	})
+
+	r.Post("/refresh", p.VerifyRefresh(func(ctx *web.Context) web.Responser {
+		claims, ok := p.GetInfo(ctx)
+		if !ok {
+			return ctx.Problem(web.ProblemUnauthorized)
+		}
+		return p.Render(ctx, http.StatusCreated, jwt.NewUserClaims(claims.UserID, struct{}{}))
+	}))
+
+	r.Get("/info", p.Middleware(func(ctx *web.Context) web.Responser {
+		val, found := p.GetInfo(ctx)
+		if !found {
+			return web.Status(http.StatusNotFound)
+		}
+
+		if val.UserID != id {
+			return web.Status(http.StatusUnauthorized)
+		}
+
+		return web.OK(nil)
+	}))
+
+	r.Delete("/login", p.Middleware(func(ctx *web.Context) web.Responser {
+		if err := p.Logout(ctx); err != nil {
+			return ctx.Error(err, web.ProblemInternalServerError)
+		}
+		return web.NoContent()
+	}))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	resp := &jwt.Response{}
+	servertest.Post(a, "http://localhost:8080/login", nil).
+		Do(nil).
+		Status(http.StatusCreated).
+		BodyFunc(func(a *assert.Assertion, body []byte) {
+			a.NotError(xjson.Unmarshal(bytes.NewBuffer(body), resp)).
+				NotEmpty(resp.Access).
+				NotEmpty(resp.Refresh)
+		})
+	a.True(bytes.HasPrefix([]byte(resp.Access), []byte(header))).
+		True(bytes.HasPrefix([]byte(resp.Refresh), []byte(header)))
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+resp.Access).
+		Do(nil).
+		Status(http.StatusOK)
+
+	// 普通令牌不能用于刷新
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Header(mauth.AuthorizationHeader, "Bearer "+resp.Access).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	resp2 := &jwt.Response{}
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Header(mauth.AuthorizationHeader, "Bearer "+resp.Refresh).
+		Do(nil).
+		Status(http.StatusCreated).
+		BodyFunc(func(a *assert.Assertion, body []byte) {
+			a.NotError(xjson.Unmarshal(bytes.NewBuffer(body), resp2)).
+				NotEmpty(resp2.Access).
+				NotEmpty(resp2.Refresh)
+		})
+
+	// 旧令牌已经无法访问
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+resp.Access).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+resp2.Access).
+		Do(nil).
+		Status(http.StatusOK)
+
+	servertest.Delete(a, "http://localhost:8080/login").
+		Header(mauth.AuthorizationHeader, "Bearer "+resp2.Access).
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	// 令牌已经在 delete /login 中被弃用
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+resp2.Access).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	servertest.Get(a, "http://localhost:8080/info").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	// 刷新令牌只能使用一次
+	servertest.Post(a, "http://localhost:8080/refresh", nil).
+		Header(mauth.AuthorizationHeader, "Bearer "+resp.Refresh).
+		Do(nil).
+		Status(http.StatusUnauthorized)
+}
+
+func TestVerifier_parse(t *testing.T) {
+	a := assert.New(t, false)
+	_, p := newPASETO(a)
+
+	_, pvt, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+	p.AddPublic("public", pvt)
+	p.AddLocal("local", randKey(a))
+
+	for range 10 { // 随机选取密钥
+		claims := jwt.NewUserClaims(int64(1), struct{}{})
+		token, err := p.Sign(claims)
+		a.NotError(err)
+
+		c, err := p.v.parse(token)
+		a.NotError(err).Equal(c.UserID, 1).Equal(c.ID, claims.ID)
+	}
+
+	// 已过期
+	claims := jwt.NewUserClaims(int64(1), struct{}{})
+	claims.SetTimes(time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	token, err := p.Sign(claims)
+	a.NotError(err)
+	c, err := p.v.parse(token)
+	a.ErrorIs(err, xjwt.ErrTokenExpired).Nil(c)
+
+	// 未找到密钥，同时 blocker 可以为空。
+	v := NewVerifier[*testClaims](nil, p.v.claimsBuilder)
+	v.AddLocal("other", randKey(a))
+	token, err = p.Sign(jwt.NewUserClaims(int64(1), struct{}{}))
+	a.NotError(err)
+	c, err = v.parse(token)
+	a.Equal(err, ErrKeyNotFound()).Nil(c)
+
+	// 密钥与令牌的类型不匹配
+	s := NewSigner(time.Hour, 0, nil)
+	s.AddPublic("local", pvt)
+	token, err = s.Sign(jwt.NewUserClaims(int64(1), struct{}{}))
+	a.NotError(err)
+	c, err = p.v.parse(token)
+	a.Equal(err, ErrInvalidToken()).Nil(c)
+
+	// 非 PASETO 令牌
+	for _, token := range []string{"", "v3.public.YQ", "eyJhbGciOiJub25lIn0.e30.", "v4.public.YQ", "v4.public.YQ.e30"} {
+		c, err = p.v.parse(token)
+		a.Equal(err, ErrInvalidToken(), token).Nil(c)
+	}
+
+	// 没有密钥
+	token, err = NewSigner(time.Hour, 0, nil).Sign(claims)
+	a.Equal(err, ErrKeyNotFound()).Empty(token)
+}
+
+func TestVerifier_SetSink(t *testing.T) {
+	a := assert.New(t, false)
+	s, p := newPASETO(a)
+	p.AddLocal("local", randKey(a))
+
+	events := make([]*auth.Event, 0, 10)
+	p.SetSink(auth.SinkFunc(func(e *auth.Event) { events = append(events, e) }))
+
+	r := s.Routers().New("def", nil)
+	r.Get("/info", p.Middleware(func(*web.Context) web.Responser { return web.NoContent() }))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	token, err := p.Sign(jwt.NewUserClaims(int64(1), struct{}{}))
+	a.NotError(err)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token).
+		Do(nil).
+		Status(http.StatusNoContent)
+	servertest.Get(a, "http://localhost:8080/info").
+		Header(mauth.AuthorizationHeader, "Bearer "+token+"x").
+		Do(nil).
+		Status(http.StatusUnauthorized)
+
+	a.Length(events, 2).
+		Equal(events[0].Type, auth.EventSuccess).
+		Equal(events[0].Source, "paseto").
+		Equal(events[1].Type, auth.EventFailure).
+		Equal(events[1].Reason, auth.ReasonInvalidCredential).
+		Equal(events[1].Source, "paseto")
+}
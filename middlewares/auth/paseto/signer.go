@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package paseto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth/jwt"
+)
+
+// Signer 令牌的签发管理
+//
+// 仅负责对令牌的签发，如果需要验证令牌，则需要 [Verifier] 对象，
+// 同时需要保证 [Verifier] 添加的密钥数量和 ID 与当前对象是相同的。
+//
+// 令牌的输出流程与 [jwt.Signer] 相同。
+type Signer struct {
+	s       *jwt.Signer
+	keys    []*key
+	keysMux sync.RWMutex
+}
+
+// NewSigner 声明签名对象
+//
+// expired 普通令牌的过期时间；
+// refresh 刷新令牌的时间，非零表示有刷新令牌，如果为非零值，则必须大于 expired；
+// br 表示将令牌组合成一个对象用以返回给客户端，可以为空，采用返回 [jwt.Response] 作为其默认实现；
+func NewSigner(expired, refresh time.Duration, br jwt.BuildResponseFunc) *Signer {
+	s := &Signer{keys: make([]*key, 0, 10)}
+	s.s = jwt.NewSignerWith(expired, refresh, br, func(_ context.Context, claims jwt.Claims) (string, error) {
+		return s.Sign(claims)
+	})
+	return s
+}
+
+// Render 向客户端输出令牌
+//
+// 参考 [jwt.Signer.Render]。
+func (s *Signer) Render(ctx *web.Context, status int, accessClaims jwt.Claims) web.Responser {
+	return s.s.Render(ctx, status, accessClaims)
+}
+
+// Sign 对 claims 进行签名或是加密
+//
+// 从已添加的密钥中随机选取一个，根据密钥的类型生成 v4.public 或是 v4.local 令牌。
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	k := s.selectKey()
+	if k == nil {
+		return "", ErrKeyNotFound()
+	}
+
+	m, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := json.Marshal(&footer{Kid: k.id})
+	if err != nil {
+		return "", err
+	}
+
+	if k.local != nil {
+		return encryptLocal(k.local, m, f, nil)
+	}
+	return signPublic(k.private, m, f, nil), nil
+}
+
+func (s *Signer) selectKey() *key {
+	s.keysMux.RLock()
+	defer s.keysMux.RUnlock()
+
+	if len(s.keys) == 0 {
+		return nil
+	}
+	return s.keys[rand.Intn(len(s.keys))]
+}
+
+func (s *Signer) addKey(k *key) {
+	s.keysMux.Lock()
+	defer s.keysMux.Unlock()
+
+	if slices.IndexFunc(s.keys, func(e *key) bool { return e.id == k.id }) >= 0 {
+		panic(fmt.Sprintf("存在同名的密钥 %s", k.id))
+	}
+	s.keys = append(s.keys, k)
+}
+
+// AddPublic 添加 v4.public 的私钥
+func (s *Signer) AddPublic(id string, pvt ed25519.PrivateKey) {
+	s.addKey(&key{id: id, private: checkPrivate(pvt)})
+}
+
+// AddLocal 添加 v4.local 的密钥
+//
+// key 的长度必须为 [LocalKeySize]。
+func (s *Signer) AddLocal(id string, key []byte) {
+	s.addKey(newLocalKey(id, key))
+}
+
+func checkPrivate(pvt ed25519.PrivateKey) ed25519.PrivateKey {
+	if len(pvt) != ed25519.PrivateKeySize {
+		panic(fmt.Sprintf("参数 pvt 的长度必须为 %d", ed25519.PrivateKeySize))
+	}
+	return pvt
+}
+
+func newLocalKey(id string, data []byte) *key {
+	if len(data) != LocalKeySize {
+		panic(fmt.Sprintf("参数 key 的长度必须为 %d", LocalKeySize))
+	}
+	return &key{id: id, local: slices.Clone(data)}
+}
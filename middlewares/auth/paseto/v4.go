@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package paseto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+// 令牌的报头
+const (
+	headerPublic = "v4.public."
+	headerLocal  = "v4.local."
+)
+
+const (
+	nonceSize = 32 // v4.local 中随机数的长度
+	macSize   = 32 // v4.local 中认证标签的长度
+
+	// LocalKeySize v4.local 的密钥长度
+	LocalKeySize = 32
+)
+
+var encoding = base64.RawURLEncoding
+
+// 预认证编码
+//
+// https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Common.md#pae-definition
+func pae(pieces ...[]byte) []byte {
+	size := 8
+	for _, p := range pieces {
+		size += 8 + len(p)
+	}
+
+	out := make([]byte, 8, size)
+	binary.LittleEndian.PutUint64(out, uint64(len(pieces)))
+	for _, p := range pieces {
+		out = binary.LittleEndian.AppendUint64(out, uint64(len(p)))
+		out = append(out, p...)
+	}
+	return out
+}
+
+// 组合令牌，footer 为空时不输出。
+func join(header string, body, footer []byte) string {
+	token := header + encoding.EncodeToString(body)
+	if len(footer) > 0 {
+		token += "." + encoding.EncodeToString(footer)
+	}
+	return token
+}
+
+// 拆分令牌，header 不匹配或是格式错误时返回 false。
+func split(token, header string) (body, footer []byte, ok bool) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, false
+	}
+
+	b, f, found := strings.Cut(token[len(header):], ".")
+	if found && f == "" { // 有分隔符时，footer 不能为空。
+		return nil, nil, false
+	}
+
+	body, err := encoding.DecodeString(b)
+	if err != nil {
+		return nil, nil, false
+	}
+	if footer, err = encoding.DecodeString(f); err != nil {
+		return nil, nil, false
+	}
+	return body, footer, true
+}
+
+// 读取令牌中的 footer 而不作任何验证
+func peekFooter(token string) ([]byte, bool) {
+	var header string
+	switch {
+	case strings.HasPrefix(token, headerPublic):
+		header = headerPublic
+	case strings.HasPrefix(token, headerLocal):
+		header = headerLocal
+	default:
+		return nil, false
+	}
+
+	_, f, _ := strings.Cut(token[len(header):], ".")
+	footer, err := encoding.DecodeString(f)
+	return footer, err == nil
+}
+
+// v4.public 签名
+func signPublic(pvt ed25519.PrivateKey, m, f, i []byte) string {
+	sig := ed25519.Sign(pvt, pae([]byte(headerPublic), m, f, i))
+	body := make([]byte, 0, len(m)+len(sig))
+	body = append(body, m...)
+	body = append(body, sig...)
+	return join(headerPublic, body, f)
+}
+
+// 验证 v4.public 令牌并返回其中的消息
+func verifyPublic(pub ed25519.PublicKey, token string, i []byte) ([]byte, bool) {
+	body, f, ok := split(token, headerPublic)
+	if !ok || len(body) < ed25519.SignatureSize {
+		return nil, false
+	}
+
+	m, sig := body[:len(body)-ed25519.SignatureSize], body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(pub, pae([]byte(headerPublic), m, f, i), sig) {
+		return nil, false
+	}
+	return m, true
+}
+
+// v4.local 加密
+func encryptLocal(key, m, f, i []byte) (string, error) {
+	n := make([]byte, nonceSize)
+	if _, err := rand.Read(n); err != nil {
+		return "", err
+	}
+	return encryptLocalWithNonce(key, n, m, f, i)
+}
+
+func encryptLocalWithNonce(key, n, m, f, i []byte) (string, error) {
+	ek, n2, ak, err := splitLocalKey(key, n)
+	if err != nil {
+		return "", err
+	}
+
+	c := make([]byte, len(m))
+	cipher, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return "", err
+	}
+	cipher.XORKeyStream(c, m)
+
+	t, err := localMAC(ak, n, c, f, i)
+	if err != nil {
+		return "", err
+	}
+
+	body := make([]byte, 0, len(n)+len(c)+len(t))
+	body = append(body, n...)
+	body = append(body, c...)
+	body = append(body, t...)
+	return join(headerLocal, body, f), nil
+}
+
+// 解密 v4.local 令牌
+func decryptLocal(key []byte, token string, i []byte) ([]byte, bool) {
+	body, f, ok := split(token, headerLocal)
+	if !ok || len(body) < nonceSize+macSize {
+		return nil, false
+	}
+
+	n, c, t := body[:nonceSize], body[nonceSize:len(body)-macSize], body[len(body)-macSize:]
+	ek, n2, ak, err := splitLocalKey(key, n)
+	if err != nil {
+		return nil, false
+	}
+
+	t2, err := localMAC(ak, n, c, f, i)
+	if err != nil || subtle.ConstantTimeCompare(t, t2) != 1 {
+		return nil, false
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return nil, false
+	}
+	m := make([]byte, len(c))
+	cipher.XORKeyStream(m, c)
+	return m, true
+}
+
+// 根据密钥和随机数派生出加密密钥 ek、XChaCha20 的随机数 n2 以及认证密钥 ak
+func splitLocalKey(key, n []byte) (ek, n2, ak []byte, err error) {
+	tmp, err := keyedHash(key, 56, []byte("paseto-encryption-key"), n)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if ak, err = keyedHash(key, 32, []byte("paseto-auth-key-for-aead"), n); err != nil {
+		return nil, nil, nil, err
+	}
+	return tmp[:32], tmp[32:], ak, nil
+}
+
+func localMAC(ak, n, c, f, i []byte) ([]byte, error) {
+	return keyedHash(ak, macSize, pae([]byte(headerLocal), n, c, f, i))
+}
+
+func keyedHash(key []byte, size int, data ...[]byte) ([]byte, error) {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package paseto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestPAE(t *testing.T) {
+	a := assert.New(t, false)
+
+	// https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Common.md#pae-definition
+	a.Equal(pae(), []byte("\x00\x00\x00\x00\x00\x00\x00\x00")).
+		Equal(pae([]byte{}), []byte("\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")).
+		Equal(pae([]byte("test")), []byte("\x01\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00test"))
+}
+
+func TestPublic(t *testing.T) {
+	a := assert.New(t, false)
+
+	// https://github.com/paseto-standard/test-vectors/blob/master/v4.json 4-S-1
+	sk, err := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	a.NotError(err)
+	pvt := ed25519.PrivateKey(sk)
+	pub := pvt.Public().(ed25519.PublicKey)
+	const (
+		m     = `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`
+		token = "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+	)
+	a.Equal(signPublic(pvt, []byte(m), nil, nil), token)
+	data, ok := verifyPublic(pub, token, nil)
+	a.True(ok).Equal(string(data), m)
+
+	// footer 和隐式断言
+	token2 := signPublic(pvt, []byte(m), []byte(`{"kid":"1"}`), []byte("i"))
+	data, ok = verifyPublic(pub, token2, []byte("i"))
+	a.True(ok).Equal(string(data), m)
+	data, ok = verifyPublic(pub, token2, nil)
+	a.False(ok).Nil(data)
+
+	// 修改了 footer
+	footer, ok := peekFooter(token2)
+	a.True(ok).Equal(string(footer), `{"kid":"1"}`)
+	data, ok = verifyPublic(pub, token2[:len(token2)-2]+"fQ", []byte("i"))
+	a.False(ok).Nil(data)
+
+	// 其它的公钥
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	a.NotError(err)
+	data, ok = verifyPublic(other, token, nil)
+	a.False(ok).Nil(data)
+
+	// 格式错误
+	for _, t := range []string{"", "v4.public.", "v4.public.YQ", "v4.local." + token[10:], token + ".", token + ".*"} {
+		data, ok = verifyPublic(pub, t, nil)
+		a.False(ok, t).Nil(data)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	a := assert.New(t, false)
+
+	// https://github.com/paseto-standard/test-vectors/blob/master/v4.json 4-E-1
+	key, err := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	a.NotError(err)
+	const (
+		m     = `{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`
+		token = "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg"
+	)
+	tk, err := encryptLocalWithNonce(key, make([]byte, nonceSize), []byte(m), nil, nil)
+	a.NotError(err).Equal(tk, token)
+	data, ok := decryptLocal(key, token, nil)
+	a.True(ok).Equal(string(data), m)
+
+	// 随机的 nonce
+	tk1, err := encryptLocal(key, []byte(m), []byte(`{"kid":"1"}`), nil)
+	a.NotError(err)
+	tk2, err := encryptLocal(key, []byte(m), []byte(`{"kid":"1"}`), nil)
+	a.NotError(err).NotEqual(tk1, tk2)
+	data, ok = decryptLocal(key, tk1, nil)
+	a.True(ok).Equal(string(data), m)
+
+	// 隐式断言不匹配
+	data, ok = decryptLocal(key, tk1, []byte("i"))
+	a.False(ok).Nil(data)
+
+	// 其它的密钥
+	other := make([]byte, LocalKeySize)
+	data, ok = decryptLocal(other, tk1, nil)
+	a.False(ok).Nil(data)
+
+	// 格式错误
+	for _, t := range []string{"", "v4.local.", "v4.local.YQ", "v4.public." + token[9:]} {
+		data, ok = decryptLocal(key, t, nil)
+		a.False(ok, t).Nil(data)
+	}
+}
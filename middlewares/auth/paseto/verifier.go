@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package paseto
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	xjwt "github.com/golang-jwt/jwt/v5"
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth"
+	"github.com/issue9/webuse/v7/middlewares/auth/jwt"
+)
+
+const maxFooterSize = 1024 // footer 的最大长度，防止恶意的超长数据。
+
+// Verifier 令牌的验证器
+//
+// 仅负责对令牌的验证，如果需要签发令牌，则需要 [Signer] 对象，
+// 同时需要保证 [Signer] 添加的密钥数量和 ID 与当前对象是相同的。
+//
+// 令牌的提取、拉黑和刷新等流程与 [jwt.Verifier] 相同。
+type Verifier[T jwt.Claims] struct {
+	v             *jwt.Verifier[T]
+	claimsBuilder jwt.BuildClaimsFunc[T]
+	keys          []*key
+	keysMux       sync.RWMutex
+	validator     *xjwt.Validator
+}
+
+// NewVerifier 声明 [Verifier] 对象
+//
+// b 为处理丢弃令牌的对象，如果为空表示不会对任何令牌作特殊处理；
+// f 为 [jwt.Claims] 对象的生成方法；
+func NewVerifier[T jwt.Claims](b jwt.Blocker[T], f jwt.BuildClaimsFunc[T]) *Verifier[T] {
+	v := &Verifier[T]{
+		claimsBuilder: f,
+		keys:          make([]*key, 0, 10),
+		validator:     xjwt.NewValidator(),
+	}
+	v.v = jwt.NewVerifierWith("paseto", b, v.parse)
+	return v
+}
+
+// SetExtractors 指定提取令牌的方式
+//
+// 参考 [jwt.Verifier.SetExtractors]。
+func (v *Verifier[T]) SetExtractors(e ...jwt.Extractor) { v.v.SetExtractors(e...) }
+
+// SetSink 指定接收验证相关事件的对象
+//
+// sink 可以为空，表示不发送事件。
+func (v *Verifier[T]) SetSink(sink auth.Sink) { v.v.SetSink(sink) }
+
+// Logout 退出登录
+//
+// 会拉黑当前请求所使用的令牌。
+func (v *Verifier[T]) Logout(ctx *web.Context) error { return v.v.Logout(ctx) }
+
+// VerifyRefresh 验证刷新令牌
+//
+// NOTE: 此操作会让现有的令牌和刷新令牌都失效。
+func (v *Verifier[T]) VerifyRefresh(next web.HandlerFunc) web.HandlerFunc {
+	return v.v.VerifyRefresh(next)
+}
+
+// Middleware 解码用户的令牌并写入 [web.Context]
+func (v *Verifier[T]) Middleware(next web.HandlerFunc) web.HandlerFunc { return v.v.Middleware(next) }
+
+func (v *Verifier[T]) GetInfo(ctx *web.Context) (T, bool) { return v.v.GetInfo(ctx) }
+
+// 验证令牌并返回其中的 claims
+func (v *Verifier[T]) parse(token string) (T, error) {
+	var zero T
+
+	f, ok := peekFooter(token)
+	if !ok || len(f) > maxFooterSize {
+		return zero, ErrInvalidToken()
+	}
+
+	var ft footer
+	if err := json.Unmarshal(f, &ft); err != nil || ft.Kid == "" {
+		return zero, ErrInvalidToken()
+	}
+
+	k := v.findKey(ft.Kid)
+	if k == nil {
+		return zero, ErrKeyNotFound()
+	}
+
+	var m []byte
+	switch {
+	case k.local != nil && strings.HasPrefix(token, headerLocal):
+		m, ok = decryptLocal(k.local, token, nil)
+	case k.public != nil && strings.HasPrefix(token, headerPublic):
+		m, ok = verifyPublic(k.public, token, nil)
+	default: // 密钥与令牌的类型不匹配
+		ok = false
+	}
+	if !ok {
+		return zero, ErrInvalidToken()
+	}
+
+	claims := v.claimsBuilder()
+	if err := json.Unmarshal(m, claims); err != nil {
+		return zero, err
+	}
+	if err := v.validator.Validate(claims); err != nil {
+		return zero, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier[T]) findKey(id string) *key {
+	v.keysMux.RLock()
+	defer v.keysMux.RUnlock()
+
+	if index := slices.IndexFunc(v.keys, func(e *key) bool { return e.id == id }); index >= 0 {
+		return v.keys[index]
+	}
+	return nil
+}
+
+func (v *Verifier[T]) addKey(k *key) {
+	v.keysMux.Lock()
+	defer v.keysMux.Unlock()
+
+	if slices.IndexFunc(v.keys, func(e *key) bool { return e.id == k.id }) >= 0 {
+		panic(fmt.Sprintf("存在同名的密钥 %s", k.id))
+	}
+	v.keys = append(v.keys, k)
+}
+
+// AddPublic 添加 v4.public 的公钥
+func (v *Verifier[T]) AddPublic(id string, pub ed25519.PublicKey) {
+	if len(pub) != ed25519.PublicKeySize {
+		panic(fmt.Sprintf("参数 pub 的长度必须为 %d", ed25519.PublicKeySize))
+	}
+	v.addKey(&key{id: id, public: pub})
+}
+
+// AddLocal 添加 v4.local 的密钥
+//
+// key 的长度必须为 [LocalKeySize]。
+func (v *Verifier[T]) AddLocal(id string, key []byte) { v.addKey(newLocalKey(id, key)) }
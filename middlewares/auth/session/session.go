@@ -17,6 +17,7 @@ import (
 	"github.com/issue9/web"
 
 	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/middlewares/auth"
 )
 
 var errSessionIDNotExists = web.NewLocaleError("session id not exists in context")
@@ -34,6 +35,8 @@ type Session[T any] struct {
 	lifetime           int
 	name, path, domain string
 	secure, httpOnly   bool
+
+	sink auth.Sink
 }
 
 func ErrSessionIDNotExists() error { return errSessionIDNotExists }
@@ -58,6 +61,11 @@ func New[T any](s web.Server, store Store[T], lifetime int, name, path, domain s
 	}
 }
 
+// SetSink 指定接收验证相关事件的对象
+//
+// sink 可以为空，表示不发送事件。
+func (s *Session[T]) SetSink(sink auth.Sink) { s.sink = sink }
+
 func (s *Session[T]) Middleware(next web.HandlerFunc) web.HandlerFunc {
 	return func(ctx *web.Context) web.Responser {
 		c, err := ctx.Request().Cookie(s.name)
@@ -68,14 +76,7 @@ func (s *Session[T]) Middleware(next web.HandlerFunc) web.HandlerFunc {
 		var id string
 		if c == nil {
 			id = s.rands.String()
-			c = &http.Cookie{
-				Name:     s.name,
-				Path:     s.path,
-				Domain:   s.domain,
-				Secure:   s.secure,
-				HttpOnly: s.httpOnly,
-				Value:    url.QueryEscape(id),
-			}
+			c = s.newCookie(id)
 		} else {
 			id, err = url.QueryUnescape(c.Value)
 			if err != nil {
@@ -104,18 +105,55 @@ func (s *Session[T]) Middleware(next web.HandlerFunc) web.HandlerFunc {
 			}
 		}
 
-		mauth.Set(ctx, v)
+		mauth.Set(ctx, s, v)
 
 		return next(ctx)
 	}
 }
 
+func (s *Session[T]) newCookie(id string) *http.Cookie {
+	return &http.Cookie{
+		Name:     s.name,
+		Path:     s.path,
+		Domain:   s.domain,
+		Secure:   s.secure,
+		HttpOnly: s.httpOnly,
+		Value:    url.QueryEscape(id),
+	}
+}
+
+// Regenerate 为当前请求生成新的 session id
+//
+// 旧的 session 会被删除，一般在登录成功之后、保存用户数据之前调用，以防止会话固定攻击。
+func (s *Session[T]) Regenerate(ctx *web.Context) error {
+	old, err := s.GetSessionID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.Delete(old); err != nil {
+		return err
+	}
+
+	id := s.rands.String()
+	c := s.newCookie(id)
+	c.MaxAge = s.lifetime
+	c.Expires = ctx.Begin().Add(time.Second * time.Duration(s.lifetime))
+	ctx.SetCookies(c)
+	ctx.SetVar(idKey, id)
+	return nil
+}
+
 // Logout 退出登录
 func (s *Session[T]) Logout(ctx *web.Context) error {
 	id, err := s.GetSessionID(ctx)
 	if err == nil {
 		err = s.Delete(id)
 	}
+
+	if err == nil {
+		v, _ := s.GetInfo(ctx)
+		auth.Emit(ctx, s.sink, &auth.Event{Type: auth.EventLogout, Source: "session", Info: v})
+	}
 	return err
 }
 
@@ -132,7 +170,7 @@ func (s *Session[T]) GetSessionID(ctx *web.Context) (string, error) {
 
 // Save 保存 val
 func (s *Session[T]) Save(ctx *web.Context, val T) error {
-	mauth.Set(ctx, val)
+	mauth.Set(ctx, s, val)
 	id, err := s.GetSessionID(ctx)
 	if err != nil {
 		return err
@@ -140,4 +178,15 @@ func (s *Session[T]) Save(ctx *web.Context, val T) error {
 	return s.store.Set(id, val)
 }
 
-func (s *Session[T]) GetInfo(ctx *web.Context) (T, bool) { return mauth.Get[T](ctx) }
+// Login 登录成功之后保存用户数据 val
+//
+// 与 [Session.Save] 相同，但是会发送 [auth.EventSuccess] 事件。
+func (s *Session[T]) Login(ctx *web.Context, val T) error {
+	if err := s.Save(ctx, val); err != nil {
+		return err
+	}
+	auth.Emit(ctx, s.sink, &auth.Event{Type: auth.EventSuccess, Source: "session", Info: val})
+	return nil
+}
+
+func (s *Session[T]) GetInfo(ctx *web.Context) (T, bool) { return mauth.Get[T](ctx, s) }
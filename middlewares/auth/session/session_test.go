@@ -31,8 +31,10 @@ func TestSession(t *testing.T) {
 	store := NewCacheStore[*data](srv.Cache(), 500*time.Microsecond)
 	a.NotNil(store)
 
+	events := make([]*auth.Event, 0, 10)
 	session := New(srv, store, 60, "sesson_id", "/", "localhost", false, false)
 	a.NotNil(session)
+	session.SetSink(auth.SinkFunc(func(e *auth.Event) { events = append(events, e) }))
 
 	srv.Routers().Use(session)
 	r := srv.Routers().New("default", nil)
@@ -54,6 +56,13 @@ func TestSession(t *testing.T) {
 		return web.OK(nil)
 	})
 
+	r.Post("/login", func(ctx *web.Context) web.Responser {
+		v, found := session.GetInfo(ctx)
+		a.True(found)
+		a.NotError(session.Login(ctx, v))
+		return web.NoContent()
+	})
+
 	r.Delete("/get1", func(ctx *web.Context) web.Responser {
 		if err := session.Logout(ctx); err != nil {
 			return ctx.Error(err, web.ProblemInternalServerError)
@@ -78,6 +87,14 @@ func TestSession(t *testing.T) {
 		Status(http.StatusOK).
 		Resp()
 
+	// 登录
+	cookie = resp.Cookies()[0]
+	resp = servertest.Post(a, "http://localhost:8080/login", nil).
+		Cookie(cookie).
+		Do(nil).
+		Status(http.StatusNoContent).
+		Resp()
+
 	// 第三次访问
 	cookie = resp.Cookies()[0]
 	resp = servertest.Get(a, "http://localhost:8080/get1?count=2&id=").
@@ -94,6 +111,13 @@ func TestSession(t *testing.T) {
 		Status(http.StatusNoContent).
 		Resp()
 
+	// 仅 Login 发送登录成功的事件
+	a.Length(events, 2).
+		Equal(events[0].Type, auth.EventSuccess).
+		Equal(events[0].Source, "session").
+		Equal(events[0].Info, &data{Count: 2}).
+		Equal(events[1].Type, auth.EventLogout)
+
 	// cookie 已经被删除
 	servertest.Get(a, "http://localhost:8080/get1?count=0&id=").
 		Cookie(cookie).
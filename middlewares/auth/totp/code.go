@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits 验证码的位数
+	Digits = 6
+
+	// Period 验证码的有效周期
+	Period = 30 * time.Second
+
+	secretSize = 20 // 与 SHA1 的输出长度相同，RFC4226 推荐的长度。
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret 生成新的密钥
+//
+// 返回值为 base32 编码的内容，可直接用于 [URI]。
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(b), nil
+}
+
+// URI 生成 otpauth 格式的地址
+//
+// 返回内容即为二维码的内容，大部分验证器应用可通过扫描该二维码添加账号。
+//
+// issuer 为服务提供方的名称；account 为用户账号；secret 为 [GenerateSecret] 生成的密钥；
+//
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func URI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(Digits))
+	q.Set("period", strconv.Itoa(int(Period.Seconds())))
+
+	u := &url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// Code 生成 t 时刻的验证码
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, step(t)), nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return secretEncoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+func step(t time.Time) uint64 { return uint64(t.Unix()) / uint64(Period.Seconds()) }
+
+// https://datatracker.ietf.org/doc/html/rfc4226#section-5.3
+func hotp(key []byte, counter uint64) string {
+	h := hmac.New(sha1.New, key)
+	_ = binary.Write(h, binary.BigEndian, counter)
+	sum := h.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range Digits {
+		mod *= 10
+	}
+
+	code := strconv.FormatUint(uint64(v%mod), 10)
+	return strings.Repeat("0", Digits-len(code)) + code
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestCode(t *testing.T) {
+	a := assert.New(t, false)
+
+	// https://datatracker.ietf.org/doc/html/rfc6238#appendix-B
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	data := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, code := range data {
+		c, err := Code(secret, time.Unix(unix, 0))
+		a.NotError(err).Equal(c, code, "%d", unix)
+	}
+
+	c, err := Code("1", time.Now())
+	a.Error(err).Empty(c)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a := assert.New(t, false)
+
+	s1, err := GenerateSecret()
+	a.NotError(err).Length(s1, 32)
+	s2, err := GenerateSecret()
+	a.NotError(err).NotEqual(s1, s2)
+
+	key, err := decodeSecret(s1)
+	a.NotError(err).Length(key, secretSize)
+}
+
+func TestURI(t *testing.T) {
+	a := assert.New(t, false)
+
+	u, err := url.Parse(URI("Example Co", "alice@example.com", "JBSWY3DPEHPK3PXP"))
+	a.NotError(err).
+		Equal(u.Scheme, "otpauth").
+		Equal(u.Host, "totp").
+		Equal(u.Path, "/Example Co:alice@example.com")
+
+	q := u.Query()
+	a.Equal(q.Get("secret"), "JBSWY3DPEHPK3PXP").
+		Equal(q.Get("issuer"), "Example Co").
+		Equal(q.Get("digits"), "6").
+		Equal(q.Get("period"), "30")
+}
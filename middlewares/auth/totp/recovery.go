@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// GenerateRecoveryCodes 生成 n 个恢复码
+//
+// 恢复码用于在无法使用验证器时代替验证码，每个恢复码只能使用一次。
+// codes 用于展示给用户；hashes 为对应的哈希值，由调用方保存。
+func GenerateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	codes = make([]string, 0, n)
+	hashes = make([]string, 0, n)
+
+	b := make([]byte, 10*n) // 每个恢复码 80 位
+	if _, err = rand.Read(b); err != nil {
+		return nil, nil, err
+	}
+
+	for i := range n {
+		s := recoveryEncoding.EncodeToString(b[i*10 : i*10+10])
+		codes = append(codes, s[:8]+"-"+s[8:])
+		hashes = append(hashes, hashRecoveryCode(s))
+	}
+	return codes, hashes, nil
+}
+
+// VerifyRecoveryCode 验证恢复码
+//
+// hashes 为 [GenerateRecoveryCodes] 返回的哈希值列表。
+// 返回匹配项在 hashes 中的下标，找不到时返回 -1。
+// 验证成功之后，调用方需要将该项从保存的列表中删除，保证其只能使用一次。
+func VerifyRecoveryCode(code string, hashes []string) int {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	h := []byte(hashRecoveryCode(code))
+
+	index := -1
+	for i, hash := range hashes { // 遍历所有元素，不提前退出。
+		if subtle.ConstantTimeCompare(h, []byte(hash)) == 1 {
+			index = i
+		}
+	}
+	return index
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package totp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	a := assert.New(t, false)
+
+	codes, hashes, err := GenerateRecoveryCodes(10)
+	a.NotError(err).Length(codes, 10).Length(hashes, 10)
+	for i, code := range codes {
+		a.Length(code, 17).
+			NotEqual(code, hashes[i]).
+			Equal(VerifyRecoveryCode(code, hashes), i)
+	}
+
+	// 大小写和分隔符
+	a.Equal(VerifyRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[3], "-", " ")), hashes), 3)
+
+	a.Equal(VerifyRecoveryCode("not-exists", hashes), -1).
+		Equal(VerifyRecoveryCode(codes[0], hashes[1:]), -1)
+}
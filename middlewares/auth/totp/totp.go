@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package totp 基于 [TOTP] 的二次验证
+//
+//	t := totp.New(srv, "example", 1, sess, func(u *User) time.Time { return u.TOTPVerifiedAt })
+//
+//	// 验证用户提交的验证码，成功之后由调用方在用户信息中记录验证时间。
+//	r.Post("/totp", sess.Middleware(func(ctx *web.Context) web.Responser {
+//	    ok, err := t.Verify(account, secret, code, ctx.Begin())
+//	    ...
+//	}))
+//
+//	// 敏感操作需要在 10 分钟内进行过二次验证
+//	r.Delete("/account", sess.Middleware(t.Require(10*time.Minute).Middleware(...)))
+//
+// [TOTP]: https://datatracker.ietf.org/doc/html/rfc6238
+package totp
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth"
+)
+
+// ProblemSecondFactorRequired 表示需要进行二次验证的问题类型
+//
+// 由 [TOTP.Require] 返回，状态码为 403。
+const ProblemSecondFactorRequired = "second-factor-required"
+
+type (
+	// TOTP 二次验证管理
+	//
+	// T 为 [auth.Auth] 中保存的用户信息类型。
+	TOTP[T any] struct {
+		issuer string
+		window int
+		cache  web.Cache
+		fresh  *auth.Fresh[T]
+	}
+
+	// VerifiedAtFunc 从用户信息中获取最近一次通过二次验证的时间
+	//
+	// 如果从未验证过，应该返回零值。
+	VerifiedAtFunc[T any] func(T) time.Time
+)
+
+// New 声明 [TOTP] 对象
+//
+// issuer 为服务提供方的名称，会显示在验证器应用中；
+// window 表示验证时允许前后偏移的周期数，用于处理客户端与服务端的时间误差，一般为 1；
+// a 为用户的登录验证，[TOTP.Require] 从中获取用户信息；
+// f 从用户信息中获取最近一次二次验证的时间；
+//
+// NOTE: 同一个 [web.Server] 只能调用一次，该函数会向 s 注册 [ProblemSecondFactorRequired]。
+func New[T any](s web.Server, issuer string, window int, a auth.Auth[T], f VerifiedAtFunc[T]) *TOTP[T] {
+	if window < 0 {
+		panic("参数 window 不能小于 0")
+	}
+	fresh := auth.NewFreshWithProblem(a, auth.AuthTimeFunc[T](f), ProblemSecondFactorRequired)
+
+	s.Problems().Add(http.StatusForbidden, &web.LocaleProblem{
+		ID:     ProblemSecondFactorRequired,
+		Title:  web.Phrase("second factor required"),
+		Detail: web.Phrase("the operation requires a recent second factor verification"),
+	})
+
+	return &TOTP[T]{
+		issuer: issuer,
+		window: window,
+		cache:  web.NewCache("totp_", s.Cache()),
+		fresh:  fresh,
+	}
+}
+
+// URI 生成 otpauth 格式的地址
+//
+// 参考 [URI]。
+func (t *TOTP[T]) URI(account, secret string) string { return URI(t.issuer, account, secret) }
+
+// Verify 验证 now 时刻用户提交的验证码
+//
+// account 为用户的唯一标记，用于防止同一验证码被重复使用；
+// secret 为用户的密钥；
+// code 为用户提交的验证码；
+//
+// 验证成功之后，调用方需要在用户信息中记录验证的时间，以供 [TOTP.Require] 使用。
+func (t *TOTP[T]) Verify(account, secret, code string, now time.Time) (bool, error) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != Digits {
+		return false, nil
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return false, err
+	}
+
+	curr := step(now)
+	for i := -t.window; i <= t.window; i++ {
+		s := curr + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(key, s)), []byte(code)) != 1 {
+			continue
+		}
+
+		// 同一周期的验证码只能使用一次，计数器的操作是原子的，可以防止并发的重复提交。
+		ttl := Period * time.Duration(2*t.window+1)
+		n, err := t.cache.Counter(account+"_"+strconv.FormatUint(s, 10), 0, ttl).Incr(1)
+		if err != nil {
+			return false, err
+		}
+		return n == 1, nil
+	}
+
+	return false, nil
+}
+
+// Require 要求用户在 maxAge 时间内进行过二次验证
+//
+// 返回的中间件需要在 [auth.Auth] 的中间件之后执行。
+// 未登录时返回 401，未进行二次验证或已经超时则返回 [ProblemSecondFactorRequired]。
+// maxAge 必须大于 0，具体的行为与 [auth.Fresh.Require] 相同。
+func (t *TOTP[T]) Require(maxAge time.Duration) web.Middleware { return t.fresh.Require(maxAge) }
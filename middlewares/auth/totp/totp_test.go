@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package totp
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/mauth"
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth"
+	"github.com/issue9/webuse/v7/middlewares/auth/basic"
+)
+
+type user struct {
+	name       string
+	verifiedAt time.Time
+}
+
+func newTOTP(a *assert.Assertion) (web.Server, auth.Auth[*user], *TOTP[*user]) {
+	s := testserver.New(a)
+	a.NotError(s.Cache().Clean())
+
+	b := basic.New(s, func(username, password []byte) (*user, bool) {
+		u := &user{name: string(username)}
+		switch u.name {
+		case "recent":
+			u.verifiedAt = time.Now()
+		case "expired":
+			u.verifiedAt = time.Now().Add(-time.Hour)
+		}
+		return u, true
+	}, "example.com", false)
+
+	return s, b, New(s, "example", 1, b, func(u *user) time.Time { return u.verifiedAt })
+}
+
+func TestTOTP_Verify(t *testing.T) {
+	a := assert.New(t, false)
+	_, _, totp := newTOTP(a)
+
+	secret, err := GenerateSecret()
+	a.NotError(err)
+	now := time.Now()
+
+	code, err := Code(secret, now)
+	a.NotError(err)
+	ok, err := totp.Verify("u1", secret, code, now)
+	a.NotError(err).True(ok)
+
+	// 重复使用
+	ok, err = totp.Verify("u1", secret, code, now)
+	a.NotError(err).False(ok)
+
+	// 不同的用户不受影响
+	ok, err = totp.Verify("u2", secret, code, now)
+	a.NotError(err).True(ok)
+
+	// 在 window 范围之内
+	code, err = Code(secret, now.Add(-Period))
+	a.NotError(err)
+	ok, err = totp.Verify("u1", secret, code, now)
+	a.NotError(err).True(ok)
+
+	// 超出 window 范围
+	code, err = Code(secret, now.Add(-3*Period))
+	a.NotError(err)
+	ok, err = totp.Verify("u3", secret, code, now)
+	a.NotError(err).False(ok)
+
+	ok, err = totp.Verify("u3", secret, "12345", now)
+	a.NotError(err).False(ok)
+
+	ok, err = totp.Verify("u3", "1", "123456", now)
+	a.Error(err).False(ok)
+
+	a.Equal(totp.URI("u1", secret), URI("example", "u1", secret))
+}
+
+func TestTOTP_Require(t *testing.T) {
+	a := assert.New(t, false)
+	s, b, totp := newTOTP(a)
+	verifiedAt := func(u *user) time.Time { return u.verifiedAt }
+
+	a.PanicString(func() {
+		New(s, "example", -1, b, verifiedAt)
+	}, "参数 window 不能小于 0")
+	a.PanicString(func() {
+		New(s, "example", 1, nil, verifiedAt)
+	}, "参数 a 不能为空")
+	a.PanicString(func() {
+		New(s, "example", 1, b, nil)
+	}, "参数 f 不能为空")
+	a.PanicString(func() {
+		totp.Require(0)
+	}, "参数 maxAge 必须大于 0")
+
+	r := s.Routers().New("def", nil)
+	r.Delete("/account", b.Middleware(totp.Require(10*time.Minute).Middleware(func(*web.Context) web.Responser {
+		return web.NoContent()
+	})))
+
+	defer servertest.Run(a, s)()
+	defer s.Close(0)
+
+	servertest.Delete(a, "http://localhost:8080/account").
+		Header(mauth.AuthorizationHeader, "Basic cmVjZW50OjEyMw=="). // recent:123
+		Do(nil).
+		Status(http.StatusNoContent)
+
+	servertest.Delete(a, "http://localhost:8080/account").
+		Header(mauth.AuthorizationHeader, "Basic ZXhwaXJlZDoxMjM="). // expired:123
+		Do(nil).
+		Status(http.StatusForbidden).
+		Header("WWW-Authenticate", "").
+		BodyFunc(func(a *assert.Assertion, body []byte) {
+			a.Contains(string(body), ProblemSecondFactorRequired)
+		})
+
+	servertest.Delete(a, "http://localhost:8080/account").
+		Header(mauth.AuthorizationHeader, "Basic bmV2ZXI6MTIz"). // never:123
+		Do(nil).
+		Status(http.StatusForbidden)
+}
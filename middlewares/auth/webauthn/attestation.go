@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+
+	"github.com/issue9/web"
+)
+
+// authenticatorData 中的标志位
+//
+// https://www.w3.org/TR/webauthn-3/#sctn-authenticator-data
+const (
+	flagUP = 1 << 0 // 用户在场
+	flagUV = 1 << 2 // 用户已验证
+	flagAT = 1 << 6 // 包含凭证数据
+	flagED = 1 << 7 // 包含扩展数据
+)
+
+// 解析后的 authenticatorData
+type authData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// 以下仅在注册时存在
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte // COSE 格式的公钥
+}
+
+func parseAuthData(data []byte) (*authData, error) {
+	if len(data) < 37 {
+		return nil, web.NewLocaleError("invalid authenticator data")
+	}
+
+	ad := &authData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if ad.flags&flagAT != 0 {
+		if len(rest) < 18 {
+			return nil, web.NewLocaleError("invalid authenticator data")
+		}
+		ad.aaguid = rest[:16]
+		l := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if l == 0 || l > 1023 || len(rest) < l {
+			return nil, web.NewLocaleError("invalid authenticator data")
+		}
+		ad.credentialID = rest[:l]
+		rest = rest[l:]
+
+		_, r, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		ad.publicKey = rest[:len(rest)-len(r)]
+		rest = r
+	}
+
+	if ad.flags&flagED != 0 {
+		_, r, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = r
+	}
+
+	if len(rest) > 0 {
+		return nil, web.NewLocaleError("invalid authenticator data")
+	}
+	return ad, nil
+}
+
+// 验证 rpID 的哈希以及用户是否在场和已验证
+func (ad *authData) check(rpID string, uv bool) error {
+	sum := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(sum[:], ad.rpIDHash) {
+		return web.NewLocaleError("webauthn rp id hash not match")
+	}
+	if ad.flags&flagUP == 0 {
+		return web.NewLocaleError("webauthn user not present")
+	}
+	if uv && ad.flags&flagUV == 0 {
+		return web.NewLocaleError("webauthn user not verified")
+	}
+	return nil
+}
+
+// 解析 attestationObject 并验证其签名
+//
+// 仅支持 none 和 packed 两种格式，packed 格式中的证书链不作验证。
+// 返回值为其中的 authenticatorData。
+//
+// https://www.w3.org/TR/webauthn-3/#sctn-defined-attestation-formats
+func parseAttestation(data, clientDataHash []byte) (*authData, string, error) {
+	v, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, "", err
+	}
+	obj, ok := v.(map[any]any)
+	if !ok || len(rest) > 0 {
+		return nil, "", errInvalidCBOR
+	}
+
+	format, _ := obj["fmt"].(string)
+	stmt, _ := obj["attStmt"].(map[any]any)
+	raw, _ := obj["authData"].([]byte)
+
+	ad, err := parseAuthData(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	if ad.flags&flagAT == 0 {
+		return nil, "", web.NewLocaleError("invalid authenticator data")
+	}
+
+	switch format {
+	case "none":
+		if len(stmt) > 0 {
+			return nil, "", web.NewLocaleError("invalid webauthn attestation statement")
+		}
+	case "packed":
+		if err := verifyPacked(stmt, ad, append(raw[:len(raw):len(raw)], clientDataHash...)); err != nil {
+			return nil, "", err
+		}
+	default:
+		return nil, "", web.NewLocaleError("unsupported webauthn attestation format %s", format)
+	}
+
+	return ad, format, nil
+}
+
+// https://www.w3.org/TR/webauthn-3/#sctn-packed-attestation
+func verifyPacked(stmt map[any]any, ad *authData, signed []byte) error {
+	alg, _ := stmt["alg"].(int64)
+	sig, _ := stmt["sig"].([]byte)
+	if len(sig) == 0 {
+		return web.NewLocaleError("invalid webauthn attestation statement")
+	}
+
+	x5c, _ := stmt["x5c"].([]any)
+	if len(x5c) == 0 { // 自签名，采用凭证本身的私钥签名。
+		pub, err := parsePublicKey(ad.publicKey)
+		if err != nil {
+			return err
+		}
+		if pub.alg != alg || !pub.verify(signed, sig) {
+			return web.NewLocaleError("invalid webauthn attestation signature")
+		}
+		return nil
+	}
+
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	var sa x509.SignatureAlgorithm
+	switch alg {
+	case AlgES256:
+		sa = x509.ECDSAWithSHA256
+	case AlgRS256:
+		sa = x509.SHA256WithRSA
+	case AlgEdDSA:
+		sa = x509.PureEd25519
+	default:
+		return web.NewLocaleError("unsupported cose algorithm %d", alg)
+	}
+	if err := cert.CheckSignature(sa, signed, sig); err != nil {
+		return web.NewLocaleError("invalid webauthn attestation signature")
+	}
+	return nil
+}
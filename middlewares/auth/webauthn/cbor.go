@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package webauthn
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/issue9/web"
+)
+
+// 最大嵌套层级，防止恶意数据。
+const cborMaxDepth = 16
+
+var errInvalidCBOR = web.NewLocaleError("invalid cbor data")
+
+// 解码 CBOR 数据
+//
+// 仅支持 WebAuthn 用到的类型，返回值的类型可能是：
+// int64、[]byte、string、[]any、map[any]any、bool 和 nil。
+// rest 为解码之后剩余的数据。
+//
+// https://datatracker.ietf.org/doc/html/rfc8949
+func decodeCBOR(data []byte) (v any, rest []byte, err error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > cborMaxDepth || len(data) == 0 {
+		return nil, nil, errInvalidCBOR
+	}
+
+	major := data[0] >> 5
+	if major == 7 { // 简单类型
+		switch data[0] & 0x1f {
+		case 20:
+			return false, data[1:], nil
+		case 21:
+			return true, data[1:], nil
+		case 22:
+			return nil, data[1:], nil
+		default:
+			return nil, nil, errInvalidCBOR
+		}
+	}
+
+	arg, data, err := decodeCBORArg(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, errInvalidCBOR
+		}
+		return int64(arg), data, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, errInvalidCBOR
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, errInvalidCBOR
+		}
+		if major == 2 {
+			return data[:arg], data[arg:], nil
+		}
+		return string(data[:arg]), data[arg:], nil
+	case 4:
+		if arg > uint64(len(data)) { // 每个元素至少占一个字节
+			return nil, nil, errInvalidCBOR
+		}
+		items := make([]any, 0, arg)
+		for range arg {
+			var item any
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, errInvalidCBOR
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			var key, val any
+			if key, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default: // 其它类型无法作为 map 的键名
+				return nil, nil, errInvalidCBOR
+			}
+
+			if val, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[key] = val
+		}
+		return m, data, nil
+	default: // 不支持 tag 和不定长的数据
+		return nil, nil, errInvalidCBOR
+	}
+}
+
+func decodeCBORArg(data []byte) (uint64, []byte, error) {
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, errInvalidCBOR
+	}
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package webauthn
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+// 编码 CBOR，仅用于测试。
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		case n <= 0xffffffff:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		default:
+			return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+		}
+	}
+
+	switch val := v.(type) {
+	case int:
+		return encodeCBOR(int64(val))
+	case int64:
+		if val < 0 {
+			return head(1, uint64(-1-val))
+		}
+		return head(0, uint64(val))
+	case []byte:
+		return append(head(2, uint64(len(val))), val...)
+	case string:
+		return append(head(3, uint64(len(val))), val...)
+	case []any:
+		data := head(4, uint64(len(val)))
+		for _, item := range val {
+			data = append(data, encodeCBOR(item)...)
+		}
+		return data
+	case map[any]any:
+		data := head(5, uint64(len(val)))
+		for k, item := range val {
+			data = append(data, encodeCBOR(k)...)
+			data = append(data, encodeCBOR(item)...)
+		}
+		return data
+	case bool:
+		if val {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	default:
+		panic("不支持的类型")
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	a := assert.New(t, false)
+
+	v, rest, err := decodeCBOR(encodeCBOR(map[any]any{
+		"fmt": "none",
+		1:     2,
+		-3:    []byte{1, 2, 3},
+		"arr": []any{int64(500), int64(-70000), true, false, nil, "str"},
+	}))
+	a.NotError(err).Empty(rest).Equal(v, map[any]any{
+		"fmt":     "none",
+		int64(1):  int64(2),
+		int64(-3): []byte{1, 2, 3},
+		"arr":     []any{int64(500), int64(-70000), true, false, nil, "str"},
+	})
+
+	// 剩余数据
+	data := append(encodeCBOR("abc"), 0x01)
+	v, rest, err = decodeCBOR(data)
+	a.NotError(err).Equal(v, "abc").Equal(rest, []byte{0x01})
+
+	// 数据不完整
+	_, _, err = decodeCBOR([]byte{0x43, 1, 2})
+	a.Equal(err, errInvalidCBOR)
+
+	_, _, err = decodeCBOR(nil)
+	a.Equal(err, errInvalidCBOR)
+
+	// 不定长
+	_, _, err = decodeCBOR([]byte{0x5f, 0x41, 0x01, 0xff})
+	a.Equal(err, errInvalidCBOR)
+
+	// 长度过大
+	_, _, err = decodeCBOR([]byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	a.Equal(err, errInvalidCBOR)
+
+	// 不支持的键名类型
+	_, _, err = decodeCBOR(encodeCBOR(map[any]any{true: 1}))
+	a.Equal(err, errInvalidCBOR)
+
+	// 嵌套过深
+	var deep any = int64(1)
+	for range cborMaxDepth + 2 {
+		deep = []any{deep}
+	}
+	_, _, err = decodeCBOR(encodeCBOR(deep))
+	a.Equal(err, errInvalidCBOR)
+}
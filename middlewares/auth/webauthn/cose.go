@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/issue9/web"
+)
+
+// 支持的 COSE 算法
+//
+// https://www.iana.org/assignments/cose/cose.xhtml#algorithms
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE 密钥的参数
+//
+// https://datatracker.ietf.org/doc/html/rfc9053#section-7
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// 默认支持的算法，按优先级排列。
+var supportedAlgs = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// 由 COSE 格式的公钥生成的验证对象
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// 解析 COSE 格式的公钥
+func parsePublicKey(data []byte) (*publicKey, error) {
+	v, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errInvalidCBOR
+	}
+	return parseCOSEKey(v)
+}
+
+func parseCOSEKey(v any) (*publicKey, error) {
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, web.NewLocaleError("invalid cose key")
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, web.NewLocaleError("invalid cose key")
+		}
+
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := pub.ECDH(); err != nil { // 验证点是否在曲线上
+			return nil, err
+		}
+		return &publicKey{alg: alg, key: pub}, nil
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 { // 至少 2048 位
+			return nil, web.NewLocaleError("invalid cose key")
+		}
+
+		var exp int
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, web.NewLocaleError("invalid cose key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	default:
+		return nil, web.NewLocaleError("unsupported cose algorithm %d", alg)
+	}
+}
+
+// 验证签名
+func (k *publicKey) verify(data, sig []byte) bool {
+	switch k.alg {
+	case AlgES256:
+		sum := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(k.key.(*ecdsa.PublicKey), sum[:], sig)
+	case AlgRS256:
+		sum := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(k.key.(*rsa.PublicKey), crypto.SHA256, sum[:], sig) == nil
+	case AlgEdDSA:
+		return ed25519.Verify(k.key.(ed25519.PublicKey), data, sig)
+	default:
+		return false
+	}
+}
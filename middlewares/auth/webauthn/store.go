@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package webauthn
+
+import "time"
+
+type (
+	// Credential 用户注册的凭证
+	Credential struct {
+		ID        []byte    // 凭证 ID
+		UserID    []byte    // 所属用户的 ID，即 [User.ID]
+		PublicKey []byte    // COSE 格式的公钥
+		SignCount uint32    // 签名计数器
+		AAGUID    []byte    // 验证器的型号
+		Format    string    // 注册时的证明格式
+		Created   time.Time // 注册时间
+	}
+
+	// User 注册凭证时的用户信息
+	User struct {
+		// 用户的唯一 ID
+		//
+		// 不应该包含用户的个人信息，最长 64 字节。
+		ID []byte
+
+		Name        string // 用户名，比如邮箱地址
+		DisplayName string // 显示的名称
+	}
+
+	// Store 凭证的存储接口
+	Store interface {
+		// Add 添加凭证
+		//
+		// 如果凭证 ID 已经存在，应该返回错误。
+		Add(*Credential) error
+
+		// Get 根据凭证 ID 获取凭证
+		//
+		// 如果不存在，应该返回 false。
+		Get(id []byte) (*Credential, bool, error)
+
+		// List 获取用户的所有凭证
+		List(userID []byte) ([]*Credential, error)
+
+		// UpdateSignCount 更新凭证的签名计数器
+		UpdateSignCount(id []byte, count uint32) error
+	}
+)
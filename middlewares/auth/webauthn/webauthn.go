@@ -0,0 +1,464 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package webauthn [WebAuthn] 依赖方（Relying Party）的实现
+//
+// 提供了通行密钥的注册和登录，挑战值与 [session.Session] 绑定，登录成功之后将用户信息写入 session：
+//
+//	sess := session.New(...)
+//	w := webauthn.New(srv, sess, store, "example.com", "Example", []string{"https://example.com"}, false, getUser, build)
+//
+//	srv.Routers().Use(sess)
+//	r.Post("/webauthn/register/begin", w.BeginRegistration)
+//	r.Post("/webauthn/register/finish", w.FinishRegistration)
+//	r.Post("/webauthn/login/begin", w.BeginLogin)
+//	r.Post("/webauthn/login/finish", w.FinishLogin)
+//
+// 客户端提交的数据采用 PublicKeyCredential.toJSON() 的格式，即二进制数据采用无填充的 base64url 编码。
+//
+// [WebAuthn]: https://www.w3.org/TR/webauthn-3/
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/issue9/web"
+
+	"github.com/issue9/webuse/v7/middlewares/auth/session"
+)
+
+const (
+	ceremonyTimeout = 5 * time.Minute // 从发起请求到完成验证的最长时间
+	challengeSize   = 32              // 挑战值的字节数
+)
+
+type (
+	// WebAuthn 通行密钥的注册和登录管理
+	//
+	// T 为保存在 [session.Session] 中的用户数据类型。
+	WebAuthn[T any] struct {
+		session *session.Session[T]
+		store   Store
+		cache   web.Cache
+		getUser GetUserFunc
+		build   BuildInfoFunc[T]
+
+		rpID, rpName string
+		origins      []string
+		uv           bool
+	}
+
+	// GetUserFunc 获取当前需要注册凭证的用户
+	//
+	// 如果返回的 [web.Responser] 不为空，则表示拒绝注册，直接将其返回给客户端。
+	GetUserFunc func(*web.Context) (*User, web.Responser)
+
+	// BuildInfoFunc 根据登录成功的凭证生成保存在 session 中的用户数据
+	//
+	// 如果返回的 [web.Responser] 不为空，则表示拒绝该用户登录，直接将其返回给客户端。
+	BuildInfoFunc[T any] func(*web.Context, *Credential) (T, web.Responser)
+
+	// Bytes 以无填充的 base64url 编码进行 JSON 序列化的二进制数据
+	Bytes []byte
+
+	// 发起请求时保存的数据，以 session ID 为键名保存在缓存中。
+	ceremony struct {
+		Challenge []byte
+		UserID    []byte
+	}
+
+	clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+
+	rpEntity struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	userEntity struct {
+		ID          Bytes  `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	}
+
+	credentialParameter struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	}
+
+	credentialDescriptor struct {
+		Type string `json:"type"`
+		ID   Bytes  `json:"id"`
+	}
+
+	authenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	}
+
+	creationOptions struct {
+		Challenge              Bytes                   `json:"challenge"`
+		RP                     *rpEntity               `json:"rp"`
+		User                   *userEntity             `json:"user"`
+		PubKeyCredParams       []*credentialParameter  `json:"pubKeyCredParams"`
+		Timeout                int64                   `json:"timeout"`
+		ExcludeCredentials     []*credentialDescriptor `json:"excludeCredentials,omitempty"`
+		AuthenticatorSelection *authenticatorSelection `json:"authenticatorSelection"`
+		Attestation            string                  `json:"attestation"`
+	}
+
+	requestOptions struct {
+		Challenge        Bytes  `json:"challenge"`
+		RPID             string `json:"rpId"`
+		Timeout          int64  `json:"timeout"`
+		UserVerification string `json:"userVerification"`
+	}
+
+	registrationResponse struct {
+		ID       string `json:"id"`
+		RawID    Bytes  `json:"rawId"`
+		Type     string `json:"type"`
+		Response struct {
+			ClientDataJSON    Bytes `json:"clientDataJSON"`
+			AttestationObject Bytes `json:"attestationObject"`
+		} `json:"response"`
+	}
+
+	assertionResponse struct {
+		ID       string `json:"id"`
+		RawID    Bytes  `json:"rawId"`
+		Type     string `json:"type"`
+		Response struct {
+			ClientDataJSON    Bytes `json:"clientDataJSON"`
+			AuthenticatorData Bytes `json:"authenticatorData"`
+			Signature         Bytes `json:"signature"`
+			UserHandle        Bytes `json:"userHandle"`
+		} `json:"response"`
+	}
+)
+
+// New 声明 [WebAuthn] 对象
+//
+// sess 用于保存挑战值和登录状态，所有的处理函数都必须在 sess 的中间件之后调用；
+// store 为凭证的存储；
+// rpID 为依赖方的 ID，一般为网站的域名；rpName 为显示给用户的网站名称；
+// origins 为允许的来源，比如 https://example.com；
+// uv 是否要求验证器验证用户的身份，比如指纹或是 PIN；
+// getUser 获取需要注册凭证的用户，一般为当前已经登录的用户；
+// build 根据凭证生成用户数据；
+func New[T any](s web.Server, sess *session.Session[T], store Store, rpID, rpName string, origins []string, uv bool, getUser GetUserFunc, build BuildInfoFunc[T]) *WebAuthn[T] {
+	if sess == nil {
+		panic("参数 sess 不能为空")
+	}
+	if store == nil {
+		panic("参数 store 不能为空")
+	}
+	if len(origins) == 0 {
+		panic("参数 origins 不能为空")
+	}
+	if getUser == nil {
+		panic("参数 getUser 不能为空")
+	}
+	if build == nil {
+		panic("参数 build 不能为空")
+	}
+
+	return &WebAuthn[T]{
+		session: sess,
+		store:   store,
+		cache:   web.NewCache("webauthn_", s.Cache()),
+		getUser: getUser,
+		build:   build,
+
+		rpID:    rpID,
+		rpName:  rpName,
+		origins: origins,
+		uv:      uv,
+	}
+}
+
+// BeginRegistration 发起注册凭证
+//
+// 返回 PublicKeyCredentialCreationOptions 对象，客户端将其传递给 navigator.credentials.create()。
+func (w *WebAuthn[T]) BeginRegistration(ctx *web.Context) web.Responser {
+	u, resp := w.getUser(ctx)
+	if resp != nil {
+		return resp
+	}
+
+	creds, err := w.store.List(u.ID)
+	if err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+	exclude := make([]*credentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		exclude = append(exclude, &credentialDescriptor{Type: "public-key", ID: c.ID})
+	}
+
+	params := make([]*credentialParameter, 0, len(supportedAlgs))
+	for _, alg := range supportedAlgs {
+		params = append(params, &credentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	challenge, err := w.begin(ctx, "reg_", u.ID)
+	if err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+
+	return web.OK(&creationOptions{
+		Challenge:          challenge,
+		RP:                 &rpEntity{ID: w.rpID, Name: w.rpName},
+		User:               &userEntity{ID: u.ID, Name: u.Name, DisplayName: u.DisplayName},
+		PubKeyCredParams:   params,
+		Timeout:            ceremonyTimeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: &authenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: w.userVerification(),
+		},
+		Attestation: "none",
+	})
+}
+
+// FinishRegistration 完成注册凭证
+//
+// 提交的内容为 navigator.credentials.create() 返回的对象，验证通过之后保存至 [Store]。
+func (w *WebAuthn[T]) FinishRegistration(ctx *web.Context) web.Responser {
+	c, resp := w.finish(ctx, "reg_")
+	if resp != nil {
+		return resp
+	}
+
+	data := &registrationResponse{}
+	if p := ctx.Read(true, data, web.ProblemUnprocessableEntity); p != nil {
+		return p
+	}
+
+	if err := w.checkClientData(data.Response.ClientDataJSON, "webauthn.create", c.Challenge); err != nil {
+		ctx.Logs().DEBUG().Error(err)
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	hash := sha256.Sum256(data.Response.ClientDataJSON)
+	ad, format, err := parseAttestation(data.Response.AttestationObject, hash[:])
+	if err == nil {
+		err = ad.check(w.rpID, w.uv)
+	}
+	if err == nil && subtle.ConstantTimeCompare(ad.credentialID, data.RawID) != 1 {
+		err = web.NewLocaleError("webauthn credential id not match")
+	}
+	if err == nil {
+		_, err = parsePublicKey(ad.publicKey) // 确保是支持的算法
+	}
+	if err != nil {
+		ctx.Logs().DEBUG().Error(err)
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	if _, found, err := w.store.Get(ad.credentialID); err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	} else if found {
+		return ctx.Problem(web.ProblemConflict)
+	}
+
+	cred := &Credential{
+		ID:        slices.Clone(ad.credentialID),
+		UserID:    c.UserID,
+		PublicKey: slices.Clone(ad.publicKey),
+		SignCount: ad.signCount,
+		AAGUID:    slices.Clone(ad.aaguid),
+		Format:    format,
+		Created:   ctx.Begin(),
+	}
+	if err := w.store.Add(cred); err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+	return web.Status(http.StatusCreated)
+}
+
+// BeginLogin 发起登录
+//
+// 返回 PublicKeyCredentialRequestOptions 对象，客户端将其传递给 navigator.credentials.get()。
+// 不指定 allowCredentials，由用户从验证器中选择可用的通行密钥。
+func (w *WebAuthn[T]) BeginLogin(ctx *web.Context) web.Responser {
+	challenge, err := w.begin(ctx, "login_", nil)
+	if err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+
+	return web.OK(&requestOptions{
+		Challenge:        challenge,
+		RPID:             w.rpID,
+		Timeout:          ceremonyTimeout.Milliseconds(),
+		UserVerification: w.userVerification(),
+	})
+}
+
+// FinishLogin 完成登录
+//
+// 提交的内容为 navigator.credentials.get() 返回的对象，
+// 验证通过之后，由 [BuildInfoFunc] 生成的数据将通过 [session.Session.Login] 保存。
+//
+// 如果签名计数器未增长，可能是验证器被克隆，会拒绝登录。
+func (w *WebAuthn[T]) FinishLogin(ctx *web.Context) web.Responser {
+	c, resp := w.finish(ctx, "login_")
+	if resp != nil {
+		return resp
+	}
+
+	data := &assertionResponse{}
+	if p := ctx.Read(true, data, web.ProblemUnprocessableEntity); p != nil {
+		return p
+	}
+
+	if err := w.checkClientData(data.Response.ClientDataJSON, "webauthn.get", c.Challenge); err != nil {
+		ctx.Logs().DEBUG().Error(err)
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	cred, found, err := w.store.Get(data.RawID)
+	if err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	} else if !found {
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	if len(data.Response.UserHandle) > 0 && subtle.ConstantTimeCompare(data.Response.UserHandle, cred.UserID) != 1 {
+		ctx.Logs().DEBUG().LocaleString(web.Phrase("webauthn user handle not match"))
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	ad, err := parseAuthData(data.Response.AuthenticatorData)
+	if err == nil {
+		err = ad.check(w.rpID, w.uv)
+	}
+	if err != nil {
+		ctx.Logs().DEBUG().Error(err)
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	pub, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+	hash := sha256.Sum256(data.Response.ClientDataJSON)
+	signed := append(slices.Clip(data.Response.AuthenticatorData), hash[:]...)
+	if !pub.verify(signed, data.Response.Signature) {
+		ctx.Logs().DEBUG().LocaleString(web.Phrase("invalid webauthn signature"))
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+
+	// 不支持计数器的验证器始终返回 0
+	if (ad.signCount != 0 || cred.SignCount != 0) && ad.signCount <= cred.SignCount {
+		ctx.Logs().ERROR().LocaleString(web.Phrase("webauthn sign count not increased, the authenticator may be cloned"))
+		return ctx.Problem(web.ProblemUnauthorized)
+	}
+	if err := w.store.UpdateSignCount(cred.ID, ad.signCount); err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+	cred.SignCount = ad.signCount
+
+	v, resp := w.build(ctx, cred)
+	if resp != nil {
+		return resp
+	}
+	if err := w.session.Login(ctx, v); err != nil {
+		return ctx.Error(err, web.ProblemInternalServerError)
+	}
+	return web.NoContent()
+}
+
+func (w *WebAuthn[T]) userVerification() string {
+	if w.uv {
+		return "required"
+	}
+	return "preferred"
+}
+
+// 生成挑战值并与当前的 session 绑定
+func (w *WebAuthn[T]) begin(ctx *web.Context, prefix string, userID []byte) ([]byte, error) {
+	sid, err := w.session.GetSessionID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	c := &ceremony{Challenge: challenge, UserID: userID}
+	if err := w.cache.Set(prefix+sid, c, ceremonyTimeout); err != nil {
+		return nil, err
+	}
+	return c.Challenge, nil
+}
+
+// 获取当前 session 的挑战值，挑战值只能使用一次。
+func (w *WebAuthn[T]) finish(ctx *web.Context, prefix string) (*ceremony, web.Responser) {
+	sid, err := w.session.GetSessionID(ctx)
+	if err != nil {
+		return nil, ctx.Error(err, web.ProblemInternalServerError)
+	}
+
+	c := &ceremony{}
+	if err := w.cache.Get(prefix+sid, c); err != nil {
+		ctx.Logs().DEBUG().Error(err)
+		return nil, ctx.Problem(web.ProblemUnauthorized)
+	}
+	if err := w.cache.Delete(prefix + sid); err != nil {
+		ctx.Logs().ERROR().Error(err)
+	}
+	return c, nil
+}
+
+// https://www.w3.org/TR/webauthn-3/#sctn-registering-a-new-credential
+func (w *WebAuthn[T]) checkClientData(data []byte, typ string, challenge []byte) error {
+	cd := &clientData{}
+	if err := json.Unmarshal(data, cd); err != nil {
+		return err
+	}
+
+	if cd.Type != typ {
+		return web.NewLocaleError("invalid webauthn client data type %s", cd.Type)
+	}
+
+	c, err := base64.RawURLEncoding.DecodeString(cd.Challenge) // clientDataJSON 中的挑战值为原始字节的 base64url 编码
+	if err != nil || subtle.ConstantTimeCompare(c, challenge) != 1 {
+		return web.NewLocaleError("webauthn challenge not match")
+	}
+
+	if slices.Index(w.origins, cd.Origin) < 0 {
+		return web.NewLocaleError("invalid webauthn origin %s", cd.Origin)
+	}
+	return nil
+}
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	v, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
@@ -0,0 +1,399 @@
+// SPDX-FileCopyrightText: 2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+	"github.com/issue9/web"
+	"github.com/issue9/web/server/servertest"
+
+	"github.com/issue9/webuse/v7/internal/testserver"
+	"github.com/issue9/webuse/v7/middlewares/auth/session"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:8080"
+)
+
+type memStore struct {
+	mux   sync.Mutex
+	creds map[string]*Credential
+}
+
+func (s *memStore) Add(c *Credential) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, found := s.creds[string(c.ID)]; found {
+		return errors.New("exists")
+	}
+	s.creds[string(c.ID)] = c
+	return nil
+}
+
+func (s *memStore) Get(id []byte) (*Credential, bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	c, found := s.creds[string(id)]
+	if !found {
+		return nil, false, nil
+	}
+	cc := *c
+	return &cc, true, nil
+}
+
+func (s *memStore) List(userID []byte) ([]*Credential, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var list []*Credential
+	for _, c := range s.creds {
+		if string(c.UserID) == string(userID) {
+			list = append(list, c)
+		}
+	}
+	return list, nil
+}
+
+func (s *memStore) UpdateSignCount(id []byte, count uint32) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.creds[string(id)].SignCount = count
+	return nil
+}
+
+// 软件实现的验证器
+type authenticator struct {
+	a      *assert.Assertion
+	alg    int64
+	key    crypto.Signer
+	attKey crypto.Signer // 不为空时，packed 格式采用此密钥签名。
+	id     []byte
+	userID []byte
+	count  uint32
+	origin string
+}
+
+func newAuthenticator(a *assert.Assertion, alg int64) *authenticator {
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case AlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	a.NotError(err)
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	a.NotError(err)
+
+	return &authenticator{a: a, alg: alg, key: key, id: id, origin: testOrigin}
+}
+
+func (au *authenticator) coseKey() []byte {
+	switch pub := au.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		return encodeCBOR(map[any]any{
+			coseKty: coseKtyEC2, coseAlg: AlgES256, coseCrv: coseCrvP256,
+			coseX: pub.X.FillBytes(make([]byte, 32)), coseY: pub.Y.FillBytes(make([]byte, 32)),
+		})
+	case *rsa.PublicKey:
+		return encodeCBOR(map[any]any{
+			coseKty: coseKtyRSA, coseAlg: AlgRS256,
+			coseN: pub.N.Bytes(), coseE: big.NewInt(int64(pub.E)).Bytes(),
+		})
+	case ed25519.PublicKey:
+		return encodeCBOR(map[any]any{coseKty: coseKtyOKP, coseAlg: AlgEdDSA, coseCrv: coseCrvEd25519, coseX: []byte(pub)})
+	default:
+		panic("不支持的类型")
+	}
+}
+
+func (au *authenticator) sign(data []byte) []byte { return au.signWith(au.key, data) }
+
+func (au *authenticator) signWith(key crypto.Signer, data []byte) []byte {
+	var sig []byte
+	var err error
+	if au.alg == AlgEdDSA {
+		sig, err = key.Sign(rand.Reader, data, crypto.Hash(0))
+	} else {
+		sum := sha256.Sum256(data)
+		sig, err = key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	au.a.NotError(err)
+	return sig
+}
+
+func (au *authenticator) clientData(typ string, challenge []byte) []byte {
+	data, err := json.Marshal(&clientData{
+		Type:      typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    au.origin,
+	})
+	au.a.NotError(err)
+	return data
+}
+
+func (au *authenticator) authData(attested bool) []byte {
+	rp := sha256.Sum256([]byte(testRPID))
+	data := append(rp[:], flagUP|flagUV)
+	data = binary.BigEndian.AppendUint32(data, au.count)
+	if attested {
+		data[32] |= flagAT
+		data = append(data, make([]byte, 16)...) // aaguid
+		data = binary.BigEndian.AppendUint16(data, uint16(len(au.id)))
+		data = append(data, au.id...)
+		data = append(data, au.coseKey()...)
+	}
+	return data
+}
+
+// 模拟 navigator.credentials.create()
+func (au *authenticator) create(body []byte, format string) []byte {
+	opt := &creationOptions{}
+	au.a.NotError(json.Unmarshal(body, opt))
+	au.a.Equal(opt.RP.ID, testRPID)
+	au.userID = opt.User.ID
+
+	cd := au.clientData("webauthn.create", opt.Challenge)
+	ad := au.authData(true)
+
+	stmt := map[any]any{}
+	if format == "packed" {
+		sum := sha256.Sum256(cd)
+		stmt["alg"] = au.alg
+		key := au.key
+		if au.attKey != nil {
+			key = au.attKey
+		}
+		stmt["sig"] = au.signWith(key, append(ad, sum[:]...))
+	}
+
+	resp := &registrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(au.id),
+		RawID: au.id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = cd
+	resp.Response.AttestationObject = encodeCBOR(map[any]any{"fmt": format, "attStmt": stmt, "authData": ad})
+
+	data, err := json.Marshal(resp)
+	au.a.NotError(err)
+	return data
+}
+
+// 模拟 navigator.credentials.get()
+func (au *authenticator) get(body []byte) []byte {
+	opt := &requestOptions{}
+	au.a.NotError(json.Unmarshal(body, opt))
+	au.a.Equal(opt.RPID, testRPID)
+
+	au.a.Length(opt.Challenge, challengeSize) // 原始的随机字节
+
+	au.count++
+	cd := au.clientData("webauthn.get", opt.Challenge)
+	ad := au.authData(false)
+	sum := sha256.Sum256(cd)
+
+	resp := &assertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(au.id),
+		RawID: au.id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = cd
+	resp.Response.AuthenticatorData = ad
+	resp.Response.Signature = au.sign(append(ad, sum[:]...))
+	resp.Response.UserHandle = au.userID
+
+	data, err := json.Marshal(resp)
+	au.a.NotError(err)
+	return data
+}
+
+func TestWebAuthn(t *testing.T) {
+	a := assert.New(t, false)
+	srv := testserver.New(a)
+	sessStore := session.NewCacheStore[string](srv.Cache(), time.Minute)
+	sess := session.New(srv, sessStore, 60, "session_id", "/", "localhost", false, true)
+	srv.Routers().Use(sess)
+
+	store := &memStore{creds: map[string]*Credential{}}
+	w := New(srv, sess, store, testRPID, "test", []string{testOrigin}, true,
+		func(ctx *web.Context) (*User, web.Responser) {
+			if ctx.Request().Header.Get("X-User") == "" {
+				return nil, ctx.Problem(web.ProblemUnauthorized)
+			}
+			return &User{ID: []byte(ctx.Request().Header.Get("X-User")), Name: "u1", DisplayName: "U1"}, nil
+		},
+		func(_ *web.Context, c *Credential) (string, web.Responser) {
+			return string(c.UserID), nil
+		})
+
+	r := srv.Routers().New("def", nil)
+	r.Post("/register/begin", w.BeginRegistration)
+	r.Post("/register/finish", w.FinishRegistration)
+	r.Post("/login/begin", w.BeginLogin)
+	r.Post("/login/finish", w.FinishLogin)
+	r.Get("/info", func(ctx *web.Context) web.Responser {
+		u, found := sess.GetInfo(ctx)
+		if !found || u == "" {
+			return ctx.Problem(web.ProblemUnauthorized)
+		}
+		return web.OK(u)
+	})
+
+	defer servertest.Run(a, srv)()
+	defer srv.Close(0)
+
+	// 返回 session 的 cookie 和请求的内容
+	begin := func(a *assert.Assertion, path string) (cookie *http.Cookie, body []byte) {
+		resp := servertest.Post(a, "http://localhost:8080"+path, nil).
+			Header("X-User", "u1").
+			Do(nil).
+			Status(http.StatusOK).
+			BodyFunc(func(_ *assert.Assertion, b []byte) { body = b }).
+			Resp()
+		return resp.Cookies()[0], body
+	}
+
+	finish := func(a *assert.Assertion, path string, cookie *http.Cookie, body []byte, status int) {
+		servertest.Post(a, "http://localhost:8080"+path, body).
+			Header("Content-Type", "application/json").
+			Cookie(cookie).
+			Do(nil).
+			Status(status)
+	}
+
+	register := func(a *assert.Assertion, au *authenticator, format string) {
+		cookie, body := begin(a, "/register/begin")
+		finish(a, "/register/finish", cookie, au.create(body, format), http.StatusCreated)
+	}
+
+	login := func(a *assert.Assertion, au *authenticator, status int) {
+		cookie, body := begin(a, "/login/begin")
+		finish(a, "/login/finish", cookie, au.get(body), status)
+
+		if status == http.StatusNoContent {
+			servertest.Get(a, "http://localhost:8080/info").
+				Cookie(cookie).
+				Do(nil).
+				Status(http.StatusOK).
+				StringBody(`"u1"`)
+		}
+	}
+
+	for _, alg := range supportedAlgs {
+		for _, format := range []string{"none", "packed"} {
+			t.Run(format+"/"+strconv.FormatInt(alg, 10), func(t *testing.T) {
+				a := assert.New(t, false)
+				au := newAuthenticator(a, alg)
+				register(a, au, format)
+				login(a, au, http.StatusNoContent)
+				login(a, au, http.StatusNoContent)
+			})
+		}
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		a := assert.New(t, false)
+		servertest.Post(a, "http://localhost:8080/register/begin", nil).Do(nil).Status(http.StatusUnauthorized)
+	})
+
+	t.Run("exclude credentials", func(t *testing.T) {
+		a := assert.New(t, false)
+		_, body := begin(a, "/register/begin")
+		opt := &creationOptions{}
+		a.NotError(json.Unmarshal(body, opt)).
+			Length(opt.ExcludeCredentials, len(supportedAlgs)*2).
+			Equal(opt.Attestation, "none").
+			Equal(opt.AuthenticatorSelection.UserVerification, "required")
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		a := assert.New(t, false)
+		au := newAuthenticator(a, AlgES256)
+		register(a, au, "none")
+
+		cookie, body := begin(a, "/register/begin")
+		finish(a, "/register/finish", cookie, au.create(body, "none"), http.StatusConflict)
+	})
+
+	t.Run("challenge", func(t *testing.T) {
+		a := assert.New(t, false)
+		au := newAuthenticator(a, AlgES256)
+		register(a, au, "none")
+
+		// 挑战值只能使用一次
+		cookie, body := begin(a, "/login/begin")
+		data := au.get(body)
+		finish(a, "/login/finish", cookie, data, http.StatusNoContent)
+		finish(a, "/login/finish", cookie, data, http.StatusUnauthorized)
+
+		// 不同的会话
+		_, body = begin(a, "/login/begin")
+		cookie, _ = begin(a, "/login/begin")
+		finish(a, "/login/finish", cookie, au.get(body), http.StatusUnauthorized)
+	})
+
+	t.Run("origin", func(t *testing.T) {
+		a := assert.New(t, false)
+		au := newAuthenticator(a, AlgEdDSA)
+		register(a, au, "packed")
+
+		au.origin = "https://example.com"
+		login(a, au, http.StatusUnauthorized)
+	})
+
+	t.Run("sign count", func(t *testing.T) {
+		a := assert.New(t, false)
+		au := newAuthenticator(a, AlgES256)
+		register(a, au, "none")
+		login(a, au, http.StatusNoContent)
+
+		// 克隆的验证器
+		au.count = 0
+		login(a, au, http.StatusUnauthorized)
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		a := assert.New(t, false)
+		au := newAuthenticator(a, AlgES256)
+		register(a, au, "none")
+
+		other := newAuthenticator(a, AlgES256)
+		au.key = other.key
+		login(a, au, http.StatusUnauthorized)
+	})
+
+	t.Run("packed signature", func(t *testing.T) {
+		a := assert.New(t, false)
+		au := newAuthenticator(a, AlgES256)
+		au.attKey = newAuthenticator(a, AlgES256).key // 签名与凭证的公钥不匹配
+
+		cookie, body := begin(a, "/register/begin")
+		finish(a, "/register/finish", cookie, au.create(body, "packed"), http.StatusUnauthorized)
+	})
+}